@@ -5,7 +5,14 @@ go 1.14
 require (
 	github.com/jetstack/cert-manager v1.2.0
 	github.com/miekg/dns v1.1.31
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	k8s.io/apiextensions-apiserver v0.19.0
+	k8s.io/apiserver v0.19.0
 	k8s.io/client-go v0.19.0
+	k8s.io/component-base v0.19.0
+	k8s.io/klog v1.0.0
 )
@@ -0,0 +1,89 @@
+// Command generate-testdata writes the solver fixture used by the
+// conformance test suite (config.json and the token Secret manifest) from
+// environment variables, so contributors don't have to reverse-engineer the
+// layout of pkg/webhook/testdata/my-custom-solver.
+//
+// Usage:
+//
+//	TEST_DODE_TOKEN=<token> go run ./hack/generate-testdata
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+var configTemplate = template.Must(template.New("config.json").Parse(`{
+  "apiTokenSecretRef": {
+    "name": "{{ .SecretName }}",
+    "key": "{{ .SecretKey }}"
+  }
+}
+`))
+
+var secretTemplate = template.Must(template.New("secret.yaml").Parse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .SecretName }}
+data:
+  {{ .SecretKey }}: {{ .Token }}
+`))
+
+// fixture holds the values substituted into the templates.
+type fixture struct {
+	SecretName string
+	SecretKey  string
+	// Token is the base64 encoded API token.
+	Token string
+}
+
+func main() {
+	dir := flag.String("dir", "pkg/webhook/testdata/my-custom-solver", "Directory to write the fixture files to.")
+	flag.Parse()
+
+	token := os.Getenv("TEST_DODE_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "TEST_DODE_TOKEN must be set to the do.de API token used by the test suite")
+		os.Exit(1)
+	}
+	f := fixture{
+		SecretName: envOrDefault("TEST_SECRET_NAME", "dode-secret"),
+		SecretKey:  envOrDefault("TEST_SECRET_KEY", "DODE_TOKEN"),
+		Token:      base64.StdEncoding.EncodeToString([]byte(token)),
+	}
+
+	for name, tmpl := range map[string]*template.Template{
+		"config.json": configTemplate,
+		"secret.yaml": secretTemplate,
+	} {
+		path := filepath.Join(*dir, name)
+		if err := write(path, tmpl, f); err != nil {
+			fmt.Fprintf(os.Stderr, "writing %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Println("wrote", path)
+	}
+}
+
+func write(path string, tmpl *template.Template, f fixture) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func envOrDefault(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
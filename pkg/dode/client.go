@@ -0,0 +1,342 @@
+package dode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the do.de API endpoint used when no other is configured.
+const DefaultAPIURL = "https://www.do.de/api/letsencrypt"
+
+// DefaultTimeout bounds every request made by a client created by NewClient.
+const DefaultTimeout = 30 * time.Second
+
+// maxResponseSize bounds how much of a response body is read.
+const maxResponseSize = 1 << 20
+
+// Client manages ACME challenge TXT records through the do.de API.
+type Client struct {
+	// BaseURL is the API endpoint requests are sent to.
+	BaseURL string
+	// HTTPClient is used to perform requests.
+	HTTPClient *http.Client
+	// Response locates the fields of responses that were altered by a
+	// gateway in front of the API. The do.de envelope is expected if nil.
+	Response *ResponseFields
+	// OnResponse, if set, is called with every JSON response body, decoded
+	// into generic maps, slices and values, e.g. to watch its structure.
+	OnResponse func(v interface{})
+}
+
+// ResponseFields locates the fields of the API response in a wrapped or
+// renamed envelope. Paths are dot separated field names, optionally starting
+// with "$.", in which numeric elements index arrays, e.g. "$.data.success"
+// or "results.0.error".
+type ResponseFields struct {
+	// SuccessPath locates the field telling whether a request succeeded,
+	// "success" if empty.
+	SuccessPath string
+	// SuccessValue is the value of the success field meaning success. If
+	// empty, the field must be the boolean true.
+	SuccessValue string
+	// ErrorPath locates the error message, "error" if empty.
+	ErrorPath string
+}
+
+// Option configures a Client created by NewClient.
+type Option func(*Client)
+
+// WithBaseURL sends requests to url instead of DefaultAPIURL.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.BaseURL = url
+	}
+}
+
+// WithTimeout bounds every request by d instead of DefaultTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.HTTPClient.Timeout = d
+	}
+}
+
+// WithTransport performs requests through rt, e.g. to record or instrument
+// them or to inject faults in tests.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.HTTPClient.Transport = rt
+	}
+}
+
+// WithHTTPClient performs requests with client, replacing the one built by
+// NewClient including the effect of previous options.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = client
+	}
+}
+
+// NewClient returns a client for the default do.de API endpoint, configured
+// by opts.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		BaseURL: DefaultAPIURL,
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned when the API rejected a request, either with a non-2xx
+// status code or with an unsuccessful response body.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the error reported by the API, if any.
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("DODE API returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("DODE API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// IsAuthError reports whether err means the API rejected the token: a 401 or
+// 403 status, or an unsuccessful response whose error mentions the token,
+// such as "invalid token".
+func IsAuthError(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return true
+	}
+	return e.StatusCode == http.StatusOK && strings.Contains(strings.ToLower(e.Message), "token")
+}
+
+// response is implemented by the typed response envelope of every endpoint.
+// err returns the error reported by the envelope, if any.
+type response interface {
+	err() error
+}
+
+// statusResponse is the envelope returned when creating or deleting records.
+type statusResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+func (r *statusResponse) err() error {
+	if r.Success {
+		return nil
+	}
+	msg := r.Error
+	if msg == "" {
+		msg = "request was not successful"
+	}
+	return &Error{StatusCode: http.StatusOK, Message: msg}
+}
+
+// Present creates a TXT record with value at domain. A positive ttl sets the
+// TTL of the record in seconds, otherwise the API's default applies. token
+// is an API token or the credentials returned by BasicAuth.
+func (c *Client) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	q := url.Values{}
+	q.Set("domain", domain)
+	q.Set("value", value)
+	if ttl > 0 {
+		q.Set("ttl", strconv.Itoa(ttl))
+	}
+	var r statusResponse
+	if err := c.do(ctx, "GET", token, q, &r); err != nil {
+		return fmt.Errorf("presenting TXT record for %s: %w", domain, err)
+	}
+	return nil
+}
+
+// CleanUp deletes the TXT records at domain.
+func (c *Client) CleanUp(ctx context.Context, token, domain string) error {
+	q := url.Values{}
+	q.Set("domain", domain)
+	q.Set("action", "delete")
+	var r statusResponse
+	if err := c.do(ctx, "GET", token, q, &r); err != nil {
+		return fmt.Errorf("deleting TXT records for %s: %w", domain, err)
+	}
+	return nil
+}
+
+// do performs a request with query, authenticated with token, and decodes
+// the response body into out. Non-2xx responses are turned into an *Error
+// carrying the start of the body, as error pages rarely are JSON. Errors
+// carry neither the token nor the TXT value, which is replaced by its
+// digest.
+func (c *Client) do(ctx context.Context, method, token string, query url.Values, out response) (err error) {
+	value := query.Get("value")
+	redact := func(s string) string {
+		return redactValue(RedactToken(s, token), value)
+	}
+	defer func() {
+		var apiErr *Error
+		if errors.As(err, &apiErr) {
+			apiErr.Message = redact(apiErr.Message)
+		}
+	}()
+
+	url := fmt.Sprintf("%s?%s", c.BaseURL, query.Encode())
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return &redactedError{msg: redact(err.Error()), err: err}
+	}
+	authenticate(req, token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		msg := fmt.Sprintf("Error querying DODE API for %s %q -> %v", method, url, err)
+		return &redactedError{msg: redact(msg), err: err}
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, maxResponseSize)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(body, 256))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(snippet))}
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return fmt.Errorf("error decoding DODE API response: %v", err)
+	}
+	if c.Response != nil || c.OnResponse != nil {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("error decoding DODE API response: %v", err)
+		}
+		if c.OnResponse != nil {
+			c.OnResponse(v)
+		}
+		if c.Response != nil {
+			return c.Response.err(v)
+		}
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("error decoding DODE API response: %v", err)
+	}
+	return out.err()
+}
+
+// redacted replaces the token in messages.
+const redacted = "<redacted>"
+
+// RedactToken returns s with every occurrence of token, verbatim or query
+// escaped as in request URLs, replaced by a placeholder. The password of
+// credentials returned by BasicAuth is replaced as well.
+func RedactToken(s, token string) string {
+	for _, secret := range secrets(token) {
+		if secret == "" {
+			continue
+		}
+		s = strings.Replace(s, secret, redacted, -1)
+		s = strings.Replace(s, url.QueryEscape(secret), redacted, -1)
+	}
+	return s
+}
+
+// redactValue returns s with every occurrence of the TXT value, verbatim or
+// query escaped, replaced by the first 8 hex digits of its SHA-256 digest.
+// That still tells the records of challenges apart in logs without spreading
+// the values.
+func redactValue(s, value string) string {
+	if value == "" {
+		return s
+	}
+	sum := sha256.Sum256([]byte(value))
+	digest := "sha256:" + hex.EncodeToString(sum[:4])
+	s = strings.Replace(s, value, digest, -1)
+	return strings.Replace(s, url.QueryEscape(value), digest, -1)
+}
+
+// redactedError is an error of the HTTP client with the token masked in its
+// message. The original error remains available to errors.Is and errors.As.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// err returns the error reported by the decoded response v.
+func (f *ResponseFields) err(v interface{}) error {
+	successPath, errorPath := f.SuccessPath, f.ErrorPath
+	if successPath == "" {
+		successPath = "success"
+	}
+	if errorPath == "" {
+		errorPath = "error"
+	}
+	if success, ok := lookupPath(v, successPath); ok {
+		if b, isBool := success.(bool); f.SuccessValue == "" && isBool && b {
+			return nil
+		}
+		if f.SuccessValue != "" && success != nil && fmt.Sprint(success) == f.SuccessValue {
+			return nil
+		}
+	}
+	msg := "request was not successful"
+	if e, ok := lookupPath(v, errorPath); ok && e != nil && fmt.Sprint(e) != "" {
+		msg = fmt.Sprint(e)
+	}
+	return &Error{StatusCode: http.StatusOK, Message: msg}
+}
+
+// lookupPath returns the element of v at path, see ResponseFields.
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return v, true
+	}
+	for _, elem := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[elem]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Domain converts a fully qualified challenge name as handed out by
+// cert-manager (with a trailing dot) into the form expected by the API.
+func Domain(fqdn string) string {
+	return strings.TrimSuffix(fqdn, ".")
+}
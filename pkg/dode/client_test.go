@@ -0,0 +1,262 @@
+package dode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers requests without a network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("token") != "secret" {
+			fmt.Fprint(w, `{"success":false,"error":"invalid token"}`)
+			return
+		}
+		if q.Get("domain") != "_acme-challenge.example.com" {
+			t.Errorf("unexpected domain %q", q.Get("domain"))
+		}
+		if q.Get("action") != "delete" && q.Get("value") != "key" {
+			t.Errorf("unexpected value %q", q.Get("value"))
+		}
+		if q.Get("action") != "delete" && q.Get("ttl") != "300" {
+			t.Errorf("unexpected ttl %q", q.Get("ttl"))
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL))
+	ctx := context.Background()
+
+	if err := c.Present(ctx, "secret", "_acme-challenge.example.com", "key", 300); err != nil {
+		t.Errorf("Present: %v", err)
+	}
+	if err := c.CleanUp(ctx, "secret", "_acme-challenge.example.com"); err != nil {
+		t.Errorf("CleanUp: %v", err)
+	}
+	if err := c.Present(ctx, "wrong", "_acme-challenge.example.com", "key", 300); err == nil {
+		t.Errorf("expected an error for an invalid token")
+	}
+}
+
+func TestClientStatusCodes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("domain") {
+		case "unavailable":
+			http.Error(w, "<html>maintenance</html>", http.StatusServiceUnavailable)
+		case "garbage":
+			fmt.Fprint(w, "<html>")
+		default:
+			fmt.Fprint(w, `{"success":false}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL))
+	ctx := context.Background()
+
+	err := c.Present(ctx, "token", "unavailable", "key", 0)
+	if !strings.Contains(err.Error(), "status 503") || !strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("expected status error, got %v", err)
+	}
+	if err := c.Present(ctx, "token", "garbage", "key", 0); err == nil || !strings.Contains(err.Error(), "decoding") {
+		t.Errorf("expected decoding error, got %v", err)
+	}
+	if err := c.CleanUp(ctx, "token", "failing"); err == nil || !strings.Contains(err.Error(), "not successful") {
+		t.Errorf("expected unsuccessful response error, got %v", err)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	for in, want := range map[string]string{
+		"_acme-challenge.example.com.": "_acme-challenge.example.com",
+		"_acme-challenge.example.com":  "_acme-challenge.example.com",
+		"":                             "",
+	} {
+		if got := Domain(in); got != want {
+			t.Errorf("Domain(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClientResponseFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "secret" {
+			fmt.Fprint(w, `{"status":"error","data":[{"message":"invalid token"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","data":[{"success":true}]}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL))
+	c.Response = &ResponseFields{SuccessPath: "$.status", SuccessValue: "ok", ErrorPath: "$.data.0.message"}
+	ctx := context.Background()
+
+	if err := c.Present(ctx, "secret", "_acme-challenge.example.com", "key", 0); err != nil {
+		t.Errorf("Present: %v", err)
+	}
+	err := c.Present(ctx, "wrong", "_acme-challenge.example.com", "key", 0)
+	if err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("expected the error message of the gateway envelope, got %v", err)
+	}
+
+	c.Response = &ResponseFields{SuccessPath: "data.0.success"}
+	if err := c.CleanUp(ctx, "secret", "_acme-challenge.example.com"); err != nil {
+		t.Errorf("CleanUp: %v", err)
+	}
+	c.Response = &ResponseFields{SuccessPath: "data.1.success"}
+	if err := c.CleanUp(ctx, "secret", "_acme-challenge.example.com"); err == nil {
+		t.Errorf("expected an error for a missing success field")
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	var requests []string
+	c := NewClient(
+		WithBaseURL("https://gateway.invalid/dode"),
+		WithTimeout(time.Second),
+		WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requests = append(requests, r.URL.Host+r.URL.Path)
+			return nil, errors.New("connection reset")
+		})),
+	)
+	if c.HTTPClient.Timeout != time.Second {
+		t.Errorf("expected timeout of 1s, got %v", c.HTTPClient.Timeout)
+	}
+	if err := c.Present(context.Background(), "secret", "_acme-challenge.example.com", "key", 0); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the injected fault, got %v", err)
+	}
+	if len(requests) != 1 || requests[0] != "gateway.invalid/dode" {
+		t.Errorf("unexpected requests %q", requests)
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("presenting TXT record for x: %w", &Error{StatusCode: http.StatusUnauthorized}), true},
+		{&Error{StatusCode: http.StatusForbidden, Message: "denied"}, true},
+		{&Error{StatusCode: http.StatusOK, Message: "Invalid Token"}, true},
+		{&Error{StatusCode: http.StatusOK, Message: "domain not found"}, false},
+		{&Error{StatusCode: http.StatusBadGateway, Message: "token service unavailable"}, false},
+		{errors.New("connection reset"), false},
+	} {
+		if got := IsAuthError(tc.err); got != tc.want {
+			t.Errorf("IsAuthError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorsRedactToken(t *testing.T) {
+	const token = "s3cr3t/t0k+n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("domain") {
+		case "status.example.com":
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "upstream rejected %s", r.URL.RawQuery)
+		default:
+			fmt.Fprintf(w, `{"success":false,"error":"token %s is invalid"}`, r.URL.Query().Get("token"))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := NewClient(WithBaseURL(srv.URL))
+	for _, domain := range []string{"status.example.com", "envelope.example.com"} {
+		err := c.CleanUp(ctx, token, domain)
+		if err == nil {
+			t.Fatalf("%s: expected an error", domain)
+		}
+		if strings.Contains(err.Error(), "t0k") {
+			t.Errorf("%s: expected the token to be redacted, got %v", domain, err)
+		}
+	}
+	if err := c.CleanUp(ctx, token, "envelope.example.com"); !IsAuthError(err) {
+		t.Errorf("expected redacted errors to still be auth errors, got %v", err)
+	}
+
+	reset := errors.New("connection reset")
+	c = NewClient(WithBaseURL(srv.URL), WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, reset
+	})))
+	err := c.Present(ctx, token, "_acme-challenge.example.com", "key", 0)
+	if err == nil || strings.Contains(err.Error(), "t0k") || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the transport error with the token redacted, got %v", err)
+	}
+	if !errors.Is(err, reset) {
+		t.Errorf("expected the transport error to stay wrapped, got %v", err)
+	}
+}
+
+func TestErrorsRedactValue(t *testing.T) {
+	const value = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "upstream rejected %s", r.URL.RawQuery)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := NewClient(WithBaseURL(srv.URL))
+	err := c.Present(ctx, "token", "_acme-challenge.example.com", value, 0)
+	if err == nil || strings.Contains(err.Error(), value) || !strings.Contains(err.Error(), "sha256:") {
+		t.Errorf("expected the API error with the value replaced by its digest, got %v", err)
+	}
+
+	c = NewClient(WithBaseURL(srv.URL), WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection reset")
+	})))
+	err = c.Present(ctx, "token", "_acme-challenge.example.com", value, 0)
+	if err == nil || strings.Contains(err.Error(), value) || !strings.Contains(err.Error(), "sha256:") {
+		t.Errorf("expected the transport error with the value replaced by its digest, got %v", err)
+	}
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if r.URL.Query().Get("token") != "" || !ok || username != "user" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if password != "p@ss:word" {
+			fmt.Fprintf(w, `{"success":false,"error":"wrong password %s"}`, password)
+			return
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	}))
+	defer srv.Close()
+	c := NewClient(WithBaseURL(srv.URL))
+	ctx := context.Background()
+
+	creds := BasicAuth("user", "p@ss:word")
+	if !IsBasicAuth(creds) || IsBasicAuth("token") {
+		t.Errorf("expected only credentials of BasicAuth to be basic auth")
+	}
+	if err := c.Present(ctx, creds, "_acme-challenge.example.com", "key", 0); err != nil {
+		t.Errorf("Present: %v", err)
+	}
+	err := c.CleanUp(ctx, BasicAuth("user", "guessed"), "_acme-challenge.example.com")
+	if err == nil || strings.Contains(err.Error(), "guessed") {
+		t.Errorf("expected an error with the password redacted, got %v", err)
+	}
+	if err := c.CleanUp(ctx, "token", "_acme-challenge.example.com"); !IsAuthError(err) {
+		t.Errorf("expected a token to be refused, got %v", err)
+	}
+}
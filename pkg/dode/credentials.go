@@ -0,0 +1,61 @@
+package dode
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// basicAuthPrefix marks credentials returned by BasicAuth.
+const basicAuthPrefix = "basic-auth:"
+
+// BasicAuth returns the credentials of an account without an API token,
+// authenticating with its username and password. They can be passed to
+// Present and CleanUp in place of a token, and to RedactToken.
+func BasicAuth(username, password string) string {
+	return basicAuthPrefix + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// parseBasicAuth returns the username and password of credentials returned
+// by BasicAuth.
+func parseBasicAuth(credentials string) (username, password string, ok bool) {
+	if !strings.HasPrefix(credentials, basicAuthPrefix) {
+		return "", "", false
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(credentials, basicAuthPrefix))
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// IsBasicAuth reports whether credentials were returned by BasicAuth.
+func IsBasicAuth(credentials string) bool {
+	_, _, ok := parseBasicAuth(credentials)
+	return ok
+}
+
+// authenticate adds credentials to req: an API token as the token query
+// parameter, the credentials of BasicAuth as Authorization header.
+func authenticate(req *http.Request, credentials string) {
+	if username, password, ok := parseBasicAuth(credentials); ok {
+		req.SetBasicAuth(username, password)
+		return
+	}
+	q := req.URL.Query()
+	q.Set("token", credentials)
+	req.URL.RawQuery = q.Encode()
+}
+
+// secrets returns the parts of credentials that must not show up in errors
+// and logs.
+func secrets(credentials string) []string {
+	if _, password, ok := parseBasicAuth(credentials); ok {
+		return []string{credentials, password}
+	}
+	return []string{credentials}
+}
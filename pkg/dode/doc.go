@@ -0,0 +1,16 @@
+// Package dode implements a minimal client for the do.de Let's Encrypt DNS
+// API together with the name normalization the webhook applies to challenge
+// names.
+//
+// The package deliberately depends on nothing but the standard library so
+// that it can be embedded in programs that don't run inside Kubernetes, such
+// as CLI tools, without pulling in client-go.
+//
+// The API is intentionally small: a record is created by passing token,
+// domain and value, and deleted by passing token, domain and action=delete.
+// It has no notion of record comments, labels or ownership, and a delete
+// removes every TXT value at the name. Ownership-aware behaviour therefore
+// has to be tracked by the caller rather than tagged on the records.
+// Accounts without an API token authenticate with HTTP basic auth instead,
+// by passing the credentials of BasicAuth wherever a token is expected.
+package dode
@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package dode
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// FuzzPresent makes sure the API request built from any name and value
+// carries them unchanged, so that weird domains can't produce malformed or
+// ambiguous requests.
+func FuzzPresent(f *testing.F) {
+	f.Add("_acme-challenge.example.com.", "key")
+	f.Add("a&action=delete", "b#c")
+	f.Add("_acme-challenge.xn--bcher-kva.example.", "=?%00")
+	f.Fuzz(func(t *testing.T, fqdn, value string) {
+		c := NewClient(WithBaseURL("https://dode.invalid/api/letsencrypt"), WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			q := r.URL.Query()
+			if got := q.Get("domain"); got != Domain(fqdn) {
+				t.Errorf("domain %q was sent as %q", Domain(fqdn), got)
+			}
+			if got := q.Get("value"); got != value {
+				t.Errorf("value %q was sent as %q", value, got)
+			}
+			if len(q["action"]) > 0 {
+				t.Errorf("unexpected action parameter in %s", r.URL)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"success":true}`)),
+			}, nil
+		})))
+		if err := c.Present(context.Background(), "token", Domain(fqdn), value, 0); err != nil {
+			t.Errorf("Present(%q, %q): %v", fqdn, value, err)
+		}
+	})
+}
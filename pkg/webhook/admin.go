@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// serveAdmin serves the webhook's plain HTTP admin endpoints on addr until
+// stopCh is closed. These complement the endpoints of the webhook apiserver,
+// which can't be extended through the webhook serving library.
+func serveAdmin(addr string, mux *http.ServeMux, stopCh <-chan struct{}) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	klog.Infof("serving admin endpoints on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("admin server on %s failed: %v", addr, err)
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultAPIKeyCacheTTL is how long a token read from a Secret is used for
+// further challenges without reading the Secret again.
+const defaultAPIKeyCacheTTL = 10 * time.Second
+
+// apiKeyCache remembers the tokens read from Secrets for a short time, so
+// that a burst of challenges of the same issuer, e.g. when many Certificates
+// are renewed at once, reads each Secret once rather than for every
+// challenge. Tokens are cached per Secret and keys. A token the API rejects
+// is dropped and read again, so rotations take effect right away.
+type apiKeyCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]cachedAPIKey
+}
+
+// cachedAPIKey is a token and when it expires from the cache.
+type cachedAPIKey struct {
+	token   string
+	expires time.Time
+}
+
+// newAPIKeyCache returns an apiKeyCache keeping tokens for ttl. Nothing is
+// cached if ttl is zero.
+func newAPIKeyCache(ttl time.Duration) *apiKeyCache {
+	return &apiKeyCache{ttl: ttl, now: time.Now, tokens: map[string]cachedAPIKey{}}
+}
+
+// add caches token as just read for cred.
+func (c *apiKeyCache) add(cred, token string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[cred] = cachedAPIKey{token: token, expires: c.now().Add(c.ttl)}
+}
+
+// get returns the token cached for cred, unless it expired.
+func (c *apiKeyCache) get(cred string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tokens[cred]
+	if !ok {
+		return "", false
+	}
+	if !c.now().Before(t.expires) {
+		delete(c.tokens, cred)
+		return "", false
+	}
+	return t.token, true
+}
+
+// invalidate drops the token cached for cred, e.g. because the API rejected
+// it.
+func (c *apiKeyCache) invalidate(cred string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, cred)
+}
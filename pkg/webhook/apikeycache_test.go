@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAPIKeyCache(t *testing.T) {
+	now := time.Now()
+	c := newAPIKeyCache(10 * time.Second)
+	c.now = func() time.Time { return now }
+
+	c.add("default/dode[token]", "abc")
+	if token, ok := c.get("default/dode[token]"); !ok || token != "abc" {
+		t.Errorf("expected the cached token, got %q, %v", token, ok)
+	}
+	if _, ok := c.get("default/dode[apiKey]"); ok {
+		t.Errorf("expected tokens to be cached per key")
+	}
+	now = now.Add(10 * time.Second)
+	if _, ok := c.get("default/dode[token]"); ok {
+		t.Errorf("expected the token to expire after the TTL")
+	}
+
+	c.add("default/dode[token]", "abc")
+	c.invalidate("default/dode[token]")
+	if _, ok := c.get("default/dode[token]"); ok {
+		t.Errorf("expected the token to be invalidated")
+	}
+
+	disabled := newAPIKeyCache(0)
+	disabled.add("default/dode[token]", "abc")
+	if _, ok := disabled.get("default/dode[token]"); ok {
+		t.Errorf("expected nothing to be cached with a TTL of zero")
+	}
+}
+
+func TestGetAPIKeyCachesTokens(t *testing.T) {
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dode"},
+		Data:       map[string][]byte{"token": []byte("abc")},
+	}
+	client := fake.NewSimpleClientset(sec)
+	reads := 0
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		reads++
+		return false, nil, nil
+	})
+	c := newDodeDNSProviderSolver(client, nil)
+	cfg := &dodeDNSProviderConfig{}
+	cfg.APITokenSecretRef.Name = "dode"
+
+	for i := 0; i < 3; i++ {
+		if token, err := c.getAPIKey(cfg, "default", false); err != nil || token != "abc" {
+			t.Fatalf("expected the token from the secret, got %q, %v", token, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("expected the secret to be read once, got %d reads", reads)
+	}
+
+	fresh := *cfg
+	fresh.fresh = true
+	if _, err := c.getAPIKey(&fresh, "default", false); err != nil || reads != 2 {
+		t.Errorf("expected a fresh read to bypass the cache, got %v after %d reads", err, reads)
+	}
+}
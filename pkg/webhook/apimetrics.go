@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+)
+
+// instrumentHandlers wraps the handler chain of the serving library, built
+// by build, so that the requests cert-manager makes to the solvers of
+// groupName are observed in dode_webhook_handler_duration_seconds, by
+// solver resource and status code. The chain includes authentication and
+// authorization, so together with dode_webhook_challenge_duration_seconds
+// and the API request durations it tells apart time spent in the serving
+// library, in the solver and at the provider. Other requests, e.g. for
+// discovery or health, are passed through unobserved.
+func instrumentHandlers(groupName string, build func(http.Handler, *genericapiserver.Config) http.Handler) func(http.Handler, *genericapiserver.Config) http.Handler {
+	prefix := "/apis/" + groupName + "/"
+	return func(apiHandler http.Handler, c *genericapiserver.Config) http.Handler {
+		chain := build(apiHandler, c)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resource := solverResource(prefix, r.URL.Path)
+			if resource == "" {
+				chain.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			chain.ServeHTTP(sw, r)
+			handlerDuration.WithLabelValues(resource, strconv.Itoa(sw.code)).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// solverResource returns the resource, named like the solver, of a request
+// to path below prefix, /apis/<group>/, of the form
+// /apis/<group>/<version>/<resource>, or "" for any other path.
+func solverResource(prefix, path string) string {
+	if !strings.HasPrefix(path, prefix) {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return parts[1]
+}
+
+// statusWriter records the status code written to a ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// apiMetricsTransport observes the duration and status code of every request
+// to the DODE API in dode_webhook_api_request_duration_seconds. A nil base
+// is the default transport, subject to strict egress.
+type apiMetricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *apiMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = &egressTransport{base: http.DefaultTransport}
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	operation, code := apiRequestLabels(req, resp, err)
+	apiRequestDuration.WithLabelValues(operation, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// apiRequestLabels returns the operation of an API request, present, cleanup
+// or other (e.g. the clock skew check), and the status code of its response,
+// or "error" if there was none.
+func apiRequestLabels(req *http.Request, resp *http.Response, err error) (string, string) {
+	operation := "other"
+	if req.Method == http.MethodGet {
+		operation = "present"
+		if req.URL.Query().Get("action") == "delete" {
+			operation = "cleanup"
+		}
+	}
+	if err != nil || resp == nil {
+		return operation, "error"
+	}
+	return operation, strconv.Itoa(resp.StatusCode)
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+)
+
+func TestAPIRequestLabels(t *testing.T) {
+	for _, tc := range []struct {
+		method, url     string
+		resp            *http.Response
+		err             error
+		operation, code string
+	}{
+		{"GET", "https://www.do.de/api/letsencrypt?domain=x&value=v", &http.Response{StatusCode: 200}, nil, "present", "200"},
+		{"GET", "https://www.do.de/api/letsencrypt?action=delete&domain=x", &http.Response{StatusCode: 502}, nil, "cleanup", "502"},
+		{"HEAD", "https://www.do.de/api/letsencrypt", nil, errors.New("timeout"), "other", "error"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		if op, code := apiRequestLabels(req, tc.resp, tc.err); op != tc.operation || code != tc.code {
+			t.Errorf("%s %s: expected %s/%s, got %s/%s", tc.method, tc.url, tc.operation, tc.code, op, code)
+		}
+	}
+}
+
+func TestAPIMetricsTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+	resp, err := (&http.Client{Transport: &apiMetricsTransport{}}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("expected the response to be passed through, got %d", resp.StatusCode)
+	}
+}
+
+func TestSolverResource(t *testing.T) {
+	prefix := "/apis/acme.example.com/"
+	for path, resource := range map[string]string{
+		"/apis/acme.example.com/v1alpha1/dode": "dode",
+		"/apis/acme.example.com/v1alpha1":      "",
+		"/apis/acme.example.com/v1alpha1/":     "",
+		"/apis/other.example.com/v1alpha1/x":   "",
+		"/healthz":                             "",
+	} {
+		if got := solverResource(prefix, path); got != resource {
+			t.Errorf("%s: expected %q, got %q", path, resource, got)
+		}
+	}
+}
+
+func TestInstrumentHandlers(t *testing.T) {
+	build := func(h http.Handler, c *genericapiserver.Config) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+	}
+	h := instrumentHandlers("acme.example.com", build)(nil, nil)
+	for _, path := range []string{"/apis/acme.example.com/v1alpha1/dode", "/healthz"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected the status of the chain, got %d", path, rec.Code)
+		}
+	}
+
+	sw := &statusWriter{ResponseWriter: httptest.NewRecorder(), code: http.StatusOK}
+	sw.Write([]byte("ok"))
+	sw.WriteHeader(http.StatusInternalServerError)
+	if sw.code != http.StatusOK {
+		t.Errorf("expected the status of the first write to be kept, got %d", sw.code)
+	}
+}
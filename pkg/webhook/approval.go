@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// approvedZonesAnnotation is the annotation of the approval ConfigMap that
+// lists the approved zones, separated by commas.
+const approvedZonesAnnotation = "dode.acme.webhook/approved-zones"
+
+// approvalCacheTTL is how long approved zones are served from memory before
+// the ConfigMap is read again, and so how long a revoked approval may still
+// be honoured.
+const approvalCacheTTL = 30 * time.Second
+
+// zoneApprovals holds challenges for zones an operator has not approved yet.
+// It keeps a compromised namespace from using a shared token to obtain
+// certificates for arbitrary zones. Approvals are stored in an annotation of
+// a ConfigMap, which operators can edit directly or through the admin
+// endpoint.
+type zoneApprovals struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	now       func() time.Time
+
+	mu       sync.Mutex
+	approved map[string]bool
+	// loaded is when approved was last read from the ConfigMap.
+	loaded time.Time
+	// pending maps zones that were refused to the time they were first seen.
+	pending map[string]time.Time
+}
+
+// newZoneApprovals returns approvals stored in the ConfigMap namespace/name.
+func newZoneApprovals(client kubernetes.Interface, ref string) (*zoneApprovals, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("--dode.zone-approval-configmap must be of the form namespace/name, got %q", ref)
+	}
+	return &zoneApprovals{
+		client:    client,
+		namespace: parts[0],
+		name:      parts[1],
+		now:       time.Now,
+		approved:  map[string]bool{},
+		pending:   map[string]time.Time{},
+	}, nil
+}
+
+// check returns an error unless zone has been approved, and remembers the
+// zone as awaiting approval.
+func (a *zoneApprovals) check(ctx context.Context, zone string) error {
+	zone = normalizeName(zone)
+	ok, err := a.isApproved(ctx, zone)
+	if err != nil || ok {
+		return err
+	}
+
+	a.mu.Lock()
+	if _, ok := a.pending[zone]; !ok {
+		klog.Warningf("holding challenges for zone %q until it is approved", zone)
+		a.pending[zone] = a.now()
+	}
+	a.mu.Unlock()
+	return fmt.Errorf("zone %q has not been approved; add it to the %s annotation of ConfigMap %s/%s or POST to /zones/approve?zone=%s on the admin port",
+		zone, approvedZonesAnnotation, a.namespace, a.name, zone)
+}
+
+// isApproved reports whether zone has been approved. Approved zones are
+// served from memory for approvalCacheTTL, so that zones removed from the
+// ConfigMap are refused again once it expired. The ConfigMap is read again
+// before refusing a zone so that approvals made by editing it take effect
+// on the next retry of the challenge.
+func (a *zoneApprovals) isApproved(ctx context.Context, zone string) (bool, error) {
+	zone = normalizeName(zone)
+	a.mu.Lock()
+	ok := a.approved[zone] && a.now().Sub(a.loaded) < approvalCacheTTL
+	a.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+
+	// Read without holding a.mu, so that other challenges and /readyz
+	// don't wait for the API server.
+	approved, err := a.read(ctx)
+	if err != nil {
+		return false, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.approved, a.loaded = approved, a.now()
+	if approved[zone] {
+		delete(a.pending, zone)
+		return true, nil
+	}
+	return false, nil
+}
+
+// approve adds zone to the approved zones, creating the ConfigMap if needed.
+func (a *zoneApprovals) approve(ctx context.Context, zone string) error {
+	zone = normalizeName(zone)
+	cms := a.client.CoreV1().ConfigMaps(a.namespace)
+	cm, err := cms.Get(ctx, a.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: a.namespace, Name: a.name}}
+		cm.Annotations = map[string]string{approvedZonesAnnotation: zone}
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+	} else if err == nil {
+		zones := parseApprovedZones(cm.Annotations[approvedZonesAnnotation])
+		if !zones[zone] {
+			zones[zone] = true
+			if cm.Annotations == nil {
+				cm.Annotations = map[string]string{}
+			}
+			cm.Annotations[approvedZonesAnnotation] = formatApprovedZones(zones)
+			_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to store approval of zone %q in ConfigMap %s/%s: %v", zone, a.namespace, a.name, err)
+	}
+	klog.Infof("zone %q approved", zone)
+	a.mu.Lock()
+	a.approved[zone] = true
+	delete(a.pending, zone)
+	a.mu.Unlock()
+	return nil
+}
+
+// read returns the approved zones listed in the ConfigMap. A missing
+// ConfigMap approves no zones.
+func (a *zoneApprovals) read(ctx context.Context) (map[string]bool, error) {
+	cm, err := a.client.CoreV1().ConfigMaps(a.namespace).Get(ctx, a.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read approved zones from ConfigMap %s/%s: %v", a.namespace, a.name, err)
+	}
+	return parseApprovedZones(cm.Annotations[approvedZonesAnnotation]), nil
+}
+
+// healthCheck reports the webhook as degraded while challenges are held.
+func (a *zoneApprovals) healthCheck() (healthState, string) {
+	pending := a.pendingZones()
+	if len(pending) == 0 {
+		return healthHealthy, ""
+	}
+	return healthDegraded, "zones awaiting approval: " + strings.Join(pending, ", ")
+}
+
+func (a *zoneApprovals) pendingZones() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var zones []string
+	for zone := range a.pending {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// serveZones lists the zones awaiting approval.
+func (a *zoneApprovals) serveZones(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Pending []string `json:"pending"`
+	}{a.pendingZones()})
+}
+
+// serveApprove approves the zone given in the zone query parameter. As the
+// admin port is reachable from other pods, approvals are only accepted from
+// the loopback interface, i.e. through kubectl port-forward or exec.
+func (a *zoneApprovals) serveApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isLoopback(r.RemoteAddr) {
+		http.Error(w, "zones can only be approved from localhost", http.StatusForbidden)
+		return
+	}
+	zone := r.URL.Query().Get("zone")
+	if zone == "" {
+		http.Error(w, "missing zone parameter", http.StatusBadRequest)
+		return
+	}
+	if err := a.approve(r.Context(), zone); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "zone %q approved\n", normalizeName(zone))
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func parseApprovedZones(s string) map[string]bool {
+	zones := map[string]bool{}
+	for _, zone := range strings.Split(s, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			zones[normalizeName(zone)] = true
+		}
+	}
+	return zones
+}
+
+func formatApprovedZones(zones map[string]bool) string {
+	var list []string
+	for zone := range zones {
+		list = append(list, zone)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestZoneApprovals(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "cert-manager",
+		Name:        "approvals",
+		Annotations: map[string]string{approvedZonesAnnotation: "example.com, example.org"},
+	}})
+	a, err := newZoneApprovals(client, "cert-manager/approvals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := a.check(ctx, "Example.com."); err != nil {
+		t.Errorf("expected approved zone to pass, got %v", err)
+	}
+	if err := a.check(ctx, "evil.com."); err == nil {
+		t.Errorf("expected unapproved zone to be held")
+	}
+	if state, _ := a.healthCheck(); state != healthDegraded {
+		t.Errorf("expected degraded health while a zone is pending, got %v", state)
+	}
+
+	if err := a.approve(ctx, "evil.com."); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.check(ctx, "evil.com."); err != nil {
+		t.Errorf("expected zone to pass after approval, got %v", err)
+	}
+	if state, _ := a.healthCheck(); state != healthHealthy {
+		t.Errorf("expected healthy state after approval, got %v", state)
+	}
+
+	// The approval is persisted, so a restarted webhook keeps it.
+	b, _ := newZoneApprovals(client, "cert-manager/approvals")
+	if err := b.check(ctx, "evil.com."); err != nil {
+		t.Errorf("expected approval to be persisted, got %v", err)
+	}
+}
+
+func TestZoneApprovalsRevoked(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "cert-manager",
+		Name:        "approvals",
+		Annotations: map[string]string{approvedZonesAnnotation: "example.com,example.org"},
+	}})
+	a, _ := newZoneApprovals(client, "cert-manager/approvals")
+	now := time.Unix(0, 0)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+	if err := a.check(ctx, "example.com."); err != nil {
+		t.Fatalf("expected approved zone to pass, got %v", err)
+	}
+
+	cms := client.CoreV1().ConfigMaps("cert-manager")
+	cm, _ := cms.Get(ctx, "approvals", metav1.GetOptions{})
+	cm.Annotations[approvedZonesAnnotation] = "example.org"
+	if _, err := cms.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.check(ctx, "example.com."); err != nil {
+		t.Errorf("expected the approval to be served from memory for a while, got %v", err)
+	}
+	now = now.Add(approvalCacheTTL)
+	if err := a.check(ctx, "example.com."); err == nil {
+		t.Errorf("expected the revoked zone to be held")
+	}
+}
+
+// TestZoneApprovalsReadUnlocked checks that reading the ConfigMap doesn't
+// block the health check.
+func TestZoneApprovalsReadUnlocked(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	reading, release := make(chan struct{}), make(chan struct{})
+	client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		close(reading)
+		<-release
+		return false, nil, nil
+	})
+	a, _ := newZoneApprovals(client, "cert-manager/approvals")
+	done := make(chan error)
+	go func() { done <- a.check(context.Background(), "example.com.") }()
+
+	<-reading
+	checked := make(chan struct{})
+	go func() {
+		a.healthCheck()
+		close(checked)
+	}()
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the health check not to wait for the ConfigMap to be read")
+	}
+	close(release)
+	if err := <-done; err == nil {
+		t.Error("expected no zone to be approved without a ConfigMap")
+	}
+}
+
+func TestZoneApprovalsCreatesConfigMap(t *testing.T) {
+	a, _ := newZoneApprovals(fake.NewSimpleClientset(), "cert-manager/approvals")
+	ctx := context.Background()
+	if err := a.check(ctx, "example.com."); err == nil {
+		t.Errorf("expected no zone to be approved without a ConfigMap")
+	}
+	if err := a.approve(ctx, "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.check(ctx, "example.com."); err != nil {
+		t.Errorf("expected zone to pass after approval, got %v", err)
+	}
+}
+
+func TestServeApproveOnlyFromLoopback(t *testing.T) {
+	a, _ := newZoneApprovals(fake.NewSimpleClientset(), "cert-manager/approvals")
+
+	for addr, want := range map[string]int{
+		"10.0.0.5:41000":  http.StatusForbidden,
+		"127.0.0.1:41000": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/zones/approve?zone=example.com", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		a.serveApprove(rec, req)
+		if rec.Code != want {
+			t.Errorf("approval from %s: expected status %d, got %d", addr, want, rec.Code)
+		}
+	}
+}
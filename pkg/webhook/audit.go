@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// defaultAuditBufferSize is the number of operations kept in memory.
+const defaultAuditBufferSize = 100
+
+// auditLog keeps the most recent challenge operations so that they can be
+// included in the output of a crashing webhook.
+var auditLog = newAuditBuffer(defaultAuditBufferSize)
+
+// auditEntry describes one Present or CleanUp call.
+type auditEntry struct {
+	time      time.Time
+	action    string
+	namespace string
+	fqdn      string
+	zone      string
+	key       string
+	duration  time.Duration
+	outcome   string
+}
+
+func (e auditEntry) String() string {
+	return fmt.Sprintf("%s %s namespace=%s fqdn=%s zone=%s key=%s duration=%s outcome=%s",
+		e.time.UTC().Format(time.RFC3339), e.action, e.namespace, e.fqdn, e.zone, e.key, e.duration, e.outcome)
+}
+
+// auditBuffer is a bounded ring buffer of audit entries.
+type auditBuffer struct {
+	// dir is the directory the buffer is also written to on a panic, so
+	// that it survives the restart of the container. Empty to only write
+	// to stderr.
+	dir string
+
+	mu      sync.Mutex
+	entries []auditEntry
+	next    int
+	full    bool
+}
+
+func newAuditBuffer(size int) *auditBuffer {
+	if size < 0 {
+		size = 0
+	}
+	return &auditBuffer{entries: make([]auditEntry, size)}
+}
+
+// record appends e, overwriting the oldest entry once the buffer is full.
+func (a *auditBuffer) record(e auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.entries) == 0 {
+		return
+	}
+	a.entries[a.next] = e
+	a.next = (a.next + 1) % len(a.entries)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// snapshot returns the buffered entries, oldest first.
+func (a *auditBuffer) snapshot() []auditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.full {
+		return append([]auditEntry(nil), a.entries[:a.next]...)
+	}
+	return append(append([]auditEntry(nil), a.entries[a.next:]...), a.entries[:a.next]...)
+}
+
+// dump writes the buffered entries to w, oldest first.
+func (a *auditBuffer) dump(w io.Writer) {
+	entries := a.snapshot()
+	fmt.Fprintf(w, "--- last %d challenge operations ---\n", len(entries))
+	for _, e := range entries {
+		fmt.Fprintln(w, e)
+	}
+	fmt.Fprintln(w, "--- end of challenge operations ---")
+}
+
+// trace records the outcome of the operation on ch started at start, with
+// *errp being its result. It must be deferred before recoverPanic, so that
+// it runs after it and sees a panic as the error recoverPanic converted it
+// into; the buffer is then dumped.
+func (a *auditBuffer) trace(action string, ch *v1alpha1.ChallengeRequest, start time.Time, errp *error) {
+	e := auditEntry{
+		time:      start,
+		action:    action,
+		namespace: ch.ResourceNamespace,
+		fqdn:      ch.ResolvedFQDN,
+		zone:      ch.ResolvedZone,
+		key:       keyDigest(ch.Key),
+		duration:  time.Since(start),
+		outcome:   "ok",
+	}
+	var p *recoveredPanic
+	if errors.As(*errp, &p) {
+		e.outcome = fmt.Sprintf("panic: %v", p.value)
+		a.record(e)
+		a.dumpAll()
+		return
+	}
+	if *errp != nil {
+		e.outcome = fmt.Sprintf("error: %v", *errp)
+	}
+	a.record(e)
+}
+
+// dumpAuditLogOnPanic dumps auditLog if the calling goroutine is panicking.
+// It must be deferred directly. auditLog is read when it runs rather than
+// when it is deferred, as initialize replaces it.
+func dumpAuditLogOnPanic() {
+	if r := recover(); r != nil {
+		auditLog.dumpAll()
+		panic(r)
+	}
+}
+
+// dumpAll dumps the buffer to stderr and, if a.dir is set, to a file in it.
+func (a *auditBuffer) dumpAll() {
+	a.dump(os.Stderr)
+	if a.dir == "" {
+		return
+	}
+	path := filepath.Join(a.dir, fmt.Sprintf("audit-%d.log", time.Now().Unix()))
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write audit trail to %s: %v\n", path, err)
+		return
+	}
+	defer f.Close()
+	a.dump(f)
+	fmt.Fprintf(os.Stderr, "audit trail written to %s\n", path)
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestAuditBuffer(t *testing.T) {
+	a := newAuditBuffer(3)
+	for _, action := range []string{"a", "b", "c", "d"} {
+		a.record(auditEntry{action: action})
+	}
+
+	var got []string
+	for _, e := range a.snapshot() {
+		got = append(got, e.action)
+	}
+	if strings.Join(got, "") != "bcd" {
+		t.Errorf("expected the three most recent entries oldest first, got %v", got)
+	}
+}
+
+func TestAuditBufferTrace(t *testing.T) {
+	a := newAuditBuffer(10)
+	ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com.", Key: "secret-key"}
+
+	func() (err error) {
+		defer a.trace("Present", ch, time.Now(), &err)
+		return errors.New("boom")
+	}()
+
+	c := &dodeDNSProviderSolver{}
+	func() (err error) {
+		defer a.trace("CleanUp", ch, time.Now(), &err)
+		defer c.recoverPanic("CleanUp", ch, &err)
+		panic("bad challenge")
+	}()
+
+	entries := a.snapshot()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].outcome != "error: boom" || entries[1].outcome != "panic: bad challenge" {
+		t.Errorf("unexpected outcomes %q, %q", entries[0].outcome, entries[1].outcome)
+	}
+
+	var buf bytes.Buffer
+	a.dump(&buf)
+	if !strings.Contains(buf.String(), "fqdn=_acme-challenge.example.com.") {
+		t.Errorf("expected dump to contain the challenge name, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "secret-key") || !strings.Contains(buf.String(), "key="+keyDigest("secret-key")) {
+		t.Errorf("expected dump to contain the digest of the key only, got %q", buf.String())
+	}
+}
+
+func TestDumpAuditLogOnPanic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(a *auditBuffer) { auditLog = a }(auditLog)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to be passed on, got %v", r)
+			}
+		}()
+		defer dumpAuditLogOnPanic()
+		// Replaced after the defer, like initialize does.
+		auditLog = newAuditBuffer(1)
+		auditLog.dir = dir
+		auditLog.record(auditEntry{action: "Present", fqdn: "_acme-challenge.example.com."})
+		panic("boom")
+	}()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("expected the replaced buffer to be dumped to its directory, got %v", files)
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(b), "fqdn=_acme-challenge.example.com.") {
+		t.Errorf("expected the entries of the replaced buffer, got %q", b)
+	}
+}
+
+func TestAuditBufferDumpsToWritableDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if got := probeWritableDir(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("expected a missing directory to be reported as not writable, got %q", got)
+	}
+	a := newAuditBuffer(1)
+	a.dir = probeWritableDir(dir)
+	a.record(auditEntry{action: "Present", fqdn: "_acme-challenge.example.com."})
+	a.dumpAll()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("expected one audit trail file, got %v", files)
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(b), "fqdn=_acme-challenge.example.com.") {
+		t.Errorf("unexpected audit trail %q", b)
+	}
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// defaultZoneBackoffBase is the backoff applied after the first failure
+	// of a zone. Every further consecutive failure doubles it.
+	defaultZoneBackoffBase = 15 * time.Second
+	// defaultZoneBackoffMax caps the per-zone backoff.
+	defaultZoneBackoffMax = 30 * time.Minute
+	// zoneFailureWarnStreak is the streak length after which every further
+	// failure is logged as a warning rather than at verbose level.
+	zoneFailureWarnStreak = 3
+)
+
+// zoneBackoff remembers the failure streak of every zone and refuses to call
+// the DODE API for a zone until its backoff has elapsed. This keeps a single
+// broken tenant (e.g. a revoked token) from consuming the retry budget shared
+// with every other zone served by the webhook.
+type zoneBackoff struct {
+	base time.Duration
+	max  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	zones map[string]*zoneFailure
+}
+
+// zoneFailure is the failure state tracked for a single zone.
+type zoneFailure struct {
+	streak  int
+	until   time.Time
+	lastErr string
+}
+
+func newZoneBackoff(base, max time.Duration) *zoneBackoff {
+	return &zoneBackoff{
+		base:  base,
+		max:   max,
+		now:   time.Now,
+		zones: map[string]*zoneFailure{},
+	}
+}
+
+// check returns an error if zone is still backing off from earlier failures.
+func (b *zoneBackoff) check(zone string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.zones[zone]
+	if !ok {
+		return nil
+	}
+	remaining := f.until.Sub(b.now())
+	if remaining <= 0 {
+		return nil
+	}
+	zoneBackoffRejections.WithLabelValues(zone).Inc()
+	return fmt.Errorf("zone %q is backing off for another %s after %d consecutive failures, last error: %s",
+		zone, remaining.Round(time.Second), f.streak, f.lastErr)
+}
+
+// observe records the outcome of a DODE API call made for zone.
+func (b *zoneBackoff) observe(zone string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if f, ok := b.zones[zone]; ok {
+			klog.Infof("zone %q recovered after %d consecutive failures", zone, f.streak)
+			delete(b.zones, zone)
+		}
+		zoneFailureStreak.WithLabelValues(zone).Set(0)
+		return
+	}
+
+	f, ok := b.zones[zone]
+	if !ok {
+		f = &zoneFailure{}
+		b.zones[zone] = f
+	}
+	f.streak++
+	f.lastErr = err.Error()
+	delay := b.delay(f.streak)
+	f.until = b.now().Add(delay)
+	zoneFailureStreak.WithLabelValues(zone).Set(float64(f.streak))
+
+	if f.streak >= zoneFailureWarnStreak {
+		klog.Warningf("zone %q has failed %d times in a row, backing off for %s: %v", zone, f.streak, delay, err)
+	} else {
+		klog.V(4).Infof("zone %q failed (streak %d), backing off for %s: %v", zone, f.streak, delay, err)
+	}
+}
+
+// healthCheck reports the webhook as degraded while any zone is backing off.
+func (b *zoneBackoff) healthCheck() (healthState, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var zones []string
+	now := b.now()
+	for zone, f := range b.zones {
+		if f.until.After(now) {
+			zones = append(zones, fmt.Sprintf("%s (%d failures)", zone, f.streak))
+		}
+	}
+	if len(zones) == 0 {
+		return healthHealthy, ""
+	}
+	sort.Strings(zones)
+	return healthDegraded, "zones backing off: " + strings.Join(zones, ", ")
+}
+
+// zoneFailureState is the failure state of a zone as persisted by a
+// backoffStore.
+type zoneFailureState struct {
+	Streak    int       `json:"streak"`
+	Until     time.Time `json:"until"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// snapshot returns the failure state of every zone.
+func (b *zoneBackoff) snapshot() map[string]zoneFailureState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make(map[string]zoneFailureState, len(b.zones))
+	for zone, f := range b.zones {
+		states[zone] = zoneFailureState{Streak: f.streak, Until: f.until, LastError: f.lastErr}
+	}
+	return states
+}
+
+// restore takes over the failure state of zones that have none yet, e.g.
+// that of a previous run of the webhook, so that zones known to be broken
+// keep backing off.
+func (b *zoneBackoff) restore(states map[string]zoneFailureState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for zone, s := range states {
+		if _, ok := b.zones[zone]; ok || s.Streak <= 0 {
+			continue
+		}
+		b.zones[zone] = &zoneFailure{streak: s.Streak, until: s.Until, lastErr: s.LastError}
+		zoneFailureStreak.WithLabelValues(zone).Set(float64(s.Streak))
+	}
+}
+
+// delay returns the backoff for the given failure streak.
+func (b *zoneBackoff) delay(streak int) time.Duration {
+	d := b.base
+	for i := 1; i < streak; i++ {
+		d *= 2
+		if d >= b.max {
+			return b.max
+		}
+	}
+	return d
+}
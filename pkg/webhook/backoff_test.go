@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestZoneBackoff(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newZoneBackoff(10*time.Second, 35*time.Second)
+	b.now = func() time.Time { return now }
+
+	if err := b.check("example.com"); err != nil {
+		t.Fatalf("unexpected error for unknown zone: %v", err)
+	}
+
+	// Failures double the backoff up to the configured maximum.
+	for i, want := range []time.Duration{10 * time.Second, 20 * time.Second, 35 * time.Second, 35 * time.Second} {
+		b.observe("example.com", errors.New("invalid token"))
+		if err := b.check("example.com"); err == nil {
+			t.Fatalf("failure %d: expected zone to be backing off", i+1)
+		}
+		if got := b.zones["example.com"].until.Sub(now); got != want {
+			t.Errorf("failure %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+
+	// Other zones are not affected by a broken one.
+	if err := b.check("example.org"); err != nil {
+		t.Errorf("unexpected error for unrelated zone: %v", err)
+	}
+
+	now = now.Add(35 * time.Second)
+	if err := b.check("example.com"); err != nil {
+		t.Errorf("expected backoff to have elapsed, got %v", err)
+	}
+
+	b.observe("example.com", nil)
+	if _, ok := b.zones["example.com"]; ok {
+		t.Errorf("expected success to reset the failure streak")
+	}
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// backoffStateKey is the key of the backoff ConfigMap holding the
+	// failure state of the zones as JSON.
+	backoffStateKey = "zones.json"
+	// backoffSaveInterval is how often changes of the failure state are
+	// written to the ConfigMap.
+	backoffSaveInterval = 30 * time.Second
+)
+
+// backoffStore persists the failure state of the zone backoff in a
+// ConfigMap, so that a restarted webhook doesn't call the API for zones
+// known to be broken right away. Replicas sharing the ConfigMap overwrite
+// each other's state; a zone's state is only lost until it fails again.
+type backoffStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	backoff   *zoneBackoff
+
+	// saved is the state last written, to skip writes without changes.
+	saved string
+}
+
+// newBackoffStore returns a store of backoff's state in the ConfigMap
+// namespace/name.
+func newBackoffStore(client kubernetes.Interface, ref string, backoff *zoneBackoff) (*backoffStore, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("--dode.zone-backoff-configmap must be of the form namespace/name, got %q", ref)
+	}
+	return &backoffStore{client: client, namespace: parts[0], name: parts[1], backoff: backoff}, nil
+}
+
+// load restores the state saved in the ConfigMap, if any.
+func (s *backoffStore) load(ctx context.Context) error {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read zone backoff state from ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	var states map[string]zoneFailureState
+	if err := json.Unmarshal([]byte(cm.Data[backoffStateKey]), &states); err != nil {
+		return fmt.Errorf("unable to decode zone backoff state from ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	s.backoff.restore(states)
+	s.saved = cm.Data[backoffStateKey]
+	if len(states) > 0 {
+		klog.Infof("restored the failure state of %d zones from ConfigMap %s/%s", len(states), s.namespace, s.name)
+	}
+	return nil
+}
+
+// save writes the current state to the ConfigMap unless it didn't change,
+// creating the ConfigMap if needed.
+func (s *backoffStore) save(ctx context.Context) error {
+	data, err := json.Marshal(s.backoff.snapshot())
+	if err != nil {
+		return err
+	}
+	if string(data) == s.saved {
+		return nil
+	}
+	cms := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := cms.Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name}}
+		cm.Data = map[string]string{backoffStateKey: string(data)}
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[backoffStateKey] = string(data)
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to store zone backoff state in ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	s.saved = string(data)
+	return nil
+}
+
+// run saves the state every backoffSaveInterval until stopCh is closed.
+func (s *backoffStore) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(backoffSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			if err := s.save(context.Background()); err != nil {
+				klog.Warning(err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.save(context.Background()); err != nil {
+				klog.Warning(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBackoffStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+	now := time.Now()
+
+	b := newZoneBackoff(time.Minute, time.Hour)
+	b.now = func() time.Time { return now }
+	store, err := newBackoffStore(client, "cert-manager/backoff", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.load(ctx); err != nil {
+		t.Fatalf("expected a missing ConfigMap to be no error, got %v", err)
+	}
+	b.observe("example.com", errors.New("invalid token"))
+	b.observe("example.com", errors.New("invalid token"))
+	if err := store.save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.observe("example.org", errors.New("timeout"))
+	if err := store.save(ctx); err != nil {
+		t.Fatalf("expected the existing ConfigMap to be updated, got %v", err)
+	}
+
+	// A restarted webhook keeps backing off.
+	restarted := newZoneBackoff(time.Minute, time.Hour)
+	restarted.now = func() time.Time { return now.Add(time.Minute) }
+	if err := (&backoffStore{client: client, namespace: "cert-manager", name: "backoff", backoff: restarted}).load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.check("example.com"); err == nil {
+		t.Errorf("expected the restored zone to still be backing off")
+	}
+	if err := restarted.check("example.org"); err != nil {
+		t.Errorf("expected the backoff of the restored zone to have elapsed, got %v", err)
+	}
+	if f := restarted.zones["example.com"]; f == nil || f.streak != 2 || f.lastErr != "invalid token" {
+		t.Errorf("expected the failure streak to be restored, got %+v", f)
+	}
+
+	if _, err := newBackoffStore(client, "backoff", b); err == nil {
+		t.Errorf("expected an error without namespace")
+	}
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// loadCABundle returns the system's root CAs together with the PEM encoded
+// certificates in the file at path, e.g. the CA of a TLS-inspecting egress
+// proxy.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in %s", path)
+	}
+	return roots, nil
+}
+
+// tlsTransport returns a transport like the default one, but using
+// tlsConfig and, unless nil, proxy instead of the proxy of the environment.
+// It is subject to strict egress.
+func tlsTransport(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) http.RoundTripper {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	return &egressTransport{base: &http.Transport{
+		Proxy:                 proxy,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}}
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "cabundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := loadCABundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: tlsTransport(&tls.Config{RootCAs: roots}, nil)}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the bundle's CA to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{empty, filepath.Join(dir, "missing.pem")} {
+		if _, err := loadCABundle(path); err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+}
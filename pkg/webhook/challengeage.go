@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// challengeKey identifies a challenge by its record name and value.
+type challengeKey struct {
+	fqdn, key string
+}
+
+// challengeAges remembers when the webhook was first asked to present each
+// challenge it hasn't cleaned up yet, so that challenges retried for longer
+// than maxChallengeAgeSeconds can be refused instead of using up API quota
+// for months. The ages are kept in memory and start over when the webhook
+// restarts.
+type challengeAges struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	firstSeen map[challengeKey]time.Time
+}
+
+func newChallengeAges() *challengeAges {
+	return &challengeAges{now: time.Now, firstSeen: map[challengeKey]time.Time{}}
+}
+
+// check records the first attempt to present key at fqdn and returns an
+// error if it was longer than max ago. A max of zero allows any age.
+func (a *challengeAges) check(fqdn, key string, max time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	k := challengeKey{normalizeName(fqdn), key}
+	now := a.now()
+	first, ok := a.firstSeen[k]
+	if !ok {
+		a.firstSeen[k] = now
+		return nil
+	}
+	if age := now.Sub(first); max > 0 && age > max {
+		return fmt.Errorf("challenge for %s was first presented %v ago, more than maxChallengeAgeSeconds allows (%v); giving up, delete the Challenge or Order to retry",
+			fqdn, age.Round(time.Second), max)
+	}
+	return nil
+}
+
+// forget drops key at fqdn once it was cleaned up.
+func (a *challengeAges) forget(fqdn, key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.firstSeen, challengeKey{normalizeName(fqdn), key})
+}
+
+// expireRecord deletes the record of a challenge given up on, if the webhook
+// presented it. As the ledger forgets the value once deleted, retries of the
+// challenge don't call the API again.
+func (c *dodeDNSProviderSolver) expireRecord(ctx context.Context, api dodeAPI, token, zone, domain, value string, ttl int) {
+	if !c.ledger.has(domain, value) {
+		return
+	}
+	if err := c.removeRecord(ctx, api, token, zone, domain, value, ttl); err != nil {
+		klog.Errorf("Failed to clean up TXT record of expired challenge for %s: %v", domain, err)
+	}
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChallengeAges(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := newChallengeAges()
+	a.now = func() time.Time { return now }
+	const fqdn = "_acme-challenge.example.com."
+
+	if err := a.check(fqdn, "key", time.Hour); err != nil {
+		t.Fatalf("expected the first attempt to pass, got %v", err)
+	}
+	now = now.Add(59 * time.Minute)
+	if err := a.check(fqdn, "key", time.Hour); err != nil {
+		t.Errorf("expected a retry within the limit to pass, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := a.check(fqdn, "key", time.Hour); err == nil || !strings.Contains(err.Error(), "first presented 1h1m0s ago") {
+		t.Errorf("expected an expired challenge, got %v", err)
+	}
+	if err := a.check(fqdn, "key", 0); err != nil {
+		t.Errorf("expected no limit with a max of zero, got %v", err)
+	}
+	if err := a.check(fqdn, "other-key", time.Hour); err != nil {
+		t.Errorf("expected other keys to have their own age, got %v", err)
+	}
+
+	a.forget(fqdn, "key")
+	if err := a.check(fqdn, "key", time.Hour); err != nil {
+		t.Errorf("expected a forgotten challenge to start over, got %v", err)
+	}
+}
+
+func TestExpireRecord(t *testing.T) {
+	api := newFakeDodeAPI("token")
+	defer api.Close()
+	c := newTestSolver(api)
+	ctx := context.Background()
+	const domain = "_acme-challenge.example.com"
+
+	if err := c.addRecord(ctx, c.api, "token", "example.com.", domain, "key", defaultTTL, 0); err != nil {
+		t.Fatal(err)
+	}
+	c.expireRecord(ctx, c.api, "token", "example.com.", domain, "key", defaultTTL)
+	if got := api.values(domain); len(got) != 0 {
+		t.Errorf("expected the record to be deleted, got %v", got)
+	}
+	calls := api.calls
+	c.expireRecord(ctx, c.api, "token", "example.com.", domain, "key", defaultTTL)
+	if api.calls != calls {
+		t.Errorf("expected no API call for a record deleted before")
+	}
+}
@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// PropagationChecker reports whether a TXT record with value is visible at
+// fqdn. Present waits for a quorum of the configured checkers to return
+// true before it returns.
+type PropagationChecker interface {
+	Check(ctx context.Context, fqdn, value string) (bool, error)
+}
+
+// Types of propagation checkers in the solver config.
+const (
+	checkerDoH           = "doh"
+	checkerRecursive     = "recursive"
+	checkerAuthoritative = "authoritative"
+	checkerAny           = "any"
+	checkerAll           = "all"
+)
+
+var checkerTypes = []string{checkerDoH, checkerRecursive, checkerAuthoritative, checkerAny, checkerAll}
+
+// checkerConfig configures one propagation checker.
+type checkerConfig struct {
+	// Type is one of "doh", "recursive", "authoritative", "any" or "all".
+	Type string `json:"type"`
+	// Server is the DoH server of a "doh" checker, in the format of
+	// dohServers, or the host[:port] of the resolver queried by a
+	// "recursive" checker.
+	Server string `json:"server,omitempty"`
+	// Checkers are the checkers combined by an "any" or "all" checker.
+	Checkers []checkerConfig `json:"checkers,omitempty"`
+}
+
+// build returns the checker configured by cfg.
+func (cfg *checkerConfig) build(client *http.Client, cacheBusting bool) (PropagationChecker, error) {
+	switch cfg.Type {
+	case checkerDoH:
+		r, err := newDoHResolver(cfg.Server, client)
+		if err != nil {
+			return nil, err
+		}
+		r.cacheBusting = cacheBusting
+		return resolverChecker{r}, nil
+	case checkerRecursive:
+		return resolverChecker{newDNSResolver(cfg.Server)}, nil
+	case checkerAuthoritative:
+		return &authoritativeChecker{
+			lookupNS: net.DefaultResolver.LookupNS,
+			resolver: func(server string) txtResolver { return newDNSResolver(server) },
+		}, nil
+	case checkerAny, checkerAll:
+		chain := &checkerChain{all: cfg.Type == checkerAll}
+		for i := range cfg.Checkers {
+			c, err := cfg.Checkers[i].build(client, cacheBusting)
+			if err != nil {
+				return nil, err
+			}
+			chain.checkers = append(chain.checkers, c)
+		}
+		return chain, nil
+	}
+	return nil, fmt.Errorf("unknown propagation checker type %q", cfg.Type)
+}
+
+func (cfg *checkerConfig) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch cfg.Type {
+	case checkerDoH:
+		if _, err := newDoHResolver(cfg.Server, nil); err != nil {
+			errs = append(errs, field.Invalid(path.Child("server"), cfg.Server, "must be \"google\", \"cloudflare\" or an https URL"))
+		}
+	case checkerRecursive:
+		if cfg.Server == "" {
+			errs = append(errs, field.Required(path.Child("server"), "the resolver to query is needed"))
+		}
+	case checkerAuthoritative:
+	case checkerAny, checkerAll:
+		if len(cfg.Checkers) == 0 {
+			errs = append(errs, field.Required(path.Child("checkers"), "at least one checker is needed"))
+		}
+		for i := range cfg.Checkers {
+			errs = append(errs, cfg.Checkers[i].validate(path.Child("checkers").Index(i))...)
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), cfg.Type, checkerTypes))
+	}
+	return errs
+}
+
+// resolverChecker checks propagation by looking the record up on a single
+// resolver.
+type resolverChecker struct {
+	txtResolver
+}
+
+func (c resolverChecker) Check(ctx context.Context, fqdn, value string) (bool, error) {
+	return hasTXTValue(ctx, c.txtResolver, fqdn, value)
+}
+
+// dnsResolver looks up TXT records on one DNS server over plain DNS.
+type dnsResolver struct {
+	server   string
+	resolver *net.Resolver
+}
+
+// newDNSResolver returns a resolver querying server, a host with an optional
+// port that defaults to 53.
+func newDNSResolver(server string) *dnsResolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &dnsResolver{
+		server: server,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				if err := egress.allow("dns", dnsServerHost(server)); err != nil {
+					return nil, err
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		},
+	}
+}
+
+func (r *dnsResolver) String() string {
+	return "dns://" + r.server
+}
+
+// lookupTXT returns the values of all TXT records at fqdn. A name that does
+// not exist yields no values rather than an error.
+func (r *dnsResolver) lookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	values, err := r.resolver.LookupTXT(ctx, fqdn)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return values, err
+}
+
+// authoritativeChecker checks propagation on every nameserver of the zone
+// containing the record, found through the system resolver. This sees the
+// record as soon as the provider published it, without waiting for caches
+// to expire.
+type authoritativeChecker struct {
+	lookupNS func(ctx context.Context, name string) ([]*net.NS, error)
+	resolver func(server string) txtResolver
+}
+
+func (c *authoritativeChecker) String() string {
+	return "authoritative"
+}
+
+func (c *authoritativeChecker) Check(ctx context.Context, fqdn, value string) (bool, error) {
+	nameservers, err := c.nameservers(ctx, fqdn)
+	if err != nil {
+		return false, err
+	}
+	for _, ns := range nameservers {
+		ok, err := hasTXTValue(ctx, c.resolver(ns), fqdn, value)
+		if err != nil {
+			return false, fmt.Errorf("querying %s: %v", ns, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nameservers returns the nameservers of the closest enclosing zone of fqdn
+// that has NS records.
+func (c *authoritativeChecker) nameservers(ctx context.Context, fqdn string) ([]string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := range labels {
+		name := strings.Join(labels[i:], ".") + "."
+		records, err := c.lookupNS(ctx, name)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		var hosts []string
+		for _, ns := range records {
+			hosts = append(hosts, ns.Host)
+		}
+		return hosts, nil
+	}
+	return nil, fmt.Errorf("no nameservers found for %q", fqdn)
+}
+
+// checkerChain combines checkers: with all set every one of them must see
+// the record, otherwise any one of them is enough.
+type checkerChain struct {
+	all      bool
+	checkers []PropagationChecker
+}
+
+func (c *checkerChain) String() string {
+	names := make([]string, len(c.checkers))
+	for i, checker := range c.checkers {
+		names[i] = fmt.Sprint(checker)
+	}
+	op := checkerAny
+	if c.all {
+		op = checkerAll
+	}
+	return op + "(" + strings.Join(names, ", ") + ")"
+}
+
+func (c *checkerChain) Check(ctx context.Context, fqdn, value string) (bool, error) {
+	var firstErr error
+	for _, checker := range c.checkers {
+		ok, err := checker.Check(ctx, fqdn, value)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ok && !c.all {
+			return true, nil
+		}
+		if !ok && c.all {
+			return false, err
+		}
+	}
+	if c.all {
+		return true, nil
+	}
+	return false, firstErr
+}
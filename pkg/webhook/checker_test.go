@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestCheckerChain(t *testing.T) {
+	seen := resolverChecker{&staticResolver{name: "seen", values: []string{"key"}}}
+	missing := resolverChecker{&staticResolver{name: "missing"}}
+	failing := resolverChecker{&staticResolver{name: "failing", err: errors.New("timeout")}}
+
+	tests := []struct {
+		chain   *checkerChain
+		want    bool
+		wantErr bool
+	}{
+		{chain: &checkerChain{checkers: []PropagationChecker{missing, seen}}, want: true},
+		{chain: &checkerChain{checkers: []PropagationChecker{missing, failing}}, wantErr: true},
+		{chain: &checkerChain{all: true, checkers: []PropagationChecker{seen, seen}}, want: true},
+		{chain: &checkerChain{all: true, checkers: []PropagationChecker{seen, missing}}},
+		{chain: &checkerChain{all: true, checkers: []PropagationChecker{seen, failing}}, wantErr: true},
+	}
+	for _, test := range tests {
+		ok, err := test.chain.Check(context.Background(), "_acme-challenge.example.com.", "key")
+		if ok != test.want || (err != nil) != test.wantErr {
+			t.Errorf("%v: got %v, %v", test.chain, ok, err)
+		}
+	}
+}
+
+func TestAuthoritativeChecker(t *testing.T) {
+	zones := map[string][]*net.NS{
+		"example.com.": {{Host: "ns1.example.net."}, {Host: "ns2.example.net."}},
+	}
+	answers := map[string][]string{
+		"ns1.example.net.": {"key"},
+	}
+	c := &authoritativeChecker{
+		lookupNS: func(ctx context.Context, name string) ([]*net.NS, error) {
+			if ns, ok := zones[name]; ok {
+				return ns, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		},
+		resolver: func(server string) txtResolver {
+			return &staticResolver{name: server, values: answers[server]}
+		},
+	}
+
+	if ok, err := c.Check(context.Background(), "_acme-challenge.www.example.com.", "key"); ok || err != nil {
+		t.Errorf("expected the record to be missing on ns2, got %v, %v", ok, err)
+	}
+	answers["ns2.example.net."] = []string{"other", "key"}
+	if ok, err := c.Check(context.Background(), "_acme-challenge.www.example.com.", "key"); !ok || err != nil {
+		t.Errorf("expected the record to be visible, got %v, %v", ok, err)
+	}
+	if _, err := c.Check(context.Background(), "_acme-challenge.example.org.", "key"); err == nil {
+		t.Error("expected an error for a name without nameservers")
+	}
+}
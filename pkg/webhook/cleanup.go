@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// delayedCleanups holds the record deletions scheduled by CleanUp when a
+// cleanup delay is configured. Some ACME servers look at the record again
+// shortly after the authorization succeeded, so deleting it right away can
+// fail an otherwise valid order.
+//
+// Scheduled deletions only live in memory: if the webhook restarts before
+// they run, the records are left behind.
+type delayedCleanups struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newDelayedCleanups() *delayedCleanups {
+	return &delayedCleanups{timers: map[string]*time.Timer{}}
+}
+
+func delayedCleanupKey(domain, value string) string {
+	return domain + " " + value
+}
+
+// schedule runs f after delay unless the deletion of value at domain is
+// cancelled in the meantime. Scheduling an already pending deletion again
+// restarts its delay.
+func (d *delayedCleanups) schedule(domain, value string, delay time.Duration, f func()) {
+	key := delayedCleanupKey(domain, value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.timers[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		if d.timers[key] != t {
+			// Cancelled or rescheduled after the timer fired.
+			d.mu.Unlock()
+			return
+		}
+		delete(d.timers, key)
+		d.mu.Unlock()
+		f()
+	})
+	d.timers[key] = t
+}
+
+// cancel drops a pending deletion of value at domain and reports whether there
+// was one.
+func (d *delayedCleanups) cancel(domain, value string) bool {
+	key := delayedCleanupKey(domain, value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, ok := d.timers[key]
+	if !ok {
+		return false
+	}
+	t.Stop()
+	delete(d.timers, key)
+	return true
+}
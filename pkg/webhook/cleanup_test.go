@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayedCleanups(t *testing.T) {
+	d := newDelayedCleanups()
+
+	done := make(chan string, 2)
+	d.schedule("_acme-challenge.example.com", "a", 10*time.Millisecond, func() { done <- "a" })
+	d.schedule("_acme-challenge.example.com", "b", 10*time.Millisecond, func() { done <- "b" })
+
+	if !d.cancel("_acme-challenge.example.com", "b") {
+		t.Errorf("expected pending cleanup of b to be cancelled")
+	}
+	if d.cancel("_acme-challenge.example.com", "c") {
+		t.Errorf("unexpected pending cleanup of c")
+	}
+
+	select {
+	case v := <-done:
+		if v != "a" {
+			t.Errorf("expected cleanup of a to run, got %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("cleanup of a didn't run")
+	}
+
+	select {
+	case v := <-done:
+		t.Errorf("unexpected cleanup of %s", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	acmewebhook "github.com/jetstack/cert-manager/pkg/acme/webhook"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/cmd/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/klog"
+)
+
+// essentialFlags are the flags of the serving library that --help shows
+// without --advanced-flags.
+var essentialFlags = []string{
+	"secure-port",
+	"tls-cert-file",
+	"tls-private-key-file",
+	"kubeconfig",
+	"v",
+	"help",
+	"advanced-flags",
+}
+
+// runWebhookServer does what cmd.RunWebhookServer of the serving library
+// does, but keeps hold of the command to trim its help output.
+func runWebhookServer(groupName string, solvers ...acmewebhook.Solver) {
+	if err := NewRunnable(groupName, os.Args[1:], solvers...).Start(genericapiserver.SetupSignalHandler()); err != nil {
+		klog.Fatal(err)
+	}
+}
+
+// Runnable serves the solvers' API with the serving library until stopped.
+// Its methods are those of manager.Runnable and LeaderElectionRunnable of
+// controller-runtime, so that an operator can serve the webhook from its
+// own manager rather than running another Deployment.
+type Runnable struct {
+	groupName string
+	args      []string
+	solvers   []acmewebhook.Solver
+}
+
+// NewRunnable returns a Runnable serving solvers, e.g. that of NewSolver,
+// under groupName. args are the command line of the serving library and the
+// webhook's own flags, including the TLS certificate to serve.
+func NewRunnable(groupName string, args []string, solvers ...acmewebhook.Solver) *Runnable {
+	return &Runnable{groupName: groupName, args: args, solvers: solvers}
+}
+
+// Start serves the API until stopCh is closed.
+func (r *Runnable) Start(stopCh <-chan struct{}) error {
+	registerSolvers(r.solvers)
+	// The command is built like NewCommandStartWebhookServer of the serving
+	// library does, which keeps its options to itself, so that the server
+	// can be started with instrumented handlers.
+	o := server.NewWebhookServerOptions(os.Stdout, os.Stderr, r.groupName, r.solvers...)
+	cmd := &cobra.Command{
+		Short: "Launch an ACME solver API server",
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := applyClientAuthFlags(c.Flags()); err != nil {
+				return err
+			}
+			return serveWebhook(o, stopCh)
+		},
+	}
+	o.RecommendedOptions.AddFlags(cmd.Flags())
+	cmd.Flags().AddGoFlagSet(flag.CommandLine)
+	flag.CommandLine.Parse([]string{})
+	setupHelp(cmd)
+	cmd.SetArgs(r.args)
+	return cmd.Execute()
+}
+
+// serveWebhook does what RunWebhookServer of the options does, but wraps the
+// handler chain with instrumentHandlers.
+func serveWebhook(o *server.WebhookServerOptions, stopCh <-chan struct{}) error {
+	config, err := o.Config()
+	if err != nil {
+		return err
+	}
+	config.GenericConfig.BuildHandlerChainFunc = instrumentHandlers(o.SolverGroup, config.GenericConfig.BuildHandlerChainFunc)
+	s, err := config.Complete().New()
+	if err != nil {
+		return err
+	}
+	return s.GenericAPIServer.PrepareRun().Run(stopCh)
+}
+
+// NeedLeaderElection reports that every replica of an operator's manager
+// serves the webhook, as cert-manager may call any of them.
+func (r *Runnable) NeedLeaderElection() bool {
+	return false
+}
+
+// AddFunc adds a Runnable to a manager. For a controller-runtime manager,
+// pass
+//
+//	func(r *webhook.Runnable) error { return mgr.Add(r) }
+//
+// which keeps controller-runtime out of the dependencies of this module.
+type AddFunc func(r *Runnable) error
+
+// RegisterWithManager adds a Runnable serving the do.de solver, followed by
+// solvers of other providers, under groupName to a manager with add. args
+// are passed to NewRunnable.
+func RegisterWithManager(add AddFunc, groupName string, args []string, solvers ...acmewebhook.Solver) error {
+	if groupName == "" {
+		return fmt.Errorf("a group name is needed to serve the webhook")
+	}
+	return add(NewRunnable(groupName, args, append([]acmewebhook.Solver{NewSolver()}, solvers...)...))
+}
+
+// setupHelp deprecates the flag names from before namespacing and makes
+// --help only list the webhook's own flags and the essential ones of the
+// serving library, unless --advanced-flags is given as well.
+func setupHelp(cmd *cobra.Command) {
+	fs := cmd.Flags()
+	for _, name := range legacyFlags {
+		fs.MarkDeprecated(name, fmt.Sprintf("use --%s%s instead", flagPrefix, name))
+	}
+	advanced := fs.Bool("advanced-flags", false, "Show all flags, including those of the serving library and of logging, in --help.")
+
+	cmd.Long = fmt.Sprintf("ACME DNS01 solver for do.de. Flags of the solver start with --%s; "+
+		"run with --help --advanced-flags to list the flags of the serving library and of logging as well.", flagPrefix)
+	help := cmd.HelpFunc()
+	cmd.SetHelpFunc(func(c *cobra.Command, args []string) {
+		if !*advanced {
+			hideAdvancedFlags(c.Flags())
+		}
+		help(c, args)
+	})
+}
+
+// hideAdvancedFlags hides all flags but the webhook's own and the essential
+// ones.
+func hideAdvancedFlags(fs *pflag.FlagSet) {
+	fs.VisitAll(func(f *pflag.Flag) {
+		if !strings.HasPrefix(f.Name, flagPrefix) && !containsString(essentialFlags, f.Name) {
+			f.Hidden = true
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSetupHelp(t *testing.T) {
+	cmd := &cobra.Command{Use: "webhook"}
+	cmd.Flags().Bool("dode.fleet-mode", false, "")
+	cmd.Flags().Bool("fleet-mode", false, "")
+	cmd.Flags().Bool("tls-cert-file", false, "")
+	cmd.Flags().Bool("log-flush-frequency", false, "")
+	legacy := legacyFlags
+	legacyFlags = []string{"fleet-mode"}
+	defer func() { legacyFlags = legacy }()
+	setupHelp(cmd)
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.HelpFunc()(cmd, nil)
+	help := out.String()
+	for _, want := range []string{"dode.fleet-mode", "tls-cert-file", "advanced-flags"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("expected --help to list %s, got\n%s", want, help)
+		}
+	}
+	for _, hidden := range []string{"log-flush-frequency", "--fleet-mode"} {
+		if strings.Contains(help, hidden) {
+			t.Errorf("expected --help to hide %s, got\n%s", hidden, help)
+		}
+	}
+	if cmd.Flags().Lookup("fleet-mode").Deprecated == "" {
+		t.Errorf("expected the legacy flag name to be deprecated")
+	}
+}
+
+func TestRegisterWithManager(t *testing.T) {
+	var added []*Runnable
+	add := func(r *Runnable) error {
+		added = append(added, r)
+		return nil
+	}
+	other := otherSolver{name: "rfc2136"}
+	if err := RegisterWithManager(add, "acme.example.com", []string{"--secure-port=8443"}, other); err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 {
+		t.Fatalf("expected a single runnable to be added, got %d", len(added))
+	}
+	r := added[0]
+	if r.groupName != "acme.example.com" || len(r.args) != 1 || r.NeedLeaderElection() {
+		t.Errorf("unexpected runnable %+v", r)
+	}
+	if len(r.solvers) != 2 || r.solvers[0].Name() != solverName || r.solvers[1].Name() != "rfc2136" {
+		t.Errorf("expected the do.de solver followed by the other provider's, got %v", r.solvers)
+	}
+
+	if err := RegisterWithManager(add, "", nil); err == nil {
+		t.Errorf("expected an error without a group name")
+	}
+}
+
+func TestRunnableStartChecksFlags(t *testing.T) {
+	defer flag.Set(flagPrefix+"pin-client-ca", "false")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	r := NewRunnable("acme.example.com", []string{"--" + flagPrefix + "pin-client-ca"}, otherSolver{name: "rfc2136"})
+	err := r.Start(stopCh)
+	if err == nil || !strings.Contains(err.Error(), "needs --"+flagPrefix+"client-ca-file") {
+		t.Errorf("expected the client authentication flags to be checked before serving, got %v", err)
+	}
+	if rep := currentSolverReport(); len(rep.Solvers) != 1 || rep.Solvers[0].Name != "rfc2136" {
+		t.Errorf("expected the runnable's solvers in the solver report, got %+v", rep)
+	}
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// clientAuthFlag is a flag of the serving library's delegated authentication
+// set from the webhook's client authentication flags.
+type clientAuthFlag struct {
+	name, value string
+}
+
+// clientAuthFlags returns the flags of the serving library that make it
+// verify the client certificates the Kubernetes API server presents when
+// proxying requests to the webhook against --dode.client-ca-file, accepting
+// only --dode.allowed-client-names if set. --dode.pin-client-ca also
+// keeps the library from trusting the CA published in the
+// extension-apiserver-authentication ConfigMap instead. It only pins the CA:
+// requests authenticated otherwise, e.g. with a bearer token, are still
+// accepted.
+func clientAuthFlags(caFile, allowedNames string, pin bool) ([]clientAuthFlag, error) {
+	if caFile == "" {
+		if pin {
+			return nil, fmt.Errorf("--%spin-client-ca needs --%sclient-ca-file", flagPrefix, flagPrefix)
+		}
+		if allowedNames != "" {
+			return nil, fmt.Errorf("--%sallowed-client-names needs --%sclient-ca-file", flagPrefix, flagPrefix)
+		}
+		return nil, nil
+	}
+	if _, err := loadCABundle(caFile); err != nil {
+		return nil, fmt.Errorf("--%sclient-ca-file: %v", flagPrefix, err)
+	}
+	flags := []clientAuthFlag{{"requestheader-client-ca-file", caFile}}
+	var names []string
+	for _, n := range strings.Split(allowedNames, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) > 0 {
+		flags = append(flags, clientAuthFlag{"requestheader-allowed-names", strings.Join(names, ",")})
+	}
+	if pin {
+		flags = append(flags, clientAuthFlag{"authentication-skip-lookup", "true"})
+	}
+	return flags, nil
+}
+
+// applyClientAuthFlags sets the flags of clientAuthFlags on fs. They may not
+// be given on the command line as well, so that the webhook's flags can't be
+// silently overridden or override a deliberate setting.
+func applyClientAuthFlags(fs *pflag.FlagSet) error {
+	flags, err := clientAuthFlags(*clientCAFile, *allowedClientNames, *pinClientCA)
+	if err != nil {
+		return err
+	}
+	for _, f := range flags {
+		if fs.Changed(f.name) {
+			return fmt.Errorf("--%s may not be combined with the client authentication flags of the webhook", f.name)
+		}
+		if err := fs.Set(f.name, f.value); err != nil {
+			return fmt.Errorf("setting --%s: %v", f.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestClientAuthFlags(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "clientauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "front-proxy-ca.crt")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := clientAuthFlags(ca, "front-proxy-client, aggregator", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []clientAuthFlag{
+		{"requestheader-client-ca-file", ca},
+		{"requestheader-allowed-names", "front-proxy-client,aggregator"},
+		{"authentication-skip-lookup", "true"},
+	}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("expected %v, got %v", want, flags)
+	}
+	if flags, err := clientAuthFlags("", "", false); err != nil || flags != nil {
+		t.Errorf("expected no flags by default, got %v, %v", flags, err)
+	}
+	for _, tc := range []struct {
+		caFile, names string
+		require       bool
+	}{
+		{"", "", true},
+		{"", "front-proxy-client", false},
+		{filepath.Join(dir, "missing.crt"), "", false},
+	} {
+		if _, err := clientAuthFlags(tc.caFile, tc.names, tc.require); err == nil {
+			t.Errorf("expected an error for %+v", tc)
+		}
+	}
+}
+
+func TestApplyClientAuthFlags(t *testing.T) {
+	newFlagSet := func() *pflag.FlagSet {
+		fs := pflag.NewFlagSet("webhook", pflag.ContinueOnError)
+		fs.String("requestheader-client-ca-file", "", "")
+		fs.StringSlice("requestheader-allowed-names", nil, "")
+		fs.Bool("authentication-skip-lookup", false, "")
+		return fs
+	}
+	dir, err := ioutil.TempDir("", "clientauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ca := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(caFile, names string, require bool) {
+		*clientCAFile, *allowedClientNames, *pinClientCA = caFile, names, require
+	}(*clientCAFile, *allowedClientNames, *pinClientCA)
+	*clientCAFile, *allowedClientNames, *pinClientCA = ca, "front-proxy-client", true
+
+	fs := newFlagSet()
+	if err := applyClientAuthFlags(fs); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := fs.GetStringSlice("requestheader-allowed-names"); !reflect.DeepEqual(names, []string{"front-proxy-client"}) {
+		t.Errorf("unexpected allowed names %q", names)
+	}
+	if skip, _ := fs.GetBool("authentication-skip-lookup"); !skip {
+		t.Error("expected the ConfigMap lookup to be skipped")
+	}
+
+	fs = newFlagSet()
+	if err := fs.Parse([]string{"--requestheader-client-ca-file=/other.crt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyClientAuthFlags(fs); err == nil {
+		t.Error("expected an error for a library flag given as well")
+	}
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes of the subcommands of the webhook binary, such as report, so
+// that scripts and pipelines can branch on the kind of failure without
+// parsing messages. They are part of the interface of the binary: never
+// renumber them, only add new ones.
+const (
+	exitOK = 0
+	// exitFailure is any failure not covered by the codes below.
+	exitFailure = 1
+	// exitValidation means invalid flags, arguments or solver configs.
+	exitValidation = 2
+	// exitAuth means credentials were missing or rejected, by the DODE API
+	// or by Kubernetes.
+	exitAuth = 3
+	// exitNetwork means an endpoint couldn't be reached, timed out or
+	// answered with a server error.
+	exitNetwork = 4
+	// exitPropagation means records didn't become visible in time.
+	exitPropagation = 5
+)
+
+// failureCategories name the exit codes in the last line subcommands print
+// to stderr when failing.
+var failureCategories = map[int]string{
+	exitFailure:     "failure",
+	exitValidation:  "validation",
+	exitAuth:        "auth",
+	exitNetwork:     "network",
+	exitPropagation: "propagation",
+}
+
+// exitCode returns the exit code for err, based on its error class and on
+// the errors it wraps.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	switch errorClass(err) {
+	case errorClassConfig:
+		return exitValidation
+	case errorClassCredentials:
+		return exitAuth
+	case errorClassPropagation:
+		return exitPropagation
+	}
+	if dode.IsAuthError(err) || apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+		return exitAuth
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	var apiErr *dode.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError {
+		return exitNetwork
+	}
+	if apierrors.IsServiceUnavailable(err) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) {
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// executeSubcommand runs cmd with args and returns the exit code, printing
+// the error and its failure category to stderr if it failed.
+func executeSubcommand(cmd *cobra.Command, args []string, stderr io.Writer) int {
+	cmd.SetArgs(args)
+	cmd.SilenceErrors = true
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return classify(errorClassConfig, err)
+	})
+	err := cmd.Execute()
+	code := exitCode(err)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fmt.Fprintf(stderr, "failure category: %s (exit code %d)\n", failureCategories[code], code)
+	}
+	return code
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("something"), exitFailure},
+		{classify(errorClassConfig, errors.New("--zone is required")), exitValidation},
+		{classify(errorClassCredentials, errors.New("no token")), exitAuth},
+		{classify(errorClassProvider, fmt.Errorf("presenting: %w", &dode.Error{StatusCode: http.StatusOK, Message: "invalid token"})), exitAuth},
+		{fmt.Errorf("listing Challenges: %w", apierrors.NewForbidden(schema.GroupResource{Resource: "challenges"}, "", nil)), exitAuth},
+		{fmt.Errorf("looking up: %w", &net.DNSError{Err: "timeout", IsTimeout: true}), exitNetwork},
+		{&dode.Error{StatusCode: http.StatusBadGateway}, exitNetwork},
+		{&dode.Error{StatusCode: http.StatusBadRequest}, exitFailure},
+		{classify(errorClassPropagation, errors.New("not visible")), exitPropagation},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestExecuteSubcommand(t *testing.T) {
+	cmd := &cobra.Command{
+		Use: "test",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return classify(errorClassConfig, errors.New("--zone is required"))
+		},
+	}
+	var stderr bytes.Buffer
+	if code := executeSubcommand(cmd, nil, &stderr); code != exitValidation {
+		t.Errorf("expected exit code %d, got %d", exitValidation, code)
+	}
+	if !strings.HasSuffix(stderr.String(), "failure category: validation (exit code 2)\n") {
+		t.Errorf("unexpected output %q", stderr.String())
+	}
+}
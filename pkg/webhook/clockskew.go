@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// maxClockSkew is how far the system clock may be off the clock of the DODE
+// API before a warning is logged.
+const maxClockSkew = 30 * time.Second
+
+// The backoff of zones, the TTL of the record cache and the ages in the
+// record ledger only ever compare readings of time.Now, which carry the
+// monotonic clock, so stepping the system clock doesn't affect them. The
+// wall clock still matters where times come from elsewhere, such as the
+// expiry of minted tokens, and to the TTLs of records as seen by resolvers
+// and the CA, so a badly skewed clock is reported at startup.
+
+// checkClockSkew compares the system clock with the Date header of the API at
+// baseURL, warns if they differ by more than maxClockSkew and exports the
+// difference in dode_webhook_clock_skew_seconds.
+func checkClockSkew(client *http.Client, baseURL string) {
+	skew, err := measureClockSkew(client, baseURL, time.Now)
+	if err != nil {
+		klog.V(2).Infof("could not compare the system clock with the DODE API: %v", err)
+		return
+	}
+	clockSkew.Set(skew.Seconds())
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		klog.Warningf("system clock is %v off the clock of the DODE API at %s; the expiry of tokens and record TTLs may be misjudged, check the node's time synchronization",
+			skew.Round(time.Second), baseURL)
+	}
+}
+
+// measureClockSkew returns how far now is ahead of the Date header of a HEAD
+// request to baseURL. As the header has a precision of a second, the result
+// is only accurate to about that.
+func measureClockSkew(client *http.Client, baseURL string, now func() time.Time) (time.Duration, error) {
+	start := now()
+	resp, err := client.Head(baseURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	end := now()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q", resp.Header.Get("Date"))
+	}
+	return start.Add(end.Sub(start) / 2).Sub(date), nil
+}
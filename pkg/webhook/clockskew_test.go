@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeasureClockSkew(t *testing.T) {
+	server := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", server.Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	local := server.Add(2 * time.Minute)
+	skew, err := measureClockSkew(srv.Client(), srv.URL, func() time.Time { return local })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew != 2*time.Minute {
+		t.Errorf("expected a skew of 2m, got %v", skew)
+	}
+
+	noDate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = nil
+	}))
+	defer noDate.Close()
+	if _, err := measureClockSkew(noDate.Client(), noDate.URL, time.Now); err == nil {
+		t.Errorf("expected an error without Date header")
+	}
+}
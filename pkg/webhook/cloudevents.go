@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// CloudEvents types emitted for finished challenge operations.
+const (
+	cloudEventPresented = "de.do.acme.challenge.presented"
+	cloudEventCleaned   = "de.do.acme.challenge.cleaned"
+	cloudEventFailed    = "de.do.acme.challenge.failed"
+)
+
+// cloudEventsSink posts an event for every finished challenge operation to
+// an HTTP endpoint in CloudEvents binary mode, e.g. a Knative broker or an
+// Argo Events webhook source.
+type cloudEventsSink struct {
+	url    string
+	client *http.Client
+}
+
+func newCloudEventsSink(sink string) (*cloudEventsSink, error) {
+	u, err := url.Parse(sink)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("--dode.cloudevents-sink must be an http or https URL, got %q", sink)
+	}
+	return &cloudEventsSink{
+		url:    sink,
+		client: egressClient(10 * time.Second),
+	}, nil
+}
+
+// cloudEventData is the payload of the events.
+type cloudEventData struct {
+	Action        string  `json:"action"`
+	Namespace     string  `json:"namespace"`
+	FQDN          string  `json:"fqdn"`
+	Zone          string  `json:"zone"`
+	Attempts      int32   `json:"attempts"`
+	MaxAPILatency float64 `json:"maxAPILatencySeconds"`
+	Duration      float64 `json:"durationSeconds"`
+	Outcome       string  `json:"outcome"`
+	ErrorClass    string  `json:"errorClass,omitempty"`
+	Error         string  `json:"error,omitempty"`
+	TraceID       string  `json:"traceId,omitempty"`
+}
+
+// publish sends an event for r in the background. It does nothing if s is
+// nil, and must be deferred before r is finished.
+func (s *cloudEventsSink) publish(r *ChallengeResult) {
+	if s == nil {
+		return
+	}
+	eventType := cloudEventFailed
+	switch {
+	case r.Outcome != "success":
+	case r.Action == "Present":
+		eventType = cloudEventPresented
+	default:
+		eventType = cloudEventCleaned
+	}
+	data := cloudEventData{
+		Action:        r.Action,
+		Namespace:     r.Namespace,
+		FQDN:          r.FQDN,
+		Zone:          r.Zone,
+		Attempts:      r.Attempts,
+		MaxAPILatency: r.maxAPILatency().Seconds(),
+		Duration:      r.Duration.Seconds(),
+		Outcome:       r.Outcome,
+		ErrorClass:    r.ErrorClass,
+		Error:         r.Error,
+		TraceID:       r.TraceID,
+	}
+	go func() {
+		if err := s.send(eventType, r.FQDN, data); err != nil {
+			klog.Errorf("Failed to send %s CloudEvent for %s: %v", eventType, r.FQDN, err)
+		}
+	}()
+}
+
+func (s *cloudEventsSink) send(eventType, subject string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-id", hex.EncodeToString(id))
+	req.Header.Set("ce-type", eventType)
+	req.Header.Set("ce-source", eventComponent)
+	req.Header.Set("ce-subject", subject)
+	req.Header.Set("ce-time", time.Now().UTC().Format(time.RFC3339Nano))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sink returned %s", resp.Status)
+	}
+	return nil
+}
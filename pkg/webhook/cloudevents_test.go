@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloudEventsSink(t *testing.T) {
+	type received struct {
+		header http.Header
+		data   cloudEventData
+	}
+	events := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e received
+		e.header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&e.data); err != nil {
+			t.Errorf("decoding event data: %v", err)
+		}
+		events <- e
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s, err := newCloudEventsSink(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.publish(&ChallengeResult{
+		Action:     "CleanUp",
+		FQDN:       "_acme-challenge.example.com.",
+		Outcome:    "error",
+		ErrorClass: errorClassProvider,
+		Duration:   1500 * time.Millisecond,
+	})
+
+	select {
+	case e := <-events:
+		if got := e.header.Get("ce-type"); got != cloudEventFailed {
+			t.Errorf("expected type %q, got %q", cloudEventFailed, got)
+		}
+		if e.header.Get("ce-specversion") != "1.0" || e.header.Get("ce-id") == "" || e.header.Get("ce-source") != eventComponent {
+			t.Errorf("missing CloudEvents attributes in %v", e.header)
+		}
+		if e.header.Get("ce-subject") != "_acme-challenge.example.com." {
+			t.Errorf("unexpected subject %q", e.header.Get("ce-subject"))
+		}
+		if e.data.ErrorClass != errorClassProvider || e.data.Duration != 1.5 {
+			t.Errorf("unexpected event data %+v", e.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+
+	if _, err := newCloudEventsSink("ftp://example.com"); err == nil {
+		t.Errorf("expected non-HTTP sink to be rejected")
+	}
+	var nilSink *cloudEventsSink
+	nilSink.publish(&ChallengeResult{})
+}
@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog"
+)
+
+// loadConfig is a small helper function that decodes JSON configuration on
+// top of the webhook-wide defaults, the JSON of a configDefaults or nil, into
+// the typed config struct, fills in defaults and validates the result. All
+// validation problems are reported at once, so that an Issuer can be fixed
+// in a single iteration.
+func loadConfig(cfgJSON *extapi.JSON, defaults []byte) (dodeDNSProviderConfig, error) {
+	cfg, err := decodeConfig(cfgJSON, defaults)
+	if err != nil {
+		return cfg, err
+	}
+	setConfigDefaults(&cfg)
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate returns an error listing every problem found in cfg, such as
+// "invalid solver config: [apiTokenSecretRef.name: Required value: needed
+// when a secret key is configured, ttl: Invalid value: 30: must be between
+// 60 and 86400]", or nil if there is none. Defaults must have been filled
+// in. Present and CleanUp only call the API with valid configs.
+func (cfg *dodeDNSProviderConfig) Validate() error {
+	if errs := validateConfig(cfg); len(errs) > 0 {
+		return fmt.Errorf("invalid solver config: %v", errs.ToAggregate())
+	}
+	return nil
+}
+
+// decodeConfig decodes cfgJSON on top of the webhook-wide defaults, if any.
+func decodeConfig(cfgJSON *extapi.JSON, defaults []byte) (dodeDNSProviderConfig, error) {
+	cfg := dodeDNSProviderConfig{}
+	if defaults != nil {
+		// The defaults were validated when they were read.
+		if err := json.Unmarshal(defaults, &cfg); err != nil {
+			return cfg, fmt.Errorf("error decoding solver config defaults: %v", err)
+		}
+	}
+	// handle the 'base case' where no configuration has been provided
+	if cfgJSON == nil {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("error decoding solver config: %v", err)
+	}
+	if unknown := unknownConfigFields(cfgJSON.Raw); len(unknown) > 0 {
+		if *strictConfig {
+			return cfg, fmt.Errorf("unknown fields in solver config: %s", strings.Join(unknown, ", "))
+		}
+		klog.Warningf("ignoring unknown fields in solver config: %s", strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
+
+// setConfigDefaults fills in the optional fields of cfg that have defaults.
+func setConfigDefaults(cfg *dodeDNSProviderConfig) {
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+	if p := cfg.Propagation; p != nil {
+		if p.TimeoutSeconds == 0 {
+			p.TimeoutSeconds = int(defaultPropagationTimeout / time.Second)
+		}
+		if p.PollIntervalSeconds == 0 {
+			p.PollIntervalSeconds = int(defaultPropagationPollInterval / time.Second)
+		}
+		if p.PollBackoffFactor == 0 {
+			p.PollBackoffFactor = 1
+		}
+		if p.Quorum == 0 && !p.Nameservers {
+			p.Quorum = p.numCheckers()
+		}
+	}
+}
+
+// validateConfig returns every problem found in cfg.
+func validateConfig(cfg *dodeDNSProviderConfig) field.ErrorList {
+	var errs field.ErrorList
+
+	ref := field.NewPath("apiTokenSecretRef")
+	if cfg.APITokenSecretRef.Name == "" && (cfg.APITokenSecretRef.Key != "" || (len(cfg.APITokenSecretKeys) > 0 && len(cfg.APITokenSecretRefs) == 0 && len(cfg.ZoneTokens) == 0)) {
+		errs = append(errs, field.Required(ref.Child("name"), "needed when a secret key is configured"))
+	}
+	if cfg.APITokenSecretRef.Namespace != "" {
+		if cfg.APITokenSecretRef.Name == "" {
+			errs = append(errs, field.Required(ref.Child("name"), "needed when a secret namespace is configured"))
+		}
+		if cfg.WorkloadCluster != nil {
+			errs = append(errs, field.Forbidden(ref.Child("namespace"), "may not be combined with workloadCluster, use workloadCluster.secretNamespace"))
+		}
+	}
+	if len(cfg.APITokenSecretRefs) > 0 {
+		refs := field.NewPath("apiTokenSecretRefs")
+		if cfg.APITokenSecretRef.Name != "" {
+			errs = append(errs, field.Forbidden(refs, "may not be combined with apiTokenSecretRef"))
+		}
+		if cfg.TokenProvider != "" {
+			errs = append(errs, field.Forbidden(refs, "may not be combined with tokenProvider"))
+		}
+		for i, r := range cfg.APITokenSecretRefs {
+			if r.Name == "" {
+				errs = append(errs, field.Required(refs.Index(i).Child("name"), ""))
+			}
+		}
+	}
+	if len(cfg.ZoneTokens) > 0 {
+		path := field.NewPath("zoneTokens")
+		if cfg.TokenProvider != "" {
+			errs = append(errs, field.Forbidden(path, "may not be combined with tokenProvider"))
+		}
+		if cfg.APITokenFile != "" {
+			errs = append(errs, field.Forbidden(path, "may not be combined with apiTokenFile"))
+		}
+		for _, zone := range zoneTokenZones(cfg) {
+			ref := cfg.ZoneTokens[zone]
+			if normalizeName(zone) == "" {
+				errs = append(errs, field.Invalid(path, zone, "zones must not be empty"))
+			}
+			if ref.Name == "" {
+				errs = append(errs, field.Required(path.Key(zone).Child("name"), ""))
+			}
+		}
+	}
+	if cfg.TokenProvider != "" && cfg.APITokenSecretRef.Name != "" {
+		errs = append(errs, field.Forbidden(field.NewPath("tokenProvider"), "may not be combined with apiTokenSecretRef"))
+	}
+	if cfg.TokenProvider != "" && cfg.WorkloadCluster != nil {
+		errs = append(errs, field.Forbidden(field.NewPath("tokenProvider"), "may not be combined with workloadCluster"))
+	}
+	if cfg.APITokenFile != "" {
+		path := field.NewPath("apiTokenFile")
+		if cfg.APITokenSecretRef.Name != "" {
+			errs = append(errs, field.Forbidden(path, "may not be combined with apiTokenSecretRef"))
+		}
+		if cfg.TokenProvider != "" {
+			errs = append(errs, field.Forbidden(path, "may not be combined with tokenProvider"))
+		}
+		if len(cfg.APITokenSecretRefs) > 0 {
+			errs = append(errs, field.Forbidden(path, "may not be combined with apiTokenSecretRefs"))
+		}
+		if cfg.WorkloadCluster != nil {
+			errs = append(errs, field.Forbidden(path, "may not be combined with workloadCluster"))
+		}
+	}
+	if ref := cfg.APITokenVaultRef; ref != nil {
+		path := field.NewPath("apiTokenVaultRef")
+		if ref.Address == "" {
+			errs = append(errs, field.Required(path.Child("address"), ""))
+		} else if err := validateAPIURL(ref.Address); err != nil {
+			errs = append(errs, field.Invalid(path.Child("address"), ref.Address, "must be an https URL"))
+		}
+		if strings.Trim(ref.Path, "/") == "" {
+			errs = append(errs, field.Required(path.Child("path"), ""))
+		}
+		switch ref.authMethod() {
+		case vaultAuthKubernetes:
+			if ref.Role == "" {
+				errs = append(errs, field.Required(path.Child("role"), "needed by the kubernetes auth method"))
+			}
+		case vaultAuthToken:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("authMethod"), ref.AuthMethod, []string{vaultAuthKubernetes, vaultAuthToken}))
+		}
+		for _, other := range []struct {
+			name string
+			set  bool
+		}{
+			{"apiTokenSecretRef", cfg.APITokenSecretRef.Name != ""},
+			{"apiTokenSecretRefs", len(cfg.APITokenSecretRefs) > 0},
+			{"zoneTokens", len(cfg.ZoneTokens) > 0},
+			{"tokenProvider", cfg.TokenProvider != ""},
+			{"apiTokenFile", cfg.APITokenFile != ""},
+			{"workloadCluster", cfg.WorkloadCluster != nil},
+		} {
+			if other.set {
+				errs = append(errs, field.Forbidden(path, "may not be combined with "+other.name))
+			}
+		}
+	}
+	if cfg.UsernameSecretRef.Name != "" || cfg.PasswordSecretRef.Name != "" {
+		path := field.NewPath("usernameSecretRef")
+		if cfg.UsernameSecretRef.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), "needed with passwordSecretRef"))
+		}
+		if cfg.PasswordSecretRef.Name == "" {
+			errs = append(errs, field.Required(field.NewPath("passwordSecretRef", "name"), "needed with usernameSecretRef"))
+		}
+		for _, other := range []struct {
+			name string
+			set  bool
+		}{
+			{"apiTokenSecretRef", cfg.APITokenSecretRef.Name != ""},
+			{"apiTokenSecretRefs", len(cfg.APITokenSecretRefs) > 0},
+			{"zoneTokens", len(cfg.ZoneTokens) > 0},
+			{"tokenProvider", cfg.TokenProvider != ""},
+			{"apiTokenFile", cfg.APITokenFile != ""},
+			{"apiTokenVaultRef", cfg.APITokenVaultRef != nil},
+			{"workloadCluster", cfg.WorkloadCluster != nil},
+		} {
+			if other.set {
+				errs = append(errs, field.Forbidden(path, "may not be combined with "+other.name))
+			}
+		}
+	}
+	for i, key := range cfg.APITokenSecretKeys {
+		if key == "" {
+			errs = append(errs, field.Invalid(field.NewPath("apiTokenSecretKeys").Index(i), key, "must not be empty"))
+		}
+	}
+
+	if p := cfg.Propagation; p != nil {
+		path := field.NewPath("propagation")
+		if p.numCheckers() == 0 && !p.Nameservers {
+			errs = append(errs, field.Required(path.Child("dohServers"), "at least one server or checker is needed to check propagation"))
+		}
+		for i, s := range p.DoHServers {
+			if _, err := newDoHResolver(s, nil); err != nil {
+				errs = append(errs, field.Invalid(path.Child("dohServers").Index(i), s, "must be \"google\", \"cloudflare\" or an https URL"))
+			}
+		}
+		for i := range p.Checkers {
+			errs = append(errs, p.Checkers[i].validate(path.Child("checkers").Index(i))...)
+		}
+		errs = append(errs, validateNonNegative(path.Child("timeoutSeconds"), p.TimeoutSeconds)...)
+		errs = append(errs, validateNonNegative(path.Child("pollIntervalSeconds"), p.PollIntervalSeconds)...)
+		errs = append(errs, validateNonNegative(path.Child("maxPollIntervalSeconds"), p.MaxPollIntervalSeconds)...)
+		if p.PollBackoffFactor < 1 {
+			errs = append(errs, field.Invalid(path.Child("pollBackoffFactor"), p.PollBackoffFactor, "must be at least 1"))
+		}
+		if p.Quorum < 0 || (p.Quorum > p.numCheckers() && !p.Nameservers) {
+			errs = append(errs, field.Invalid(path.Child("quorum"), p.Quorum,
+				fmt.Sprintf("must be between 1 and the number of dohServers and checkers (%d)", p.numCheckers())))
+		}
+	}
+
+	if cfg.WorkloadCluster != nil && cfg.WorkloadCluster.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("workloadCluster", "name"), ""))
+	}
+	for i, z := range cfg.Zones {
+		if normalizeName(z) == "" {
+			errs = append(errs, field.Invalid(field.NewPath("zones").Index(i), z, "must not be empty"))
+		}
+	}
+	if alias := normalizeName(cfg.ChallengeAliasDomain); cfg.ChallengeAliasDomain != "" {
+		path := field.NewPath("challengeAliasDomain")
+		if alias == "" || strings.Contains(alias, "*") {
+			errs = append(errs, field.Invalid(path, cfg.ChallengeAliasDomain, "must be a domain name"))
+		} else if alias == acmeChallengeLabel || strings.HasPrefix(alias, acmeChallengeLabel+".") {
+			errs = append(errs, field.Invalid(path, cfg.ChallengeAliasDomain, "must be the domain without the _acme-challenge label, which is added to it"))
+		}
+	}
+	for i, t := range cfg.ValueTransforms {
+		if _, err := parseValueTransform(t); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("valueTransforms").Index(i), t, err.Error()))
+		}
+	}
+	if cfg.DomainStrategy != "" && !containsString(domainStrategies, cfg.DomainStrategy) {
+		errs = append(errs, field.NotSupported(field.NewPath("domainStrategy"), cfg.DomainStrategy, domainStrategies))
+	}
+	errs = append(errs, validateNonNegative(field.NewPath("cleanupDelaySeconds"), cfg.CleanupDelaySeconds)...)
+	errs = append(errs, validateNonNegative(field.NewPath("propagationDelaySeconds"), cfg.PropagationDelaySeconds)...)
+	errs = append(errs, validateNonNegative(field.NewPath("maxRecordsPerName"), cfg.MaxRecordsPerName)...)
+	errs = append(errs, validateNonNegative(field.NewPath("maxChallengeAgeSeconds"), cfg.MaxChallengeAgeSeconds)...)
+	errs = append(errs, validateNonNegative(field.NewPath("watchdogIntervalSeconds"), cfg.WatchdogIntervalSeconds)...)
+	if cfg.APIURL != "" {
+		if err := validateAPIURL(cfg.APIURL); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("apiUrl"), cfg.APIURL, "must be an https URL"))
+		}
+	}
+	errs = append(errs, validateNonNegative(field.NewPath("requestTimeoutSeconds"), cfg.RequestTimeoutSeconds)...)
+	if cfg.ProxyURL != "" {
+		if err := validateProxyURL(cfg.ProxyURL); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("proxyUrl"), cfg.ProxyURL, "must be an http or https URL"))
+		}
+	}
+	errs = append(errs, validateNonNegative(field.NewPath("maxRetries"), cfg.MaxRetries)...)
+	errs = append(errs, validateNonNegative(field.NewPath("initialBackoffSeconds"), cfg.InitialBackoffSeconds)...)
+	errs = append(errs, validateNonNegative(field.NewPath("maxBackoffSeconds"), cfg.MaxBackoffSeconds)...)
+	if cfg.MaxBackoffSeconds > 0 && cfg.InitialBackoffSeconds > cfg.MaxBackoffSeconds {
+		errs = append(errs, field.Invalid(field.NewPath("initialBackoffSeconds"), cfg.InitialBackoffSeconds, "must not exceed maxBackoffSeconds"))
+	}
+	if cfg.TTL < minTTL || cfg.TTL > maxTTL {
+		errs = append(errs, field.Invalid(field.NewPath("ttl"), cfg.TTL, fmt.Sprintf("must be between %d and %d", minTTL, maxTTL)))
+	}
+	return errs
+}
+
+func validateNonNegative(path *field.Path, v int) field.ErrorList {
+	if v < 0 {
+		return field.ErrorList{field.Invalid(path, v, "must not be negative")}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"apiTokenSecretRef":{"name":"dode"},"propagation":{"dohServers":["google","cloudflare"]}}`)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Propagation
+	if p.TimeoutSeconds != 120 || p.PollIntervalSeconds != 5 || p.PollBackoffFactor != 1 || p.Quorum != 2 {
+		t.Errorf("unexpected defaults %+v", p)
+	}
+	if cfg.TTL != defaultTTL {
+		t.Errorf("expected default TTL %d, got %d", defaultTTL, cfg.TTL)
+	}
+
+	if cfg, err := loadConfig(nil, nil); err != nil || cfg.Propagation != nil {
+		t.Errorf("expected empty config without error, got %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadConfigReportsAllProblems(t *testing.T) {
+	_, err := loadConfig(&extapi.JSON{Raw: []byte(`{
+		"apiTokenSecretRef": {"key": "token", "namespace": "central"},
+		"propagation": {"dohServers": ["google", "http://insecure"], "quorum": 5, "pollBackoffFactor": 0.5,
+			"checkers": [{"type": "any"}, {"type": "dig"}]},
+		"workloadCluster": {},
+		"cleanupDelaySeconds": -1,
+		"propagationDelaySeconds": -1,
+		"ttl": 30,
+		"apiUrl": "http://proxy.example.com/api",
+		"tokenProvider": "broker",
+		"apiTokenFile": "dode/token",
+		"zoneTokens": {"example.com": {"key": "token"}},
+		"requestTimeoutSeconds": -5,
+		"proxyUrl": "socks5://proxy.example.com",
+		"zones": ["example.com", "."],
+		"maxRetries": -1,
+		"challengeAliasDomain": "_acme-challenge.validation.example.net",
+		"apiTokenVaultRef": {"address": "http://vault.example.com", "authMethod": "approle"},
+		"passwordSecretRef": {"name": "dode-login"},
+		"valueTransforms": ["{{.Value | truncate 8}}", "{{.Value"]
+	}`)}, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"apiTokenSecretRef.name: Required value",
+		"apiTokenSecretRef.namespace: Forbidden",
+		"propagation.dohServers[1]",
+		"propagation.checkers[0].checkers: Required value",
+		"propagation.checkers[1].type: Unsupported value",
+		"propagation.quorum",
+		"propagation.pollBackoffFactor",
+		"workloadCluster.name: Required value",
+		"cleanupDelaySeconds",
+		"propagationDelaySeconds",
+		"ttl: Invalid value: 30",
+		"apiUrl: Invalid value",
+		"requestTimeoutSeconds",
+		"proxyUrl: Invalid value",
+		"zones[1]: Invalid value",
+		"maxRetries",
+		"challengeAliasDomain: Invalid value",
+		"tokenProvider: Forbidden: may not be combined with workloadCluster",
+		"apiTokenFile: Forbidden: may not be combined with tokenProvider",
+		"zoneTokens[example.com].name: Required value",
+		"apiTokenVaultRef.address: Invalid value",
+		"apiTokenVaultRef.path: Required value",
+		"apiTokenVaultRef.authMethod: Unsupported value",
+		"apiTokenVaultRef: Forbidden: may not be combined with apiTokenFile",
+		"usernameSecretRef.name: Required value",
+		"usernameSecretRef: Forbidden: may not be combined with apiTokenVaultRef",
+		"valueTransforms[1]: Invalid value",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := dodeDNSProviderConfig{TTL: defaultTTL}
+	cfg.APITokenSecretRef.Name = "dode"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+	cfg.APITokenSecretRef.Name = ""
+	cfg.APITokenSecretRef.Key = "token"
+	cfg.TTL = 30
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "apiTokenSecretRef.name: Required value") || !strings.Contains(err.Error(), "ttl: Invalid value: 30") {
+		t.Errorf("expected both problems to be reported, got %v", err)
+	}
+}
+
+func TestLoadConfigDecodeError(t *testing.T) {
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"maxRecordsPerName":"many"}`)}, nil); err == nil || !strings.Contains(err.Error(), "decoding") {
+		t.Errorf("expected decoding error, got %v", err)
+	}
+}
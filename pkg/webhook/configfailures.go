@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// defaultConfigFailureTTL is how long a challenge failing with an invalid
+// config or unusable credentials makes further attempts at the same name
+// and zone fail right away.
+const defaultConfigFailureTTL = time.Minute
+
+// configFailures remembers the challenges that recently failed because of
+// their config or credentials, such as a missing Secret, and fails further
+// attempts at them with the same error until it expires. cert-manager
+// retries such challenges with every resync, and each attempt would read
+// the Secret again, waiting for it to be created for several seconds.
+type configFailures struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]configFailure
+}
+
+// configFailure is the error a config failed with.
+type configFailure struct {
+	err    error
+	expiry time.Time
+}
+
+func newConfigFailures(ttl time.Duration) *configFailures {
+	return &configFailures{ttl: ttl, now: time.Now, failures: map[string]configFailure{}}
+}
+
+// permanentFailure reports whether err repeats until the config, its Secrets
+// or its token are changed: an invalid config, a Secret that is missing or
+// may not be read, a Secret without the key of the token, or a token the
+// DODE API rejected. Failures that may go away by themselves, such as an
+// unavailable API server, Vault or token provider, are retried right away.
+func permanentFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return false
+	}
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		// Every Secret of apiTokenSecretRefs failed.
+		for _, err := range agg.Errors() {
+			if !permanentFailure(err) {
+				return false
+			}
+		}
+		return true
+	}
+	if dode.IsAuthError(err) {
+		return true
+	}
+	switch errorClass(err) {
+	case errorClassConfig:
+		return true
+	case errorClassCredentials:
+		var missing *missingKeyError
+		if errors.As(err, &missing) {
+			return true
+		}
+		var status apierrors.APIStatus
+		if errors.As(err, &status) && !apiServerUnavailable(err) {
+			return apierrors.IsNotFound(err) || apierrors.IsForbidden(err)
+		}
+	}
+	return false
+}
+
+// configFailureKey identifies the issuer of ch by its solver config and the
+// namespace the config's Secrets are read from, together with the name and
+// zone of ch: some config and credentials errors, such as a name outside the
+// config's zones or a zone without a token in zoneTokens, only concern some
+// of the issuer's challenges and must not fail the others.
+func configFailureKey(ch *v1alpha1.ChallengeRequest) string {
+	h := sha256.New()
+	for _, s := range []string{ch.ResourceNamespace, ch.DNSName, ch.ResolvedFQDN, ch.ResolvedZone} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	if ch.Config != nil {
+		h.Write(ch.Config.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// check returns the error the config of key recently failed with, if any.
+func (f *configFailures) check(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	failure, ok := f.failures[key]
+	if !ok {
+		return nil
+	}
+	remaining := failure.expiry.Sub(f.now())
+	if remaining <= 0 {
+		delete(f.failures, key)
+		return nil
+	}
+	return classify(errorClass(failure.err), fmt.Errorf("%v (failed recently, not retried for another %s)",
+		failure.err, remaining.Round(time.Second)))
+}
+
+// observe remembers err if it repeats until the config, its Secrets or its
+// token are changed, see permanentFailure.
+func (f *configFailures) observe(key string, err error) {
+	if !permanentFailure(err) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	for k, failure := range f.failures {
+		if !failure.expiry.After(now) {
+			delete(f.failures, k)
+		}
+	}
+	if _, ok := f.failures[key]; ok {
+		return
+	}
+	f.failures[key] = configFailure{err: err, expiry: now.Add(f.ttl)}
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestConfigFailures(t *testing.T) {
+	f := newConfigFailures(time.Minute)
+	now := time.Unix(0, 0)
+	f.now = func() time.Time { return now }
+	cfg := &extapi.JSON{Raw: []byte(`{"apiTokenSecretRef":{"name":"missing"}}`)}
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "team-a", DNSName: "example.com", ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com.", Config: cfg}
+	key := configFailureKey(ch)
+
+	f.observe(key, classify(errorClassProvider, errors.New("rate limited")))
+	if err := f.check(key); err != nil {
+		t.Errorf("expected provider errors not to be cached, got %v", err)
+	}
+
+	f.observe(key, classify(errorClassCredentials, fmt.Errorf("unable to get secret `missing`; %w", apierrors.NewNotFound(corev1.Resource("secrets"), "missing"))))
+	err := f.check(key)
+	if err == nil || !strings.Contains(err.Error(), `secrets "missing" not found`) || errorClass(err) != errorClassCredentials {
+		t.Errorf("expected the cached credentials error, got %v", err)
+	}
+	other := *ch
+	other.ResourceNamespace = "team-b"
+	if err := f.check(configFailureKey(&other)); err != nil {
+		t.Errorf("expected the config of another namespace not to fail, got %v", err)
+	}
+
+	// Failing with the cached error doesn't extend it.
+	now = now.Add(30 * time.Second)
+	f.observe(key, f.check(key))
+	now = now.Add(30 * time.Second)
+	if err := f.check(key); err != nil {
+		t.Errorf("expected the failure to expire, got %v", err)
+	}
+}
+
+func TestPermanentFailure(t *testing.T) {
+	secrets := corev1.Resource("secrets")
+	for _, test := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid config", classify(errorClassConfig, errors.New("apiTokenSecretRef.name: Required value")), true},
+		{"missing secret", classify(errorClassCredentials, fmt.Errorf("unable to get secret `dode`; %w", apierrors.NewNotFound(secrets, "dode"))), true},
+		{"forbidden secret", classify(errorClassCredentials, fmt.Errorf("unable to get secret `dode`; %w", apierrors.NewForbidden(secrets, "dode", errors.New("denied")))), true},
+		{"missing key", classify(errorClassCredentials, missingKey("key %q not found in secret %q", "api-token", "dode")), true},
+		{"all rotated secrets missing", classify(errorClassCredentials, utilerrors.NewAggregate([]error{
+			fmt.Errorf("apiTokenSecretRefs[0]: %w", apierrors.NewNotFound(secrets, "old")),
+			fmt.Errorf("apiTokenSecretRefs[1]: %w", missingKey("key %q not found", "api-token")),
+		})), true},
+		{"token rejected", classify(errorClassProvider, &dode.Error{StatusCode: http.StatusUnauthorized}), true},
+
+		{"API server timeout", classify(errorClassCredentials, fmt.Errorf("unable to get secret `dode`; %w", apierrors.NewServerTimeout(secrets, "get", 1))), false},
+		{"API server unreachable", classify(errorClassCredentials, fmt.Errorf("unable to get secret `dode`; %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})), false},
+		{"Vault unreachable", classify(errorClassCredentials, &url.Error{Op: "Post", URL: "https://vault.example.com", Err: errors.New("timeout")}), false},
+		{"token provider failing", classify(errorClassCredentials, errors.New("token provider returned status 503")), false},
+		{"one rotated secret unavailable", classify(errorClassCredentials, utilerrors.NewAggregate([]error{
+			fmt.Errorf("apiTokenSecretRefs[0]: %w", apierrors.NewNotFound(secrets, "old")),
+			fmt.Errorf("apiTokenSecretRefs[1]: %w", apierrors.NewTooManyRequests("slow down", 1)),
+		})), false},
+		{"provider rate limit", classify(errorClassProvider, &dode.Error{StatusCode: http.StatusTooManyRequests}), false},
+	} {
+		if got := permanentFailure(test.err); got != test.want {
+			t.Errorf("%s: expected %v, got %v for %v", test.name, test.want, got, test.err)
+		}
+	}
+}
+
+// TestConfigFailuresPerZone covers a challenge failing because it was routed
+// to the wrong solver config: other zones of the same issuer must still be
+// tried.
+func TestConfigFailuresPerZone(t *testing.T) {
+	f := newConfigFailures(time.Minute)
+	cfg := &extapi.JSON{Raw: []byte(`{"apiTokenSecretRef":{"name":"dode"},"zones":["example.com"]}`)}
+	wrong := &v1alpha1.ChallengeRequest{ResourceNamespace: "team-a", DNSName: "example.org", ResolvedFQDN: "_acme-challenge.example.org.", ResolvedZone: "example.org.", Config: cfg}
+	right := &v1alpha1.ChallengeRequest{ResourceNamespace: "team-a", DNSName: "example.com", ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com.", Config: cfg}
+
+	f.observe(configFailureKey(wrong), classify(errorClassConfig, errors.New(`"example.org" is outside the zones of the solver config`)))
+	if err := f.check(configFailureKey(wrong)); err == nil {
+		t.Errorf("expected the mis-routed challenge to fail right away")
+	}
+	if err := f.check(configFailureKey(right)); err != nil {
+		t.Errorf("expected another zone of the issuer to be tried, got %v", err)
+	}
+}
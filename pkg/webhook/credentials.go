@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// credentialSummaryInterval is how often the credential summary is logged.
+const credentialSummaryInterval = time.Hour
+
+// credentialStats tracks how every API token the webhook has been configured
+// with is doing. Its summary, logged periodically, answers "is it fine?" for
+// teams that don't scrape metrics.
+type credentialStats struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	creds map[string]*credentialUse
+}
+
+// credentialUse is the state tracked for a single credential.
+type credentialUse struct {
+	lastSuccess time.Time
+	failures    int
+	zones       map[string]bool
+}
+
+func newCredentialStats() *credentialStats {
+	return &credentialStats{
+		now:   time.Now,
+		creds: map[string]*credentialUse{},
+	}
+}
+
+// credentialName describes the credential cfg refers to for a challenge in
+// namespace without revealing it.
+func credentialName(cfg *dodeDNSProviderConfig, namespace string) string {
+	if cfg.TokenProvider != "" {
+		return fmt.Sprintf("token provider %s for %s", cfg.TokenProvider, namespace)
+	}
+	if cfg.APITokenFile != "" {
+		return "token file " + cfg.APITokenFile
+	}
+	if cfg.UsernameSecretRef.Name != "" {
+		ns := namespace
+		if cfg.UsernameSecretRef.Namespace != "" {
+			ns = cfg.UsernameSecretRef.Namespace
+		}
+		return fmt.Sprintf("username from secret %s/%s", ns, cfg.UsernameSecretRef.Name)
+	}
+	if cfg.APITokenVaultRef != nil {
+		return fmt.Sprintf("Vault secret %s at %s", cfg.APITokenVaultRef.Path, normalizeVaultAddress(cfg.APITokenVaultRef.Address))
+	}
+	if len(cfg.APITokenSecretRefs) > 0 {
+		names := make([]string, len(cfg.APITokenSecretRefs))
+		for i, ref := range cfg.APITokenSecretRefs {
+			names[i] = credentialName(secretRefConfig(cfg, ref), namespace)
+		}
+		return strings.Join(names, " or ")
+	}
+	if cfg.APITokenSecretRef.Name == "" {
+		return "ambient token"
+	}
+	if cfg.APITokenSecretRef.Namespace != "" {
+		namespace = cfg.APITokenSecretRef.Namespace
+	}
+	var cluster string
+	if cfg.WorkloadCluster != nil {
+		cluster = fmt.Sprintf("cluster %s ", cfg.WorkloadCluster.Name)
+		if cfg.WorkloadCluster.SecretNamespace != "" {
+			namespace = cfg.WorkloadCluster.SecretNamespace
+		}
+	}
+	return fmt.Sprintf("%ssecret %s/%s[%s]", cluster, namespace, cfg.APITokenSecretRef.Name, strings.Join(apiTokenSecretKeys(cfg), "|"))
+}
+
+// observe records the outcome of using cred for zone. Operations rejected
+// before calling the API don't count.
+func (s *credentialStats) observe(cred, zone string, err error) {
+	if errorClass(err) == errorClassBackoff {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.creds[cred]
+	if !ok {
+		u = &credentialUse{zones: map[string]bool{}}
+		s.creds[cred] = u
+	}
+	u.zones[normalizeName(zone)] = true
+	if err != nil {
+		u.failures++
+		return
+	}
+	u.failures = 0
+	u.lastSuccess = s.now()
+}
+
+// summary returns one line per credential, sorted by credential, and whether
+// any credential is failing.
+func (s *credentialStats) summary() (lines []string, failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cred, u := range s.creds {
+		if u.failures > 0 {
+			failing = true
+		}
+		lastSuccess := "never"
+		if !u.lastSuccess.IsZero() {
+			lastSuccess = fmt.Sprintf("%s ago", s.now().Sub(u.lastSuccess).Round(time.Second))
+		}
+		var zones []string
+		for zone := range u.zones {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+		lines = append(lines, fmt.Sprintf("%s: last success %s, %d consecutive failures, zones %s",
+			cred, lastSuccess, u.failures, strings.Join(zones, ",")))
+	}
+	sort.Strings(lines)
+	return lines, failing
+}
+
+// zones returns the zones of all credentials, sorted.
+func (s *credentialStats) zones() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	var zones []string
+	for _, u := range s.creds {
+		for zone := range u.zones {
+			if !seen[zone] {
+				seen[zone] = true
+				zones = append(zones, zone)
+			}
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// logSummary logs the summary, as a warning if any credential is failing.
+func (s *credentialStats) logSummary() {
+	lines, failing := s.summary()
+	if len(lines) == 0 {
+		klog.Infof("credential summary: no credentials used yet")
+		return
+	}
+	for _, line := range lines {
+		if failing {
+			klog.Warningf("credential summary: %s", line)
+		} else {
+			klog.Infof("credential summary: %s", line)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCredentialStatsSummary(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newCredentialStats()
+	s.now = func() time.Time { return now }
+
+	s.observe("secret a/dode[token]", "example.com.", nil)
+	s.observe("secret a/dode[token]", "example.org.", nil)
+	now = now.Add(time.Hour)
+	s.observe("secret b/dode[token]", "example.net.", errors.New("invalid token"))
+	s.observe("secret b/dode[token]", "example.net.", errors.New("invalid token"))
+	s.observe("secret b/dode[token]", "example.net.", classify(errorClassBackoff, errors.New("backing off")))
+
+	lines, failing := s.summary()
+	want := []string{
+		"secret a/dode[token]: last success 1h0m0s ago, 0 consecutive failures, zones example.com,example.org",
+		"secret b/dode[token]: last success never, 2 consecutive failures, zones example.net",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected summary\n%q\ngot\n%q", want, lines)
+	}
+	if !failing {
+		t.Errorf("expected summary to report a failing credential")
+	}
+}
+
+func TestCredentialName(t *testing.T) {
+	cfg := &dodeDNSProviderConfig{}
+	if got := credentialName(cfg, "default"); got != "ambient token" {
+		t.Errorf("unexpected ambient credential name %q", got)
+	}
+	cfg.APITokenSecretRef.Name, cfg.APITokenSecretRef.Key = "dode", "token"
+	cfg.WorkloadCluster = &workloadClusterRef{Name: "tenant-a", SecretNamespace: "cert-manager"}
+	if got, want := credentialName(cfg, "default"), "cluster tenant-a secret cert-manager/dode[token]"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// configEnvVars are the environment variables the webhook reads its
+// configuration from.
+var configEnvVars = []string{
+	"GROUP_NAME",
+	legoEnvToken,
+	legoEnvHTTPTimeout,
+	legoEnvPollingInterval,
+	legoEnvPropagationTimeout,
+}
+
+// redacted replaces sensitive values in the runtime config dump.
+const redacted = "<redacted>"
+
+// runtimeConfig is the effective configuration of the webhook, as served on
+// /debug/config.
+type runtimeConfig struct {
+	GroupName string            `json:"groupName"`
+	Flags     map[string]string `json:"flags"`
+	Env       map[string]string `json:"env"`
+	// SolverDefaults are the solver config defaults in use, read from
+	// --dode.defaults-configmap. They can't hold credentials.
+	SolverDefaults json.RawMessage `json:"solverDefaults,omitempty"`
+}
+
+// currentRuntimeConfig collects the effective configuration from the command
+// line flags, environment and solver config defaults, with sensitive values
+// redacted.
+func currentRuntimeConfig(fs *flag.FlagSet, defaults *configDefaults) runtimeConfig {
+	rc := runtimeConfig{
+		GroupName:      GroupName,
+		Flags:          map[string]string{},
+		Env:            map[string]string{},
+		SolverDefaults: defaults.get(),
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if containsString(legacyFlags, f.Name) {
+			return
+		}
+		rc.Flags[f.Name] = redactIfSensitive(f.Name, f.Value.String())
+	})
+	for _, name := range configEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			rc.Env[name] = redactIfSensitive(name, v)
+		}
+	}
+	return rc
+}
+
+// redactIfSensitive returns value, or a placeholder if name suggests that it
+// holds a credential rather than a reference to one.
+func redactIfSensitive(name, value string) string {
+	n := strings.ToLower(name)
+	if value == "" || strings.HasSuffix(n, "file") || strings.HasSuffix(n, "secret") {
+		return value
+	}
+	for _, s := range []string{"token", "password", "credential", "dsn"} {
+		if strings.Contains(n, s) {
+			return redacted
+		}
+	}
+	return value
+}
+
+// serveRuntimeConfig serves the effective configuration as JSON.
+func (c *dodeDNSProviderSolver) serveRuntimeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(currentRuntimeConfig(flag.CommandLine, c.defaults))
+}
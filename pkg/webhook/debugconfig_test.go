@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestCurrentRuntimeConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("dode.admin-bind-address", ":8080", "")
+	fs.String("admin-bind-address", ":8080", "")
+	fs.String("api-token", "secret-value", "")
+	fs.String("api-token-file", "/var/run/token", "")
+	fs.String("dode.sentry-dsn-secret", "ns/name", "")
+	fs.String("sentry-dsn", "https://key@sentry.example.com/1", "")
+
+	rc := currentRuntimeConfig(fs, &configDefaults{raw: []byte(`{"ttl":300}`)})
+	want := map[string]string{
+		"dode.admin-bind-address": ":8080",
+		"api-token":               redacted,
+		"api-token-file":          "/var/run/token",
+		"dode.sentry-dsn-secret":  "ns/name",
+		"sentry-dsn":              redacted,
+	}
+	for name, value := range want {
+		if got := rc.Flags[name]; got != value {
+			t.Errorf("flag %s: expected %q, got %q", name, value, got)
+		}
+	}
+	if _, ok := rc.Flags["admin-bind-address"]; ok {
+		t.Errorf("expected deprecated flag names to be left out")
+	}
+	if string(rc.SolverDefaults) != `{"ttl":300}` {
+		t.Errorf("expected the solver config defaults, got %s", rc.SolverDefaults)
+	}
+	if rc := currentRuntimeConfig(fs, nil); rc.SolverDefaults != nil {
+		t.Errorf("expected no solver config defaults without the ConfigMap, got %s", rc.SolverDefaults)
+	}
+}
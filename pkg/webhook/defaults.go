@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// configDefaultsKey is the key of the defaults ConfigMap holding the
+	// solver config defaults as JSON.
+	configDefaultsKey = "config.json"
+	// configDefaultsRefreshInterval is how often the defaults ConfigMap is
+	// read again, so that edits take effect without a restart.
+	configDefaultsRefreshInterval = time.Minute
+)
+
+// perIssuerConfigFields are the solver config fields that can't have
+// webhook-wide defaults: which credentials a challenge uses and which zones
+// an issuer is for are decided by each issuer.
+var perIssuerConfigFields = []string{
+	"apiTokenSecretRef",
+	"apiTokenSecretKeys",
+	"apiTokenSecretRefs",
+	"zoneTokens",
+	"tokenProvider",
+	"apiTokenFile",
+	"apiTokenVaultRef",
+	"usernameSecretRef",
+	"passwordSecretRef",
+	"workloadCluster",
+	"zones",
+}
+
+// configDefaults holds webhook-wide defaults of solver configs, such as the
+// TTL, timeouts, API URL and propagation settings, read from a ConfigMap.
+// Solver configs are decoded on top of them, so fields an issuer sets
+// override the defaults, and nested ones such as propagation are merged
+// field by field.
+type configDefaults struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	mu sync.Mutex
+	// raw is the JSON of the defaults last read successfully.
+	raw []byte
+}
+
+// newConfigDefaults returns defaults read from the ConfigMap namespace/name.
+func newConfigDefaults(client kubernetes.Interface, ref string) (*configDefaults, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("--dode.defaults-configmap must be of the form namespace/name, got %q", ref)
+	}
+	return &configDefaults{client: client, namespace: parts[0], name: parts[1]}, nil
+}
+
+// load reads the defaults from the ConfigMap. Invalid defaults are rejected
+// as a whole, keeping those read before.
+func (d *configDefaults) load(ctx context.Context) error {
+	cm, err := d.client.CoreV1().ConfigMaps(d.namespace).Get(ctx, d.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to read solver config defaults from ConfigMap %s/%s: %v", d.namespace, d.name, err)
+	}
+	raw := []byte(cm.Data[configDefaultsKey])
+	if err := validateConfigDefaults(raw); err != nil {
+		return fmt.Errorf("invalid solver config defaults in ConfigMap %s/%s: %v", d.namespace, d.name, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(raw) == 0 {
+		raw = nil
+	}
+	d.raw = raw
+	return nil
+}
+
+// run reads the defaults again every configDefaultsRefreshInterval until
+// stopCh is closed.
+func (d *configDefaults) run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := d.load(context.Background()); err != nil {
+			klog.Warningf("%v; keeping the defaults read before", err)
+		}
+	}, configDefaultsRefreshInterval, stopCh)
+}
+
+// get returns the JSON of the defaults, or nil if there are none. It may be
+// called on a nil configDefaults.
+func (d *configDefaults) get() []byte {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.raw
+}
+
+// validateConfigDefaults returns an error if raw isn't a solver config
+// without unknown and per-issuer fields, or if it holds values a solver
+// config may not have, such as a TTL below the minimum. Values that are
+// only missing, such as the DoH servers of propagation settings, can still
+// be set by each issuer. Empty defaults are valid.
+func validateConfigDefaults(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	var cfg dodeDNSProviderConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+	if unknown := unknownConfigFields(raw); len(unknown) > 0 {
+		return fmt.Errorf("unknown fields %s", strings.Join(unknown, ", "))
+	}
+	var perIssuer []string
+	for _, name := range perIssuerConfigFields {
+		if _, ok := fields[name]; ok {
+			perIssuer = append(perIssuer, name)
+		}
+	}
+	if len(perIssuer) > 0 {
+		return fmt.Errorf("%s can only be set per issuer", strings.Join(perIssuer, ", "))
+	}
+	setConfigDefaults(&cfg)
+	errs := validateConfig(&cfg).Filter(func(err error) bool {
+		fieldErr, ok := err.(*field.Error)
+		return ok && fieldErr.Type == field.ErrorTypeRequired
+	})
+	if len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return nil
+}
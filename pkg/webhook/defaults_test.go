@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "dode-defaults"},
+		Data: map[string]string{configDefaultsKey: `{
+			"ttl": 300,
+			"requestTimeoutSeconds": 10,
+			"apiUrl": "https://proxy.example.com/api",
+			"propagation": {"dohServers": ["google"], "timeoutSeconds": 60}
+		}`},
+	}
+	client := fake.NewSimpleClientset(cm)
+	d, err := newConfigDefaults(client, "cert-manager/dode-defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := d.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"apiTokenSecretRef":{"name":"dode"},"ttl":900,"propagation":{"timeoutSeconds":30}}`)}, d.get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TTL != 900 || cfg.RequestTimeoutSeconds != 10 || cfg.APIURL != "https://proxy.example.com/api" {
+		t.Errorf("expected the issuer's TTL and the default timeout and API URL, got %+v", cfg)
+	}
+	if p := cfg.Propagation; p.TimeoutSeconds != 30 || len(p.DoHServers) != 1 {
+		t.Errorf("expected the propagation defaults merged with the issuer's, got %+v", p)
+	}
+	if cfg, err := loadConfig(nil, d.get()); err != nil || cfg.TTL != 300 {
+		t.Errorf("expected the defaults without a solver config, got %+v, %v", cfg, err)
+	}
+
+	cm.Data[configDefaultsKey] = `{"ttl": 120, "apiTokenSecretRef": {"name": "shared"}}`
+	if _, err := client.CoreV1().ConfigMaps("cert-manager").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.load(ctx); err == nil || !strings.Contains(err.Error(), "apiTokenSecretRef can only be set per issuer") {
+		t.Errorf("expected per-issuer fields to be rejected, got %v", err)
+	}
+	if cfg, _ := loadConfig(nil, d.get()); cfg.TTL != 300 {
+		t.Errorf("expected the defaults read before to be kept, got TTL %d", cfg.TTL)
+	}
+}
+
+func TestValidateConfigDefaults(t *testing.T) {
+	for raw, want := range map[string]string{
+		``:                           "",
+		`{"cleanupDelaySeconds": 5}`: "",
+		`{"tll": 300}`:               "unknown fields tll",
+		`{"ttl": "300"}`:             "cannot unmarshal",
+		`{"zones": ["example.com"]}`: "zones can only be set per issuer",
+		`{"ttl": 30}`:                "ttl",
+		`{"apiUrl": "http://proxy.example.com/api"}`: "apiUrl",
+		`{"propagation": {"timeoutSeconds": 60}}`:    "",
+	} {
+		err := validateConfigDefaults([]byte(raw))
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("validateConfigDefaults(%q): expected error mentioning %q, got %v", raw, want, err)
+		}
+	}
+}
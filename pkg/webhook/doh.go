@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// dohProviders maps the well-known DNS-over-HTTPS providers that can be
+// referenced by name in the solver config to their JSON API endpoints.
+var dohProviders = map[string]string{
+	"google":     "https://dns.google/resolve",
+	"cloudflare": "https://cloudflare-dns.com/dns-query",
+}
+
+// dnsTypeTXT is the numeric RR type of TXT records used by the DoH JSON API.
+const dnsTypeTXT = 16
+
+// dohResolver looks up TXT records through a DNS-over-HTTPS JSON API such as
+// the ones offered by Google and Cloudflare. It only needs HTTPS egress, which
+// makes it usable in clusters where outbound DNS over UDP is blocked.
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+	// cacheBusting makes every query unique so that HTTP caches between
+	// the webhook and the resolver can't serve stale answers.
+	cacheBusting bool
+}
+
+// newDoHResolver returns a resolver for server, which is either the name of
+// a well-known provider (see dohProviders) or the HTTPS URL of a JSON API
+// endpoint.
+func newDoHResolver(server string, client *http.Client) (*dohResolver, error) {
+	endpoint, ok := dohProviders[strings.ToLower(server)]
+	if !ok {
+		u, err := url.Parse(server)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("DoH server %q is neither a known provider nor an https URL", server)
+		}
+		endpoint = server
+	}
+	return &dohResolver{endpoint: endpoint, client: client}, nil
+}
+
+func (r *dohResolver) String() string {
+	return r.endpoint
+}
+
+// lookupTXT returns the values of all TXT records at fqdn. A name that does
+// not exist yields no values rather than an error.
+func (r *dohResolver) lookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+
+	// dohResponse is the subset of the DoH JSON response we care about.
+	type dohResponse struct {
+		Status int `json:"Status"`
+		Answer []struct {
+			Type int    `json:"type"`
+			Data string `json:"data"`
+		} `json:"Answer"`
+	}
+
+	q := url.Values{}
+	q.Set("name", fqdn)
+	q.Set("type", "TXT")
+	if r.cacheBusting {
+		// random_padding is ignored by the resolvers, but makes the URL
+		// unique.
+		q.Set("random_padding", randomPadding())
+	}
+	req, err := http.NewRequest("GET", r.endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/dns-json")
+	if r.cacheBusting {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying DoH server %s for %q: %v", r.endpoint, fqdn, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server %s returned %s for %q", r.endpoint, resp.Status, fqdn)
+	}
+
+	var dr dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dr); err != nil {
+		return nil, fmt.Errorf("error decoding DoH response from %s: %v", r.endpoint, err)
+	}
+
+	// NOERROR and NXDOMAIN are both valid answers while waiting for a
+	// record to appear; anything else (e.g. SERVFAIL) is an error.
+	const rcodeNoError, rcodeNXDomain = 0, 3
+	switch dr.Status {
+	case rcodeNoError:
+	case rcodeNXDomain:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("DoH server %s answered %q with rcode %d", r.endpoint, fqdn, dr.Status)
+	}
+
+	var values []string
+	for _, a := range dr.Answer {
+		if a.Type != dnsTypeTXT {
+			continue
+		}
+		values = append(values, unquoteTXT(a.Data))
+	}
+	return values, nil
+}
+
+// randomPadding returns a random URL-safe string.
+func randomPadding() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// unquoteTXT joins the character-strings of a presentation format TXT record
+// (e.g. `"abc" "def"`) into a single value.
+func unquoteTXT(data string) string {
+	if !strings.HasPrefix(data, `"`) {
+		return data
+	}
+	var b strings.Builder
+	inQuotes, escaped := false, false
+	for _, r := range data {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDoHResolverLookupTXT(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("type"); got != "TXT" {
+			t.Errorf("expected TXT query, got %q", got)
+		}
+		switch r.URL.Query().Get("name") {
+		case "_acme-challenge.example.com.":
+			fmt.Fprint(w, `{"Status":0,"Answer":[`+
+				`{"name":"_acme-challenge.example.com.","type":5,"data":"alias.example.net."},`+
+				`{"name":"_acme-challenge.example.com.","type":16,"data":"\"abc\""},`+
+				`{"name":"_acme-challenge.example.com.","type":16,"data":"\"de\" \"f\""}]}`)
+		case "missing.example.com.":
+			fmt.Fprint(w, `{"Status":3}`)
+		default:
+			fmt.Fprint(w, `{"Status":2}`)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := newDoHResolver(srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := r.lookupTXT(context.Background(), "_acme-challenge.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"abc", "def"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+
+	values, err = r.lookupTXT(context.Background(), "missing.example.com.")
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected no values and no error for NXDOMAIN, got %v, %v", values, err)
+	}
+
+	if _, err := r.lookupTXT(context.Background(), "broken.example.com."); err == nil {
+		t.Errorf("expected an error for SERVFAIL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := waitForPropagation(ctx, []PropagationChecker{resolverChecker{r}}, "_acme-challenge.example.com.", "def", 1, &pollBackoff{interval: time.Millisecond, factor: 1}); err != nil {
+		t.Errorf("unexpected propagation error: %v", err)
+	}
+}
+
+func TestNewDoHResolver(t *testing.T) {
+	for server, ok := range map[string]bool{
+		"google":                          true,
+		"Cloudflare":                      true,
+		"https://doh.example.com/resolve": true,
+		"http://doh.example.com/resolve":  false,
+		"quad9":                           false,
+	} {
+		if _, err := newDoHResolver(server, http.DefaultClient); (err == nil) != ok {
+			t.Errorf("%s: unexpected result %v", server, err)
+		}
+	}
+}
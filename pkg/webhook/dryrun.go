@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog"
+)
+
+// dryRunTransport logs the requests of configs with dryRun, with their token
+// redacted and their value replaced by its digest, and answers them like a
+// successful API call without sending them, so that new issuers can be tried
+// without changing any records.
+type dryRunTransport struct{}
+
+func (dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	q := u.Query()
+	if q.Get("token") != "" {
+		q.Set("token", redacted)
+	}
+	if txt := q.Get("value"); txt != "" {
+		q.Set("value", "sha256:"+keyDigest(txt))
+	}
+	u.RawQuery = q.Encode()
+	klog.Infof("dry run, not sending DODE API request %s %s", req.Method, &u)
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"success":true}`)),
+		Request:    req,
+	}, nil
+}
+
+// dryRunAPI returns a client of the endpoint at baseURL that only logs its
+// requests.
+func dryRunAPI(baseURL string) dodeAPI {
+	return dode.NewClient(dode.WithBaseURL(baseURL), dode.WithTransport(dryRunTransport{}))
+}
+
+// presentValue presents value at domain for ch through api, tracking it and
+// calling the hooks. With cfg.DryRun, api only logs the request, and the
+// value is neither tracked nor announced to the hooks: it was never
+// presented, so real challenges at the same name must not restore it.
+func (c *dodeDNSProviderSolver) presentValue(ctx context.Context, cfg *dodeDNSProviderConfig, ch *v1alpha1.ChallengeRequest, api dodeAPI, token, zone, domain, value string) error {
+	if cfg.DryRun {
+		return api.Present(ctx, token, domain, value, cfg.TTL)
+	}
+	return c.withHooks(ctx, "present", ch, func() error {
+		return c.addRecord(ctx, api, token, zone, domain, value, cfg.TTL, cfg.MaxRecordsPerName)
+	})
+}
+
+// cleanUpValue removes value from domain for ch through api like
+// presentValue presents it.
+func (c *dodeDNSProviderSolver) cleanUpValue(ctx context.Context, cfg *dodeDNSProviderConfig, ch *v1alpha1.ChallengeRequest, api dodeAPI, token, zone, domain, value string) error {
+	if cfg.DryRun {
+		return api.CleanUp(ctx, token, domain)
+	}
+	return c.withHooks(ctx, "cleanup", ch, func() error {
+		return c.removeRecord(ctx, api, token, zone, domain, value, cfg.TTL)
+	})
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestAPIForDryRun(t *testing.T) {
+	srv := newFakeDodeAPI("token")
+	defer srv.Close()
+	c := newTestSolver(srv)
+	ctx := context.Background()
+
+	api := c.apiFor(&dodeDNSProviderConfig{APIURL: srv.URL, DryRun: true})
+	if err := api.Present(ctx, "token", "_acme-challenge.example.com", "key", defaultTTL); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.CleanUp(ctx, "token", "_acme-challenge.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.calls != 0 {
+		t.Errorf("expected a dry run not to call the API, got %d calls", srv.calls)
+	}
+}
+
+// TestDryRunValuesAreNeverRestored covers a dry run and a real issuer
+// sharing a name: cleaning up the real challenge must not present the value
+// of the dry run, which was never presented, and dry runs don't call hooks.
+func TestDryRunValuesAreNeverRestored(t *testing.T) {
+	api := newFakeDodeAPI("token")
+	defer api.Close()
+	var hookCalls int32
+	hookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hookCalls, 1)
+	}))
+	defer hookSrv.Close()
+	c := newTestSolver(api)
+	hooks, err := newHTTPHooks(hookSrv.URL, "pre-present,post-present,pre-cleanup,post-cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.hooks = []hook{hooks}
+	ctx := context.Background()
+	ch := &v1alpha1.ChallengeRequest{}
+	const zone, domain = "example.com.", "_acme-challenge.example.com"
+
+	dry := &dodeDNSProviderConfig{APIURL: api.URL, DryRun: true, TTL: defaultTTL}
+	if err := c.presentValue(ctx, dry, ch, c.apiFor(dry), "token", zone, domain, "dry-run-key"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&hookCalls); calls != 0 {
+		t.Errorf("expected a dry run not to call hooks, got %d calls", calls)
+	}
+	if c.ledger.has(domain, "dry-run-key") {
+		t.Errorf("expected the dry run's value not to be tracked")
+	}
+
+	live := &dodeDNSProviderConfig{TTL: defaultTTL}
+	for _, key := range []string{"real-key", "other-key"} {
+		if err := c.presentValue(ctx, live, ch, c.api, "token", zone, domain, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.cleanUpValue(ctx, live, ch, c.api, "token", zone, domain, "real-key"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := api.values(domain), []string{"other-key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only %v to be restored, got %v", want, got)
+	}
+	if err := c.cleanUpValue(ctx, dry, ch, c.apiFor(dry), "token", zone, domain, "dry-run-key"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := api.values(domain), []string{"other-key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the dry run's cleanup to leave %v, got %v", want, got)
+	}
+}
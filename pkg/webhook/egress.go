@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// egressPolicy restricts the hosts the webhook connects to, so that a
+// solver config pointing the webhook at some other host, e.g. through a
+// DoH server URL, can't make it send requests there.
+type egressPolicy struct {
+	hosts map[string]bool
+}
+
+// egress is the policy outbound connections are checked against. Nil allows
+// every connection.
+var egress *egressPolicy
+
+// newEgressPolicy allows connections to hosts, which are either host names or
+// URLs.
+func newEgressPolicy(hosts ...string) *egressPolicy {
+	p := &egressPolicy{hosts: map[string]bool{}}
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if u, err := url.Parse(h); err == nil && u.Host != "" {
+			h = u.Hostname()
+		}
+		if h != "" {
+			p.hosts[normalizeName(h)] = true
+		}
+	}
+	return p
+}
+
+// allow returns an error, and logs and counts the violation, unless the
+// policy allows connections to host. kind is "http" or "dns".
+func (p *egressPolicy) allow(kind, host string) error {
+	if p == nil || p.hosts[normalizeName(host)] {
+		return nil
+	}
+	egressViolations.WithLabelValues(kind).Inc()
+	klog.Warningf("strict egress: refused %s connection to %q, which is not an allowed host", kind, host)
+	return fmt.Errorf("strict egress: connections to %q are not allowed", host)
+}
+
+func (p *egressPolicy) String() string {
+	hosts := make([]string, 0, len(p.hosts))
+	for h := range p.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, ",")
+}
+
+// egressTransport refuses requests to hosts the egress policy doesn't allow.
+// It is checked for every request, including the ones following redirects.
+type egressTransport struct {
+	base http.RoundTripper
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := egress.allow("http", req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// egressClient returns an HTTP client with the given timeout whose requests
+// are subject to strict egress. Every outbound client of the webhook but the
+// Kubernetes clients is one of these, or uses an egressTransport otherwise;
+// the default transport itself is left alone.
+func egressClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &egressTransport{base: http.DefaultTransport},
+	}
+}
+
+// enableStrictEgress restricts outbound connections to hosts. It must be
+// called before any goroutine making requests is started, as the policy
+// isn't guarded.
+func enableStrictEgress(hosts ...string) {
+	egress = newEgressPolicy(hosts...)
+	klog.Infof("strict egress enabled, allowed hosts: %s", egress)
+}
+
+// dnsServerHost returns the host of a DNS server address of the form
+// host:port.
+func dnsServerHost(server string) string {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return server
+	}
+	return host
+}
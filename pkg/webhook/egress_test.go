@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEgressPolicy(t *testing.T) {
+	p := newEgressPolicy("https://www.do.de/api/letsencrypt", "DNS.Google.", " 10.0.0.53 ", "")
+	for _, host := range []string{"www.do.de", "dns.google", "10.0.0.53"} {
+		if err := p.allow("http", host); err != nil {
+			t.Errorf("expected %s to be allowed: %v", host, err)
+		}
+	}
+	if err := p.allow("http", "attacker.example.com"); err == nil {
+		t.Error("expected other hosts to be refused")
+	}
+	var unrestricted *egressPolicy
+	if err := unrestricted.allow("dns", "attacker.example.com"); err != nil {
+		t.Errorf("expected a nil policy to allow everything: %v", err)
+	}
+}
+
+func TestEgressTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	defer func(p *egressPolicy) { egress = p }(egress)
+	client := &http.Client{Transport: &egressTransport{base: http.DefaultTransport}}
+
+	egress = newEgressPolicy("www.do.de")
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("expected the request to be refused")
+	}
+	egress = newEgressPolicy(srv.URL)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the request to be allowed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestEgressClientLeavesDefaultTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	defer func(p *egressPolicy) { egress = p }(egress)
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+
+	enableStrictEgress("www.do.de")
+	if _, err := egressClient(time.Second).Get(srv.URL); err == nil {
+		t.Error("expected the request of the egress client to be refused")
+	}
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the default client to be unaffected: %v", err)
+	}
+	resp.Body.Close()
+}
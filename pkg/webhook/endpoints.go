@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// endpointKey identifies a client of an API endpoint with a request timeout,
+// reached through a proxy. A zero timeout is the webhook's default, an empty
+// proxyURL means the proxy of the environment, if any.
+type endpointKey struct {
+	baseURL  string
+	timeout  time.Duration
+	proxyURL string
+}
+
+// apiEndpoints builds and keeps the clients solver configs use in place of
+// the webhook's client, to talk to another endpoint, e.g. a corporate
+// egress proxy or a mock of the API, with another request timeout or
+// through another proxy.
+type apiEndpoints struct {
+	// defaultURL is the endpoint of the webhook's client.
+	defaultURL string
+	newClient  func(key endpointKey) dodeAPI
+
+	mu      sync.Mutex
+	clients map[endpointKey]dodeAPI
+}
+
+func newAPIEndpoints(defaultURL string, newClient func(key endpointKey) dodeAPI) *apiEndpoints {
+	return &apiEndpoints{defaultURL: defaultURL, newClient: newClient, clients: map[endpointKey]dodeAPI{}}
+}
+
+// get returns the client for key, using defaultURL if key has no baseURL.
+func (e *apiEndpoints) get(key endpointKey) dodeAPI {
+	if key.baseURL == "" {
+		key.baseURL = e.defaultURL
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	api, ok := e.clients[key]
+	if !ok {
+		api = e.newClient(key)
+		e.clients[key] = api
+	}
+	return api
+}
+
+// apiFor returns the client of the API endpoint cfg uses, retrying as cfg
+// sets out. Configs setting none of apiUrl, requestTimeoutSeconds and
+// proxyUrl use the webhook's client, which is the only one mirrored.
+// Configs with dryRun get a client that doesn't send any requests.
+func (c *dodeDNSProviderSolver) apiFor(cfg *dodeDNSProviderConfig) dodeAPI {
+	if cfg.DryRun {
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = c.endpoints.defaultURL
+		}
+		return dryRunAPI(baseURL)
+	}
+	if cfg.APIURL == "" && cfg.RequestTimeoutSeconds == 0 && cfg.ProxyURL == "" {
+		return withRetries(c.quotas.enforce(c.api), cfg)
+	}
+	return withRetries(c.quotas.enforce(c.endpoints.get(endpointKey{cfg.APIURL, seconds(cfg.RequestTimeoutSeconds), cfg.ProxyURL})), cfg)
+}
+
+// validateAPIURL returns an error unless s is an https URL. The API token is
+// sent in the query, so it must never be sent in plain text.
+func validateAPIURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be an https URL, got %q", s)
+	}
+	return nil
+}
+
+// plainAPIClient returns a client for key with the defaults of the dode
+// package, except for a positive timeout and the proxy.
+func plainAPIClient(key endpointKey) dodeAPI {
+	opts := []dode.Option{dode.WithBaseURL(key.baseURL)}
+	if key.timeout > 0 {
+		opts = append(opts, dode.WithTimeout(key.timeout))
+	}
+	if proxy, err := url.Parse(key.proxyURL); err == nil && key.proxyURL != "" {
+		opts = append(opts, dode.WithTransport(tlsTransport(nil, fixedProxy(proxy))))
+	}
+	return dode.NewClient(opts...)
+}
+
+// validateProxyURL returns an error unless s is an http or https URL.
+func validateProxyURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL, got %q", s)
+	}
+	return nil
+}
+
+// fixedProxy returns the Proxy function of an http.Transport sending every
+// request through proxy. Under strict egress, the proxy's host must be
+// allowed, as that is where the connection goes.
+func fixedProxy(proxy *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(*http.Request) (*url.URL, error) {
+		if err := egress.allow("http", proxy.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxy, nil
+	}
+}
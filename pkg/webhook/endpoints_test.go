@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+func TestAPIFor(t *testing.T) {
+	def, proxy := newFakeDodeAPI("token"), newFakeDodeAPI("token")
+	defer def.Close()
+	defer proxy.Close()
+	c := newTestSolver(def)
+	ctx := context.Background()
+
+	cfg := dodeDNSProviderConfig{APIURL: proxy.URL}
+	if err := c.addRecord(ctx, c.apiFor(&cfg), "token", "example.com.", "_acme-challenge.example.com", "key", defaultTTL, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := proxy.values("_acme-challenge.example.com"); !reflect.DeepEqual(got, []string{"key"}) {
+		t.Errorf("expected the record to be presented through apiUrl, got %q", got)
+	}
+	if def.calls != 0 {
+		t.Errorf("expected no calls to the default endpoint, got %d", def.calls)
+	}
+	if c.apiFor(&cfg) != c.apiFor(&cfg) {
+		t.Errorf("expected the client of an endpoint to be reused")
+	}
+	if c.apiFor(&dodeDNSProviderConfig{}) != c.api {
+		t.Errorf("expected the default endpoint without apiUrl")
+	}
+}
+
+func TestAPIForRequestTimeout(t *testing.T) {
+	c := newDodeDNSProviderSolver(nil, nil)
+	api, ok := c.apiFor(&dodeDNSProviderConfig{RequestTimeoutSeconds: 5}).(*dode.Client)
+	if !ok {
+		t.Fatal("expected a client for the timeout")
+	}
+	if api.BaseURL != dode.DefaultAPIURL || api.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("expected the default endpoint with a 5s timeout, got %s and %s", api.BaseURL, api.HTTPClient.Timeout)
+	}
+}
+
+func TestValidateAPIURL(t *testing.T) {
+	for s, valid := range map[string]bool{
+		"https://www.do.de/api/letsencrypt": true,
+		"https://proxy.internal:8443/dode":  true,
+		"http://www.do.de/api/letsencrypt":  false,
+		"https://":                          false,
+		"www.do.de":                         false,
+	} {
+		if err := validateAPIURL(s); (err == nil) != valid {
+			t.Errorf("validateAPIURL(%q) = %v", s, err)
+		}
+	}
+}
+
+func TestAPIForProxyURL(t *testing.T) {
+	c := newDodeDNSProviderSolver(nil, nil)
+	cfg := dodeDNSProviderConfig{ProxyURL: "http://proxy.internal:3128"}
+	if c.apiFor(&cfg) == c.apiFor(&dodeDNSProviderConfig{RequestTimeoutSeconds: 30}) {
+		t.Errorf("expected a separate client for the proxy")
+	}
+	if c.apiFor(&cfg) != c.apiFor(&cfg) {
+		t.Errorf("expected the client of a proxy to be reused")
+	}
+}
+
+func TestValidateProxyURL(t *testing.T) {
+	for s, valid := range map[string]bool{
+		"http://proxy.internal:3128":  true,
+		"https://proxy.internal:3129": true,
+		"socks5://proxy.internal":     false,
+		"http://":                     false,
+		"proxy.internal:3128":         false,
+	} {
+		if err := validateProxyURL(s); (err == nil) != valid {
+			t.Errorf("validateProxyURL(%q) = %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// eventComponent is the source component of Events emitted by the webhook.
+const eventComponent = "cert-manager-webhook-dode"
+
+// Event reasons used by the webhook.
+const (
+	reasonWaitingForSecret = "WaitingForSecret"
+	reasonSlowAPIResponse  = "SlowAPIResponse"
+)
+
+// newEventRecorder returns a recorder that publishes Events through client.
+func newEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.V(4).Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
+
+// secretReference returns a reference to the Secret namespace/name that can be
+// used as the subject of an Event, even if the Secret doesn't exist yet.
+func secretReference(namespace, name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
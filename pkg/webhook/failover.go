@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// getAPIKeys returns the tokens to use for cfg, in the order they are to be
+// tried. Configs with apiTokenSecretRefs get a token per Secret that could be
+// read, so that a Secret deleted or not yet created during a rotation doesn't
+// fail challenges as long as another one is there; every other config gets
+// the single token of getAPIKey.
+func (c *dodeDNSProviderSolver) getAPIKeys(cfg *dodeDNSProviderConfig, namespace string, allowAmbient bool) ([]string, error) {
+	keys, _, err := c.getAPIKeyRefs(cfg, namespace, allowAmbient)
+	return keys, err
+}
+
+// getAPIKeyRefs is getAPIKeys, also returning the apiTokenSecretRef each of
+// the tokens was read with. Its name is empty for tokens not read from a
+// Secret.
+func (c *dodeDNSProviderSolver) getAPIKeyRefs(cfg *dodeDNSProviderConfig, namespace string, allowAmbient bool) ([]string, []secretKeySelector, error) {
+	if len(cfg.APITokenSecretRefs) == 0 {
+		key, err := c.getAPIKey(cfg, namespace, allowAmbient)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{key}, []secretKeySelector{cfg.APITokenSecretRef}, nil
+	}
+	var (
+		keys []string
+		refs []secretKeySelector
+		errs []error
+	)
+	for i, ref := range cfg.APITokenSecretRefs {
+		key, err := c.getAPIKey(secretRefConfig(cfg, ref), namespace, allowAmbient)
+		if err != nil {
+			klog.Warningf("skipping apiTokenSecretRefs[%d]: %v", i, err)
+			errs = append(errs, fmt.Errorf("apiTokenSecretRefs[%d]: %w", i, err))
+			continue
+		}
+		keys = append(keys, key)
+		refs = append(refs, ref)
+	}
+	if len(keys) == 0 {
+		return nil, nil, utilerrors.NewAggregate(errs)
+	}
+	return keys, refs, nil
+}
+
+// secretRefConfig returns a copy of cfg using ref as its apiTokenSecretRef.
+func secretRefConfig(cfg *dodeDNSProviderConfig, ref secretKeySelector) *dodeDNSProviderConfig {
+	refCfg := *cfg
+	refCfg.APITokenSecretRef = ref
+	refCfg.APITokenSecretRefs = nil
+	return &refCfg
+}
+
+// failoverAPI retries calls the API rejected the token of with the fallback
+// tokens, in order, for the rotation windows in which the old and the new
+// token are both listed in apiTokenSecretRefs. The zone backoff and the
+// credential stats only see the outcome of the last attempt.
+type failoverAPI struct {
+	dodeAPI
+	fallbacks []string
+}
+
+// withFallbackTokens returns api, retrying with fallbacks if there are any.
+func withFallbackTokens(api dodeAPI, fallbacks []string) dodeAPI {
+	if len(fallbacks) == 0 {
+		return api
+	}
+	return &failoverAPI{dodeAPI: api, fallbacks: fallbacks}
+}
+
+func (a *failoverAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	return a.failover(ctx, token, func(token string) error {
+		return a.dodeAPI.Present(ctx, token, domain, value, ttl)
+	})
+}
+
+func (a *failoverAPI) CleanUp(ctx context.Context, token, domain string) error {
+	return a.failover(ctx, token, func(token string) error {
+		return a.dodeAPI.CleanUp(ctx, token, domain)
+	})
+}
+
+func (a *failoverAPI) failover(ctx context.Context, token string, call func(token string) error) error {
+	observeTokenUsed(ctx, 0)
+	err := call(token)
+	for i, fallback := range a.fallbacks {
+		if !dode.IsAuthError(err) {
+			return err
+		}
+		klog.Warningf("DODE API rejected token %d of %d from apiTokenSecretRefs, trying the next one: %v", i+1, len(a.fallbacks)+1, err)
+		tokenFailovers.Inc()
+		observeTokenUsed(ctx, i+1)
+		err = call(fallback)
+	}
+	return err
+}
+
+// observeTokenUsed records in the result carried by ctx, if any, that the
+// next API call uses the token at index of those of getAPIKeyRefs.
+func observeTokenUsed(ctx context.Context, index int) {
+	if r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult); ok {
+		atomic.StoreInt32(&r.tokenIndex, int32(index))
+	}
+}
+
+// tokenRef returns the Secret the token of the last API call of r was read
+// from, with an empty name if it wasn't read from a Secret.
+func (r *ChallengeResult) tokenRef() secretKeySelector {
+	i := int(atomic.LoadInt32(&r.tokenIndex))
+	if i >= len(r.tokenRefs) {
+		return secretKeySelector{}
+	}
+	return r.tokenRefs[i]
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetAPIKeys(t *testing.T) {
+	defer func(b wait.Backoff) { secretNotFoundBackoff = b }(secretNotFoundBackoff)
+	secretNotFoundBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 1}
+
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "old"},
+			Data:       map[string][]byte{"token": []byte("old-token")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "new"},
+			Data:       map[string][]byte{"token": []byte("new-token")},
+		},
+	)
+	c := newDodeDNSProviderSolver(client, nil)
+
+	for _, test := range []struct {
+		cfg     string
+		want    []string
+		wantErr string
+	}{
+		{cfg: `{"apiTokenSecretRef":{"name":"old"}}`, want: []string{"old-token"}},
+		{cfg: `{"apiTokenSecretRefs":[{"name":"old"},{"name":"new"}]}`, want: []string{"old-token", "new-token"}},
+		// A Secret missing during a rotation is skipped.
+		{cfg: `{"apiTokenSecretRefs":[{"name":"missing"},{"name":"new"}]}`, want: []string{"new-token"}},
+		{cfg: `{"apiTokenSecretRefs":[{"name":"missing"},{"name":"gone"}]}`, wantErr: "apiTokenSecretRefs[1]"},
+	} {
+		cfg, err := decodeConfig(&extapi.JSON{Raw: []byte(test.cfg)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.getAPIKeys(&cfg, "default", false)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", test.cfg, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q, %v", test.cfg, test.want, got, err)
+		}
+	}
+}
+
+func TestFailoverAPI(t *testing.T) {
+	api := newFakeDodeAPI("new-token")
+	defer api.Close()
+	c := newTestSolver(api)
+	ctx := context.Background()
+	const domain = "_acme-challenge.example.com"
+
+	failover := withFallbackTokens(c.api, []string{"new-token"})
+	if err := c.addRecord(ctx, failover, "old-token", "example.com.", domain, "key", defaultTTL, 0); err != nil {
+		t.Fatalf("expected the next token to be used, got %v", err)
+	}
+	if got := api.values(domain); !reflect.DeepEqual(got, []string{"key"}) {
+		t.Errorf("expected the record to be presented, got %v", got)
+	}
+	if api.calls != 2 {
+		t.Errorf("expected 2 API calls, got %d", api.calls)
+	}
+	if err := c.removeRecord(ctx, failover, "old-token", "example.com.", domain, "key", defaultTTL); err != nil {
+		t.Fatalf("expected the next token to be used, got %v", err)
+	}
+
+	// Only rejected tokens fail over.
+	failover = withFallbackTokens(&blockingRestoreAPI{failing: "key"}, []string{"new-token"})
+	if err := failover.Present(ctx, "old-token", domain, "key", defaultTTL); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("expected the error of the first token, got %v", err)
+	}
+
+	if api := withFallbackTokens(c.api, nil); api != c.api {
+		t.Errorf("expected no failover without fallback tokens")
+	}
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// flagPrefix namespaces the flags of the webhook, setting them apart from the
+// many flags of the serving library and of klog.
+const flagPrefix = "dode."
+
+// Command line flags of the webhook. They are registered on the standard
+// flag set, which the webhook serving library merges into its own flags, and
+// are therefore only populated once the server has started, i.e. by the
+// time Initialize is called.
+var (
+	adminBindAddress = stringFlag("admin-bind-address", "",
+		"Address to serve the plain HTTP admin endpoints (e.g. /readyz) on, such as :8080. Disabled if empty.")
+	auditBufferSize = intFlag("audit-buffer-size", defaultAuditBufferSize,
+		"Number of recent challenge operations kept in memory and written to stderr if the webhook panics.")
+	sentryDSNSecret = stringFlag("sentry-dsn-secret", "",
+		"Secret (namespace/name) whose `dsn` key holds a Sentry DSN panics in the solver are reported to.")
+	fleetMode = boolFlag("fleet-mode", false,
+		"Allow solver configs to reference Cluster API workload clusters whose kubeconfig Secrets are read to fetch the API token from the workload cluster.")
+	writableDir = stringFlag("writable-dir", os.TempDir(),
+		"Directory the webhook may write files such as crash audit trails to. Features writing files are disabled if it isn't writable.")
+	cloudEventsSinkURL = stringFlag("cloudevents-sink", "",
+		"HTTP(S) URL CloudEvents for presented, cleaned up and failed challenges are posted to in binary mode. Disabled if empty.")
+	mirrorAPIURL = stringFlag("mirror-api-url", "",
+		"Secondary DODE API endpoint a sample of the requests is mirrored to in order to compare its outcomes with the primary's. Disabled if empty.")
+	mirrorPercent = float64Flag("mirror-percent", 100,
+		"Percentage of the requests mirrored to --dode.mirror-api-url.")
+	hookURL = stringFlag("hook-url", "",
+		"HTTP(S) URL called with a JSON description of the challenge before and after records are changed. Disabled if empty.")
+	hookPhasesFlag = stringFlag("hook-phases", "post-present,post-cleanup",
+		"Comma separated phases --dode.hook-url and --dode.hook-job-template are run in: pre-present, post-present, pre-cleanup and post-cleanup. A failing pre hook aborts the operation.")
+	hookJobTemplate = flag.String(flagPrefix+"hook-job-template", "",
+		"File holding the manifest of a Job created in --dode.hook-job-namespace before and after records are changed, with the challenge in HOOK_* environment variables of its containers. Jobs of pre hooks are waited for. Disabled if empty.")
+	hookJobNamespace = flag.String(flagPrefix+"hook-job-namespace", "",
+		"Namespace the Jobs of --dode.hook-job-template are created in, e.g. that of the webhook.")
+	zoneApprovalConfigMap = stringFlag("zone-approval-configmap", "",
+		"ConfigMap (namespace/name) listing the zones an operator has approved. When set, challenges for any other zone are held until it is approved.")
+	slowAPIThreshold = flag.Duration(flagPrefix+"slow-api-threshold", 10*time.Second,
+		"DODE API calls taking longer are counted in dode_webhook_slow_api_calls_total and reported in a warning Event on the token Secret. Disabled if zero.")
+	responseSuccessPath = flag.String(flagPrefix+"response-success-path", "",
+		"Path (e.g. $.data.success) of the field telling whether a DODE API request succeeded, for gateways that alter the response envelope. Defaults to success.")
+	responseSuccessValue = flag.String(flagPrefix+"response-success-value", "",
+		"Value of the --dode.response-success-path field meaning success. If empty, the field must be the boolean true.")
+	responseErrorPath = flag.String(flagPrefix+"response-error-path", "",
+		"Path (e.g. $.data.message) of the error message in DODE API responses. Defaults to error.")
+	prewarmCertificates = flag.Bool(flagPrefix+"prewarm-certificates", false,
+		"Watch cert-manager Certificates and check the solver config and API token of new ones right away, reporting problems in Events on the Certificate.")
+	clusterResourceNamespace = flag.String(flagPrefix+"cluster-resource-namespace", "cert-manager",
+		"cert-manager's --cluster-resource-namespace, where the Secrets of ClusterIssuers are read from when pre-validating Certificates.")
+	strictEgress = flag.Bool(flagPrefix+"strict-egress", false,
+		"Refuse outbound connections to any host but the DODE API, the well-known DoH providers, the hosts of the URLs given in flags and --dode.egress-allowed-hosts.")
+	egressAllowedHosts = flag.String(flagPrefix+"egress-allowed-hosts", "",
+		"Comma separated further hosts allowed with --dode.strict-egress, e.g. custom DoH servers and recursive resolvers used in solver configs.")
+	zoneShardFlag = flag.String(flagPrefix+"zone-shard", "",
+		"Zones this deployment is responsible for, as a comma separated list of domains or as regex:<expression>. Challenges for other zones are rejected. All zones if empty.")
+	apiURL = flag.String(flagPrefix+"api-url", dode.DefaultAPIURL,
+		"DODE API endpoint, e.g. a corporate egress proxy or a mock of the API. Must be an https URL. Solver configs may override it with apiUrl.")
+	tokenProvidersFlag = flag.String(flagPrefix+"token-providers", "",
+		"Comma separated providers of short-lived API tokens solver configs may refer to with tokenProvider, as <name>=exec:<command> [<arg>...] or <name>=<https URL>. Both return {\"token\": ..., \"expirationTimestamp\": ...}.")
+	tokenFileDir = flag.String(flagPrefix+"token-file-dir", "",
+		"Directory holding, in one subdirectory per namespace, the files solver configs may read the API token from with apiTokenFile, e.g. a CSI or external-secrets mount. apiTokenFile is refused if empty.")
+	vaultAddresses = flag.String(flagPrefix+"vault-addresses", "",
+		"Comma separated https URLs of the HashiCorp Vault servers solver configs may read the API token from with apiTokenVaultRef. apiTokenVaultRef is refused if empty.")
+	vaultPathTemplates = flag.String(flagPrefix+"vault-path-templates", "",
+		"Comma separated Vault paths apiTokenVaultRef.path must be or lie below, with {namespace} standing for the namespace of the challenge, e.g. secret/data/{namespace}, so that Issuers can only read the tokens of their own namespace. Required with --dode.vault-addresses.")
+	vaultRoleTemplate = flag.String(flagPrefix+"vault-role-template", "",
+		"Vault role apiTokenVaultRef.role must be, with {namespace} standing for the namespace of the challenge, e.g. dode-{namespace}. Any role bound to the webhook's service account if empty.")
+	allowAmbientCredentials = flag.Bool(flagPrefix+"allow-ambient-credentials", false,
+		"Use the token in the DODE_API_TOKEN environment variable for all issuers without apiTokenSecretRef, for single-tenant installs.")
+	apiSPKIPins = flag.String(flagPrefix+"api-spki-pins", "",
+		"Comma separated base64 SHA-256 digests of public keys (SPKI pins, optionally prefixed sha256/) the DODE API at --dode.api-url must present one of. List the current and the next key to rotate pins. Disabled if empty.")
+	caBundleFile = flag.String(flagPrefix+"ca-bundle-file", "",
+		"PEM file of CA certificates trusted for connections to the DODE API in addition to the system's, e.g. that of a TLS-inspecting egress proxy.")
+	traceContext = flag.Bool(flagPrefix+"trace-context", false,
+		"Give every Present and CleanUp a W3C trace ID, sent in the traceparent header of its DODE API requests and included in its result line, Events and CloudEvents.")
+	zoneBackoffConfigMap = flag.String(flagPrefix+"zone-backoff-configmap", "",
+		"ConfigMap (namespace/name) the failure streaks and backoff of zones are saved in and restored from on startup, so that restarts don't retry broken zones right away. Disabled if empty.")
+	defaultsConfigMap = flag.String(flagPrefix+"defaults-configmap", "",
+		"ConfigMap (namespace/name) whose config.json key holds defaults of solver configs, e.g. ttl, requestTimeoutSeconds, apiUrl and propagation, which the solver configs of issuers override. Read again every minute.")
+	strictConfig = flag.Bool(flagPrefix+"strict-config", false,
+		"Reject solver configs with unknown fields, e.g. misspelled ones, listing them in the challenge's error instead of only logging a warning.")
+	allowedSecretNamespaces = flag.String(flagPrefix+"allowed-secret-namespaces", "",
+		"Comma separated namespaces apiTokenSecretRef.namespace may refer to, e.g. a central namespace holding the token of several teams. Secrets are only read from the namespace of the challenge if empty.")
+	maxTokenStaleness = flag.Duration(flagPrefix+"max-token-staleness", defaultMaxTokenStaleness,
+		"How long a token read from a Secret may still be used while the Kubernetes API server is unavailable, so that challenges don't fail during control plane maintenance. Disabled if zero.")
+	apiKeyCacheTTL = flag.Duration(flagPrefix+"api-key-cache-ttl", defaultAPIKeyCacheTTL,
+		"How long a token read from a Secret is used for further challenges without reading the Secret again. Tokens the DODE API rejects are read again right away. Disabled if zero.")
+	startupTokenCheckWipeDomain = flag.String(flagPrefix+"startup-token-check-wipe-domain", "",
+		"Domain no Certificate uses, whose _acme-challenge TXT records are DELETED with each token in DODE_API_TOKEN and DODE_TOKEN at startup to check the tokens, as do.de can't validate a token otherwise. Refused if challenges of this replica use the name. Rejected tokens are logged and degrade /readyz. Disabled if empty.")
+	secretCacheNamespaces = flag.String(flagPrefix+"secret-cache-namespaces", "",
+		"Comma separated namespaces whose Secrets are watched and served from cache instead of being fetched for every challenge. Requires permission to list and watch Secrets there. Disabled if empty.")
+	clientCAFile = flag.String(flagPrefix+"client-ca-file", "",
+		"PEM bundle of the CAs the client certificates of the Kubernetes API server's front proxy must be signed by, e.g. /etc/kubernetes/pki/front-proxy-ca.crt. The CA published in the extension-apiserver-authentication ConfigMap is used if empty.")
+	allowedClientNames = flag.String(flagPrefix+"allowed-client-names", "",
+		"Comma separated common names the client certificates verified with --dode.client-ca-file must have, e.g. front-proxy-client. Any name if empty.")
+	pinClientCA = flag.Bool(flagPrefix+"pin-client-ca", false,
+		"Only trust front proxy client certificates signed by --dode.client-ca-file, ignoring the extension-apiserver-authentication ConfigMap, and refuse to start without it. Other means of authentication, such as bearer tokens checked with TokenReviews, still apply.")
+	apiQuotasFlag = flag.String(flagPrefix+"api-quotas", "",
+		"Comma separated quotas of DODE API calls per namespace, such as team-a=100/day,team-a=1000/month. The namespace * applies to namespaces without quotas of their own. Present fails once a quota is used up. Requires --dode.api-quota-configmap.")
+	apiQuotaConfigMap = flag.String(flagPrefix+"api-quota-configmap", "",
+		"ConfigMap (namespace/name) the API calls counted towards --dode.api-quotas are kept in, shared by all replicas. Every call is reserved there before it is made.")
+)
+
+// legacyFlags are the names the flags had before they were namespaced. They
+// are still accepted, but deprecated.
+var legacyFlags []string
+
+// stringFlag registers a string flag as --dode.<name> and as the deprecated
+// --<name>.
+func stringFlag(name, value, usage string) *string {
+	p := flag.String(flagPrefix+name, value, usage)
+	flag.StringVar(p, name, value, usage)
+	legacyFlags = append(legacyFlags, name)
+	return p
+}
+
+func boolFlag(name string, value bool, usage string) *bool {
+	p := flag.Bool(flagPrefix+name, value, usage)
+	flag.BoolVar(p, name, value, usage)
+	legacyFlags = append(legacyFlags, name)
+	return p
+}
+
+func intFlag(name string, value int, usage string) *int {
+	p := flag.Int(flagPrefix+name, value, usage)
+	flag.IntVar(p, name, value, usage)
+	legacyFlags = append(legacyFlags, name)
+	return p
+}
+
+func float64Flag(name string, value float64, usage string) *float64 {
+	p := flag.Float64(flagPrefix+name, value, usage)
+	flag.Float64Var(p, name, value, usage)
+	legacyFlags = append(legacyFlags, name)
+	return p
+}
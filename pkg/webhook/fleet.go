@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+)
+
+// kubeconfigSecretKey is the key holding the kubeconfig in the Secrets Cluster
+// API creates for every workload cluster.
+const kubeconfigSecretKey = "value"
+
+// workloadClusterRef references a Cluster API workload cluster from which the
+// API token Secret is read when the webhook runs in fleet mode.
+type workloadClusterRef struct {
+	// Name is the name of the Cluster. Its kubeconfig is read from the Secret
+	// `<name>-kubeconfig` in the challenge's namespace.
+	Name string `json:"name"`
+	// SecretNamespace is the namespace of the workload cluster holding the
+	// API token Secret. Defaults to the challenge's namespace.
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+}
+
+// kubeconfigSecretName returns the name of the Secret Cluster API stores the
+// kubeconfig of the referenced cluster in.
+func (r *workloadClusterRef) kubeconfigSecretName() string {
+	return r.Name + "-kubeconfig"
+}
+
+// fleetClients caches clients for workload clusters, keyed by the namespaced
+// name of their kubeconfig Secret. A client is rebuilt whenever the Secret's
+// resourceVersion changes, e.g. after Cluster API rotated the credentials.
+type fleetClients struct {
+	mu      sync.Mutex
+	clients map[string]fleetClient
+}
+
+type fleetClient struct {
+	resourceVersion string
+	client          *kubernetes.Clientset
+}
+
+func newFleetClients() *fleetClients {
+	return &fleetClients{clients: map[string]fleetClient{}}
+}
+
+// get returns a client for the workload cluster referenced by ref, reading its
+// kubeconfig Secret from namespace of the management cluster.
+func (f *fleetClients) get(mgmt kubernetes.Interface, namespace string, ref *workloadClusterRef) (*kubernetes.Clientset, error) {
+	secretName := ref.kubeconfigSecretName()
+	sec, err := mgmt.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get kubeconfig secret `%s/%s` of cluster %q; %v", namespace, secretName, ref.Name, err)
+	}
+
+	key := namespace + "/" + secretName
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fc, ok := f.clients[key]; ok && fc.resourceVersion == sec.ResourceVersion {
+		return fc.client, nil
+	}
+
+	kubeconfig, ok := sec.Data[kubeconfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in kubeconfig secret `%s`", kubeconfigSecretKey, key)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig in secret `%s`; %v", key, err)
+	}
+	cl, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("built client for workload cluster %q from secret `%s`", ref.Name, key)
+	f.clients[key] = fleetClient{resourceVersion: sec.ResourceVersion, client: cl}
+	return cl, nil
+}
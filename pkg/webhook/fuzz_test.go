@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// FuzzLoadConfig makes sure no issuer config, however malformed, can panic
+// the webhook while it is decoded, summarized or interpreted.
+func FuzzLoadConfig(f *testing.F) {
+	f.Add([]byte(`{"apiTokenSecretRef":{"name":"dode","key":"token"}}`))
+	f.Add([]byte(`{"propagation":{"dohServers":["google","https://dns.example/q"],"quorum":-1,"pollBackoffFactor":1e308}}`))
+	f.Add([]byte(`{"workloadCluster":null,"maxRecordsPerName":-5,"apiTokenSecretKeys":[""]}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		cfgJSON := &extapi.JSON{Raw: raw}
+		summarizeConfig(cfgJSON)
+		cfg, err := loadConfig(cfgJSON, nil)
+		if err != nil {
+			return
+		}
+		apiTokenSecretKeys(&cfg)
+		credentialName(&cfg, "default")
+		if p := cfg.Propagation; p != nil {
+			p.checkers()
+			p.timeout()
+			p.quorum(3)
+			poll := p.poll()
+			for i := 0; i < 3; i++ {
+				if d := poll.next(); d < 0 {
+					t.Fatalf("negative poll interval %s for %s", d, raw)
+				}
+			}
+		}
+	})
+}
+
+// FuzzFQDN makes sure challenge names and zones are handled without panics
+// and a name is always inside its own zone.
+func FuzzFQDN(f *testing.F) {
+	f.Add("_acme-challenge.example.com.", "example.com.")
+	f.Add("_acme-challenge.EXAMPLE.com", "")
+	f.Add(".", "..")
+	f.Fuzz(func(t *testing.T, fqdn, zone string) {
+		if n := normalizeName(fqdn); strings.ToLower(n) != n {
+			t.Fatalf("normalizeName(%q) = %q is not lower-case", fqdn, n)
+		}
+		if checkFQDNInZone(fqdn, fqdn) != nil {
+			t.Fatalf("%q is not considered inside itself", fqdn)
+		}
+		checkFQDNInZone(fqdn, zone)
+	})
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthReportInterval is how often the health state metric is refreshed
+// independently of requests to /readyz.
+const healthReportInterval = 30 * time.Second
+
+// healthState is the overall health of the webhook. Unlike a plain readiness
+// bit it distinguishes a degraded webhook, which still serves challenges but
+// needs attention, from one that can't serve them at all.
+type healthState string
+
+const (
+	healthHealthy   healthState = "healthy"
+	healthDegraded  healthState = "degraded"
+	healthUnhealthy healthState = "unhealthy"
+)
+
+// severity orders health states from best to worst.
+func (s healthState) severity() int {
+	switch s {
+	case healthHealthy:
+		return 0
+	case healthDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// healthCheck reports the state of one component together with a reason
+// explaining any state other than healthy.
+type healthCheck func() (healthState, string)
+
+// healthReport is the JSON document served on /readyz.
+type healthReport struct {
+	Status  healthState       `json:"status"`
+	Reasons map[string]string `json:"reasons,omitempty"`
+}
+
+// healthChecker aggregates named health checks into a single state.
+type healthChecker struct {
+	mu     sync.Mutex
+	checks map[string]healthCheck
+}
+
+func newHealthChecker() *healthChecker {
+	return &healthChecker{checks: map[string]healthCheck{}}
+}
+
+// register adds check under name, replacing any check of the same name.
+func (h *healthChecker) register(name string, check healthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// report runs every check and returns the worst state with the reasons of
+// all checks that aren't healthy. It also updates the health_state metric.
+func (h *healthChecker) report() healthReport {
+	h.mu.Lock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	checks := h.checks
+	h.mu.Unlock()
+	sort.Strings(names)
+
+	r := healthReport{Status: healthHealthy}
+	for _, name := range names {
+		state, reason := checks[name]()
+		if state == healthHealthy {
+			continue
+		}
+		if r.Reasons == nil {
+			r.Reasons = map[string]string{}
+		}
+		r.Reasons[name] = fmt.Sprintf("%s: %s", state, reason)
+		if state.severity() > r.Status.severity() {
+			r.Status = state
+		}
+	}
+
+	for _, s := range []healthState{healthHealthy, healthDegraded, healthUnhealthy} {
+		v := 0.0
+		if s == r.Status {
+			v = 1
+		}
+		healthStateGauge.WithLabelValues(string(s)).Set(v)
+	}
+	return r
+}
+
+// ServeHTTP serves the health report as JSON. Degraded webhooks still report
+// ready, only an unhealthy one answers 503.
+func (h *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.report()
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == healthUnhealthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
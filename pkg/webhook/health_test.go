@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthChecker(t *testing.T) {
+	h := newHealthChecker()
+	h.register("a", func() (healthState, string) { return healthHealthy, "" })
+
+	if r := h.report(); r.Status != healthHealthy || len(r.Reasons) != 0 {
+		t.Errorf("expected healthy report, got %+v", r)
+	}
+
+	h.register("b", func() (healthState, string) { return healthDegraded, "zone backing off" })
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected degraded webhook to be ready, got %d", rec.Code)
+	}
+	var r healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != healthDegraded || r.Reasons["b"] != "degraded: zone backing off" {
+		t.Errorf("unexpected report %+v", r)
+	}
+
+	h.register("c", func() (healthState, string) { return healthUnhealthy, "no client" })
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected unhealthy webhook to answer 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// hookJobTimeout bounds the wait for the Job of a pre hook.
+	hookJobTimeout = 2 * time.Minute
+	// hookJobTTL is how long finished hook Jobs are kept if their template
+	// doesn't set ttlSecondsAfterFinished.
+	hookJobTTL = int32(3600)
+	// hookPhaseLabel is the label of hook Jobs holding their phase.
+	hookPhaseLabel = "dode.acme.webhook/hook-phase"
+)
+
+// jobHooks runs a Job around the changes the webhook makes to DNS, for
+// hooks that must run in the cluster, e.g. with access to an internal cache
+// or with credentials of their own. The Job is created from a template the
+// operator supplies, so whoever may create Issuers can't make the webhook
+// run workloads of their choosing, and is passed the challenge in HOOK_*
+// environment variables. The webhook waits for the Jobs of pre hooks, and a
+// failing one aborts the operation; the Jobs of post hooks are only created.
+type jobHooks struct {
+	client    kubernetes.Interface
+	namespace string
+	template  *batchv1.Job
+	phases    map[string]bool
+	poll      time.Duration
+	timeout   time.Duration
+}
+
+// newJobHooks returns hooks creating Jobs from the manifest in templateFile
+// in namespace in the comma separated phases.
+func newJobHooks(client kubernetes.Interface, templateFile, namespace, phases string) (*jobHooks, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("--%shook-job-template needs --%shook-job-namespace", flagPrefix, flagPrefix)
+	}
+	f, err := os.Open(templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("--%shook-job-template: %v", flagPrefix, err)
+	}
+	defer f.Close()
+	var job batchv1.Job
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&job); err != nil {
+		return nil, fmt.Errorf("--%shook-job-template: decoding %s: %v", flagPrefix, templateFile, err)
+	}
+	if job.Kind != "" && job.Kind != "Job" {
+		return nil, fmt.Errorf("--%shook-job-template: %s holds a %s, expected a Job", flagPrefix, templateFile, job.Kind)
+	}
+	if len(job.Spec.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("--%shook-job-template: the Job in %s has no containers", flagPrefix, templateFile)
+	}
+	h := &jobHooks{
+		client:    client,
+		namespace: namespace,
+		template:  &job,
+		poll:      2 * time.Second,
+		timeout:   hookJobTimeout,
+	}
+	if h.phases, err = parseHookPhases(phases); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// run creates the Job for phase if it is enabled, and waits for it to
+// finish for pre hooks. It does nothing if h is nil.
+func (h *jobHooks) run(ctx context.Context, phase string, ch *v1alpha1.ChallengeRequest, opErr error) error {
+	if h == nil || !h.phases[phase] {
+		return nil
+	}
+	job, err := h.client.BatchV1().Jobs(h.namespace).Create(ctx, h.job(phase, ch, opErr), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("%s hook: creating Job: %v", phase, err)
+	}
+	if !strings.HasPrefix(phase, "pre-") {
+		return nil
+	}
+	return h.wait(ctx, phase, job.Name)
+}
+
+// job returns the Job of the template for phase of ch.
+func (h *jobHooks) job(phase string, ch *v1alpha1.ChallengeRequest, opErr error) *batchv1.Job {
+	job := h.template.DeepCopy()
+	name := job.Name
+	if name == "" {
+		name = "dode-hook"
+	}
+	job.ObjectMeta = metav1.ObjectMeta{
+		GenerateName: name + "-",
+		Namespace:    h.namespace,
+		Labels:       job.Labels,
+		Annotations:  job.Annotations,
+	}
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[hookPhaseLabel] = phase
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := hookJobTTL
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	pod := &job.Spec.Template.Spec
+	if pod.RestartPolicy == "" {
+		pod.RestartPolicy = corev1.RestartPolicyNever
+	}
+	env := []corev1.EnvVar{
+		{Name: "HOOK_PHASE", Value: phase},
+		{Name: "HOOK_UID", Value: string(ch.UID)},
+		{Name: "HOOK_NAMESPACE", Value: ch.ResourceNamespace},
+		{Name: "HOOK_FQDN", Value: ch.ResolvedFQDN},
+		{Name: "HOOK_ZONE", Value: ch.ResolvedZone},
+	}
+	if opErr != nil {
+		env = append(env, corev1.EnvVar{Name: "HOOK_ERROR", Value: opErr.Error()})
+	}
+	for i := range pod.InitContainers {
+		pod.InitContainers[i].Env = append(pod.InitContainers[i].Env, env...)
+	}
+	for i := range pod.Containers {
+		pod.Containers[i].Env = append(pod.Containers[i].Env, env...)
+	}
+	return job
+}
+
+// wait waits for the Job name to complete, returning an error if it failed
+// or didn't finish within h.timeout.
+func (h *jobHooks) wait(ctx context.Context, phase, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	var (
+		failed  bool
+		message string
+	)
+	err := wait.PollImmediateUntil(h.poll, func() (bool, error) {
+		job, err := h.client.BatchV1().Jobs(h.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				failed, message = true, c.Message
+				return true, nil
+			}
+		}
+		return false, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("%s hook: Job %s/%s didn't finish within %v", phase, h.namespace, name, h.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook: checking Job %s/%s: %v", phase, h.namespace, name, err)
+	}
+	if failed {
+		return fmt.Errorf("%s hook: Job %s/%s failed: %s", phase, h.namespace, name, message)
+	}
+	return nil
+}
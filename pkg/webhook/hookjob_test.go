@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testHookJob = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: purge-cache
+spec:
+  template:
+    spec:
+      containers:
+        - name: purge
+          image: example.com/purge
+`
+
+// newTestJobHooks returns Job hooks for testHookJob in the namespace
+// cert-manager, whose Jobs finish with the condition returned by finish.
+func newTestJobHooks(t *testing.T, phases string, finish func(job *batchv1.Job) batchv1.JobConditionType) (*jobHooks, *fake.Clientset) {
+	dir, err := ioutil.TempDir("", "hookjob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, "job.yaml")
+	if err := ioutil.WriteFile(file, []byte(testHookJob), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewSimpleClientset()
+	// The fake clientset doesn't generate names or run Jobs.
+	created := 0
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		created++
+		job.Name = fmt.Sprintf("%s%d", job.GenerateName, created)
+		job.Status.Conditions = []batchv1.JobCondition{{Type: finish(job), Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+		return false, nil, nil
+	})
+	h, err := newJobHooks(client, file, "cert-manager", phases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.poll = time.Millisecond
+	return h, client
+}
+
+func TestJobHooks(t *testing.T) {
+	fail := batchv1.JobConditionType("")
+	h, client := newTestJobHooks(t, "pre-present,post-present", func(job *batchv1.Job) batchv1.JobConditionType {
+		if fail != "" && job.Labels[hookPhaseLabel] == hookPrePresent {
+			return fail
+		}
+		return batchv1.JobComplete
+	})
+	c := &dodeDNSProviderSolver{hooks: []hook{h}}
+	ch := &v1alpha1.ChallengeRequest{UID: "uid", ResourceNamespace: "team-a", ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com."}
+	ctx := context.Background()
+
+	if err := c.withHooks(ctx, "present", ch, func() error { return errors.New("boom") }); err == nil || err.Error() != "boom" {
+		t.Errorf("expected the operation's error, got %v", err)
+	}
+	jobs, _ := client.BatchV1().Jobs("cert-manager").List(ctx, metav1.ListOptions{})
+	if len(jobs.Items) != 2 {
+		t.Fatalf("expected a Job per phase, got %d", len(jobs.Items))
+	}
+	env := map[string]string{}
+	for _, job := range jobs.Items {
+		if job.Labels[hookPhaseLabel] != hookPostPresent {
+			continue
+		}
+		if !strings.HasPrefix(job.Name, "purge-cache-") || job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever || job.Spec.TTLSecondsAfterFinished == nil {
+			t.Errorf("unexpected Job %s: %+v", job.Name, job.Spec)
+		}
+		for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+	}
+	if env["HOOK_PHASE"] != hookPostPresent || env["HOOK_NAMESPACE"] != "team-a" || env["HOOK_FQDN"] != ch.ResolvedFQDN || env["HOOK_ERROR"] != "boom" {
+		t.Errorf("expected the challenge in the environment of the post hook, got %v", env)
+	}
+
+	fail = batchv1.JobFailed
+	called := false
+	err := c.withHooks(ctx, "present", ch, func() error { called = true; return nil })
+	if called || errorClass(err) != errorClassHook || !strings.Contains(err.Error(), "BackoffLimitExceeded") {
+		t.Errorf("expected a failing pre hook Job to abort the operation, got %v", err)
+	}
+
+	if err := c.withHooks(ctx, "cleanup", ch, func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+	if jobs, _ := client.BatchV1().Jobs("cert-manager").List(ctx, metav1.ListOptions{}); len(jobs.Items) != 3 {
+		t.Errorf("expected no Jobs for disabled phases, got %d Jobs", len(jobs.Items))
+	}
+}
+
+func TestJobHooksTimeout(t *testing.T) {
+	h, _ := newTestJobHooks(t, "pre-cleanup", func(*batchv1.Job) batchv1.JobConditionType {
+		return batchv1.JobConditionType("Running")
+	})
+	h.timeout = 20 * time.Millisecond
+	ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com."}
+	if err := h.run(context.Background(), hookPreCleanUp, ch, nil); err == nil || !strings.Contains(err.Error(), "didn't finish") {
+		t.Errorf("expected the pre hook to time out, got %v", err)
+	}
+}
+
+func TestNewJobHooksInvalid(t *testing.T) {
+	if _, err := newJobHooks(fake.NewSimpleClientset(), "job.yaml", "", "post-present"); err == nil {
+		t.Error("expected a missing namespace to be refused")
+	}
+	if _, err := newJobHooks(fake.NewSimpleClientset(), filepath.Join(os.TempDir(), "missing-hook-job.yaml"), "cert-manager", "post-present"); err == nil {
+		t.Error("expected a missing template to be refused")
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog"
+)
+
+// Phases hooks can run in.
+const (
+	hookPrePresent  = "pre-present"
+	hookPostPresent = "post-present"
+	hookPreCleanUp  = "pre-cleanup"
+	hookPostCleanUp = "post-cleanup"
+)
+
+var hookPhases = []string{hookPrePresent, hookPostPresent, hookPreCleanUp, hookPostCleanUp}
+
+// hook is run around the changes the webhook makes to DNS, in the phases it
+// is enabled for.
+type hook interface {
+	run(ctx context.Context, phase string, ch *v1alpha1.ChallengeRequest, opErr error) error
+}
+
+// parseHookPhases parses the comma separated phases of --dode.hook-phases.
+func parseHookPhases(phases string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, phase := range strings.Split(phases, ",") {
+		phase = strings.TrimSpace(phase)
+		if !containsString(hookPhases, phase) {
+			return nil, fmt.Errorf("unknown hook phase %q in --dode.hook-phases, expected some of %s", phase, strings.Join(hookPhases, ","))
+		}
+		enabled[phase] = true
+	}
+	return enabled, nil
+}
+
+// httpHooks calls an HTTP endpoint around the changes the webhook makes to
+// DNS, e.g. to purge a downstream cache or to record the change in a change
+// management system. A failing pre hook aborts the operation; post hooks
+// run whether the operation failed or not, and their failures are only
+// logged.
+type httpHooks struct {
+	url    string
+	phases map[string]bool
+	client *http.Client
+}
+
+// newHTTPHooks returns hooks posting to hookURL in the comma separated
+// phases.
+func newHTTPHooks(hookURL, phases string) (*httpHooks, error) {
+	u, err := url.Parse(hookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("--dode.hook-url must be an http or https URL, got %q", hookURL)
+	}
+	h := &httpHooks{
+		url:    hookURL,
+		client: egressClient(10 * time.Second),
+	}
+	if h.phases, err = parseHookPhases(phases); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// hookPayload is posted to the hook endpoint.
+type hookPayload struct {
+	Phase     string `json:"phase"`
+	UID       string `json:"uid"`
+	Namespace string `json:"namespace"`
+	FQDN      string `json:"fqdn"`
+	Zone      string `json:"zone"`
+	// Error is the error of the operation, for post hooks.
+	Error string `json:"error,omitempty"`
+}
+
+// run calls the hook for phase if it is enabled. It does nothing if h is nil.
+func (h *httpHooks) run(ctx context.Context, phase string, ch *v1alpha1.ChallengeRequest, opErr error) error {
+	if h == nil || !h.phases[phase] {
+		return nil
+	}
+	p := hookPayload{
+		Phase:     phase,
+		UID:       string(ch.UID),
+		Namespace: ch.ResourceNamespace,
+		FQDN:      ch.ResolvedFQDN,
+		Zone:      ch.ResolvedZone,
+	}
+	if opErr != nil {
+		p.Error = opErr.Error()
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %v", phase, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s hook returned %s", phase, resp.Status)
+	}
+	return nil
+}
+
+// withHooks runs mutate, which changes the records of ch, between the pre and
+// post hooks of action ("present" or "cleanup").
+func (c *dodeDNSProviderSolver) withHooks(ctx context.Context, action string, ch *v1alpha1.ChallengeRequest, mutate func() error) error {
+	for _, h := range c.hooks {
+		if err := h.run(ctx, "pre-"+action, ch, nil); err != nil {
+			return classify(errorClassHook, err)
+		}
+	}
+	err := mutate()
+	for _, h := range c.hooks {
+		if hookErr := h.run(ctx, "post-"+action, ch, err); hookErr != nil {
+			klog.Warningf("%v", hookErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestWithHooks(t *testing.T) {
+	var phases []string
+	fail := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p hookPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		phases = append(phases, p.Phase+":"+p.Error)
+		if p.Phase == fail {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+
+	hooks, err := newHTTPHooks(srv.URL, "pre-present, post-present")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &dodeDNSProviderSolver{hooks: []hook{hooks}}
+	ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com."}
+	ctx := context.Background()
+
+	err = c.withHooks(ctx, "present", ch, func() error { return errors.New("boom") })
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("expected the operation's error, got %v", err)
+	}
+	if want := []string{"pre-present:", "post-present:boom"}; len(phases) != 2 || phases[0] != want[0] || phases[1] != want[1] {
+		t.Errorf("expected phases %q, got %q", want, phases)
+	}
+
+	phases, fail = nil, hookPrePresent
+	called := false
+	err = c.withHooks(ctx, "present", ch, func() error { called = true; return nil })
+	if called || errorClass(err) != errorClassHook {
+		t.Errorf("expected failing pre hook to abort the operation, got %v", err)
+	}
+
+	phases = nil
+	if err := c.withHooks(ctx, "cleanup", ch, func() error { return nil }); err != nil || len(phases) != 0 {
+		t.Errorf("expected disabled phases not to be called, got %v, %q", err, phases)
+	}
+
+	if _, err := newHTTPHooks(srv.URL, "after-present"); err == nil {
+		t.Errorf("expected unknown phase to be rejected")
+	}
+}
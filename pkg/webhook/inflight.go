@@ -0,0 +1,34 @@
+package webhook
+
+import "sync"
+
+// inFlight counts the Present and CleanUp calls currently being handled per
+// action, and the highest count seen since the webhook started. Both are
+// exported so that replica counts can be tuned to real demand.
+type inFlight struct {
+	mu      sync.Mutex
+	current map[string]int
+	max     map[string]int
+}
+
+var challengesInFlight = &inFlight{current: map[string]int{}, max: map[string]int{}}
+
+// start records the start of an operation and returns the function that
+// records its end.
+func (f *inFlight) start(action string) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current[action]++
+	inFlightChallenges.WithLabelValues(action).Set(float64(f.current[action]))
+	if f.current[action] > f.max[action] {
+		f.max[action] = f.current[action]
+		maxInFlightChallenges.WithLabelValues(action).Set(float64(f.max[action]))
+	}
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.current[action]--
+		inFlightChallenges.WithLabelValues(action).Set(float64(f.current[action]))
+	}
+}
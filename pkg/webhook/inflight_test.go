@@ -0,0 +1,21 @@
+package webhook
+
+import "testing"
+
+func TestInFlight(t *testing.T) {
+	f := &inFlight{current: map[string]int{}, max: map[string]int{}}
+	done1 := f.start("Present")
+	done2 := f.start("Present")
+	f.start("CleanUp")()
+	done1()
+	done3 := f.start("Present")
+	done2()
+	done3()
+
+	if f.current["Present"] != 0 || f.current["CleanUp"] != 0 {
+		t.Errorf("expected no operations in flight, got %v", f.current)
+	}
+	if f.max["Present"] != 2 || f.max["CleanUp"] != 1 {
+		t.Errorf("unexpected maximum concurrency %v", f.max)
+	}
+}
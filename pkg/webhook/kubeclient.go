@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"fmt"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+)
+
+// kubeClient hands out the clientset the solver reads Secrets with. Once the
+// API server rejected the credentials of the clientset, e.g. because the
+// service account token was rotated, it is dropped and the next get builds a
+// new one from the rest config, which reads the token file again.
+type kubeClient struct {
+	config    *rest.Config
+	newClient func(*rest.Config) (kubernetes.Interface, error)
+
+	mu     sync.Mutex
+	client kubernetes.Interface
+}
+
+// newKubeClient returns a kubeClient handing out client until it has to be
+// rebuilt from config.
+func newKubeClient(config *rest.Config, client kubernetes.Interface) *kubeClient {
+	return &kubeClient{
+		config: config,
+		newClient: func(config *rest.Config) (kubernetes.Interface, error) {
+			return kubernetes.NewForConfig(config)
+		},
+		client: client,
+	}
+}
+
+// staticKubeClient returns a kubeClient that always hands out client.
+func staticKubeClient(client kubernetes.Interface) *kubeClient {
+	return &kubeClient{client: client}
+}
+
+// get returns the current clientset, building a new one if it was dropped.
+// It returns nil if k is nil or has neither a clientset nor a rest config.
+func (k *kubeClient) get() (kubernetes.Interface, error) {
+	if k == nil {
+		return nil, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.client == nil && k.config != nil {
+		cl, err := k.newClient(k.config)
+		if err != nil {
+			return nil, fmt.Errorf("rebuilding Kubernetes client: %v", err)
+		}
+		klog.Infof("rebuilt Kubernetes client for %s", k.config.Host)
+		k.client = cl
+	}
+	return k.client, nil
+}
+
+// observe drops client if err shows that the API server rejected its
+// credentials. Clientsets that can't be rebuilt are kept, as are newer ones
+// built since client was handed out.
+func (k *kubeClient) observe(client kubernetes.Interface, err error) {
+	if k == nil || k.config == nil || !apierrors.IsUnauthorized(err) {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.client == client {
+		klog.Warningf("Kubernetes API server rejected the credentials of the webhook, rebuilding the client: %v", err)
+		k.client = nil
+	}
+}
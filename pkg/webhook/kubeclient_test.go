@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestKubeClientRebuildsAfterUnauthorized(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		builds int
+	)
+	k := &kubeClient{
+		config: &rest.Config{Host: "https://kubernetes.default.svc"},
+		newClient: func(*rest.Config) (kubernetes.Interface, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			builds++
+			return fake.NewSimpleClientset(), nil
+		},
+		client: fake.NewSimpleClientset(),
+	}
+
+	first, err := k.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.observe(first, errors.New("connection refused"))
+	if cl, _ := k.get(); cl != first || builds != 0 {
+		t.Errorf("expected the client to be kept after other errors")
+	}
+
+	// Concurrent challenges all seeing the rejected credentials rebuild the
+	// client once.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k.observe(first, apierrors.NewUnauthorized("token expired"))
+			if cl, err := k.get(); err != nil || cl == nil || cl == first {
+				t.Errorf("expected a new client, got %v, %v", cl, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if builds != 1 {
+		t.Errorf("expected the client to be rebuilt once, got %d", builds)
+	}
+}
+
+func TestStaticKubeClientIsKept(t *testing.T) {
+	cl := fake.NewSimpleClientset()
+	k := staticKubeClient(cl)
+	k.observe(cl, apierrors.NewUnauthorized("token expired"))
+	if got, err := k.get(); err != nil || got != cl {
+		t.Errorf("expected the static client to be kept, got %v, %v", got, err)
+	}
+
+	var none *kubeClient
+	if got, err := none.get(); err != nil || got != nil {
+		t.Errorf("expected no client, got %v, %v", got, err)
+	}
+}
+
+func TestInitializeOnlyOnce(t *testing.T) {
+	c := newDodeDNSProviderSolver(fake.NewSimpleClientset(), nil)
+	c.initialized = true
+	kube := c.kube
+
+	// A nil config would make a second setup fail.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Initialize(nil, nil); err != nil {
+				t.Errorf("Initialize: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.kube != kube {
+		t.Errorf("expected the solver to keep its setup")
+	}
+}
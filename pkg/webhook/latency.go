@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// startAPICall records an API call made for zone in the result carried by
+// ctx, if any. The returned function must be called when the call returned
+// to record its latency.
+func startAPICall(ctx context.Context, zone string) func() {
+	countAttempt(ctx)
+	start := time.Now()
+	observeFirstAPICall(ctx, start)
+	return func() {
+		observeAPILatency(ctx, zone, time.Since(start))
+	}
+}
+
+// observeAPILatency keeps d as the maximum API latency of the result carried
+// by ctx, and counts the call as slow if it exceeded --dode.slow-api-threshold.
+func observeAPILatency(ctx context.Context, zone string, d time.Duration) {
+	if *slowAPIThreshold > 0 && d > *slowAPIThreshold {
+		slowAPICalls.WithLabelValues(normalizeName(zone)).Inc()
+	}
+	r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult)
+	if !ok {
+		return
+	}
+	max := (*int64)(&r.MaxAPILatency)
+	for {
+		cur := atomic.LoadInt64(max)
+		if int64(d) <= cur || atomic.CompareAndSwapInt64(max, cur, int64(d)) {
+			return
+		}
+	}
+}
+
+// observeFirstAPICall records the delay until the first API call of the
+// result carried by ctx, started at start. A delay growing while the API
+// latency doesn't means the webhook is overloaded, e.g. challenges queue for
+// the lock of their record name, rather than do.de being slow.
+func observeFirstAPICall(ctx context.Context, start time.Time) {
+	r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult)
+	if !ok || r.start.IsZero() {
+		return
+	}
+	// Zero stands for no call yet.
+	d := start.Sub(r.start)
+	if d <= 0 {
+		d = 1
+	}
+	if atomic.CompareAndSwapInt64((*int64)(&r.FirstAPICallDelay), 0, int64(d)) {
+		timeToFirstAPICall.WithLabelValues(r.Action).Observe(d.Seconds())
+	}
+}
+
+func (r *ChallengeResult) firstAPICallDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&r.FirstAPICallDelay)))
+}
+
+func (r *ChallengeResult) maxAPILatency() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&r.MaxAPILatency)))
+}
+
+// reportSlowAPI emits a warning Event on the Secret of the token the
+// operation r used last, after zoneTokens and failovers, if its slowest API
+// call exceeded --dode.slow-api-threshold, so that a provider getting slower
+// is noticed before calls start to run into cert-manager's timeouts. It must
+// be deferred.
+func (c *dodeDNSProviderSolver) reportSlowAPI(r *ChallengeResult) {
+	latency := r.maxAPILatency()
+	if *slowAPIThreshold <= 0 || latency <= *slowAPIThreshold {
+		return
+	}
+	klog.Warningf("slowest DODE API call for %s took %v, more than the threshold of %v", r.FQDN, latency, *slowAPIThreshold)
+	ref := r.tokenRef()
+	if c.recorder == nil || ref.Name == "" {
+		return
+	}
+	namespace, err := c.secretNamespace(&ref, r.Namespace)
+	if err != nil {
+		return
+	}
+	c.recorder.Eventf(secretReference(namespace, ref.Name), corev1.EventTypeWarning, reasonSlowAPIResponse,
+		"%s of %s: slowest DODE API call took %v, more than the threshold of %v%s", r.Action, r.FQDN, latency.Round(time.Millisecond), *slowAPIThreshold, r.traceSuffix())
+}
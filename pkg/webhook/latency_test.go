@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReportSlowAPI(t *testing.T) {
+	defer func(d time.Duration) { *slowAPIThreshold = d }(*slowAPIThreshold)
+	*slowAPIThreshold = time.Second
+
+	res := &ChallengeResult{Action: "Present", Namespace: "default", FQDN: "_acme-challenge.example.com."}
+	ctx := withChallengeResult(context.Background(), res)
+	observeAPILatency(ctx, "example.com.", 3*time.Second)
+	observeAPILatency(ctx, "example.com.", 500*time.Millisecond)
+	if got := res.maxAPILatency(); got != 3*time.Second {
+		t.Errorf("expected the slowest call to be kept, got %v", got)
+	}
+
+	recorder := record.NewFakeRecorder(1)
+	c := &dodeDNSProviderSolver{recorder: recorder}
+	res.tokenRefs = []secretKeySelector{{Name: "dode"}}
+	c.reportSlowAPI(res)
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, reasonSlowAPIResponse) {
+			t.Errorf("unexpected event %q", e)
+		}
+	default:
+		t.Fatal("expected a warning event")
+	}
+
+	*slowAPIThreshold = 5 * time.Second
+	c.reportSlowAPI(res)
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event below the threshold, got %q", <-recorder.Events)
+	}
+}
+
+// objectRecorder records the objects of the Events emitted.
+type objectRecorder struct {
+	record.FakeRecorder
+	objects []runtime.Object
+}
+
+func (r *objectRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.objects = append(r.objects, object)
+}
+
+func TestReportSlowAPITarget(t *testing.T) {
+	defer func(d time.Duration) { *slowAPIThreshold = d }(*slowAPIThreshold)
+	*slowAPIThreshold = time.Second
+
+	c := &dodeDNSProviderSolver{secretNamespaces: map[string]bool{"cert-manager": true}}
+	for _, test := range []struct {
+		name      string
+		refs      []secretKeySelector
+		failovers int
+		want      string
+	}{
+		{name: "secret of another namespace", refs: []secretKeySelector{{Namespace: "cert-manager", Name: "dode"}}, want: "cert-manager/dode"},
+		{name: "first of the rotated secrets", refs: []secretKeySelector{{Name: "old"}, {Name: "new"}}, want: "default/old"},
+		{name: "secret failed over to", refs: []secretKeySelector{{Name: "old"}, {Name: "new"}}, failovers: 1, want: "default/new"},
+		{name: "token not read from a secret", refs: []secretKeySelector{{}}},
+	} {
+		recorder := &objectRecorder{}
+		c.recorder = recorder
+		res := &ChallengeResult{Action: "Present", Namespace: "default", tokenRefs: test.refs}
+		ctx := withChallengeResult(context.Background(), res)
+		observeAPILatency(ctx, "example.com.", 3*time.Second)
+		observeTokenUsed(ctx, test.failovers)
+		c.reportSlowAPI(res)
+
+		var got string
+		if len(recorder.objects) > 0 {
+			ref := recorder.objects[0].(*corev1.ObjectReference)
+			got = ref.Namespace + "/" + ref.Name
+		}
+		if got != test.want {
+			t.Errorf("%s: expected an event on %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestObserveFirstAPICall(t *testing.T) {
+	start := time.Now()
+	res := &ChallengeResult{Action: "Present", start: start}
+	ctx := withChallengeResult(context.Background(), res)
+	if !strings.Contains(res.String(), "time_to_first_api_call=0s") {
+		t.Errorf("expected no delay before the first call, got %s", res)
+	}
+	observeFirstAPICall(ctx, start.Add(2*time.Second))
+	observeFirstAPICall(ctx, start.Add(5*time.Second))
+	if got := res.firstAPICallDelay(); got != 2*time.Second {
+		t.Errorf("expected the delay until the first call, got %v", got)
+	}
+	if !strings.Contains(res.String(), "time_to_first_api_call=2s") {
+		t.Errorf("expected the delay in the result line, got %s", res)
+	}
+}
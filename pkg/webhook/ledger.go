@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// recordLedger tracks the TXT values the webhook has presented and not yet
+// cleaned up, per record name. The do.de API can only delete all values at a
+// name at once, so the ledger is what allows CleanUp of one challenge to
+// restore the values of other challenges sharing the same name, e.g. when
+// example.com and *.example.com are validated concurrently.
+type recordLedger struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	locks  map[string]*sync.Mutex
+	values map[string]map[string]time.Time // domain -> value -> presented at
+}
+
+func newRecordLedger() *recordLedger {
+	return &recordLedger{
+		now:    time.Now,
+		locks:  map[string]*sync.Mutex{},
+		values: map[string]map[string]time.Time{},
+	}
+}
+
+// lock serializes all record changes at domain and returns the function
+// releasing the lock.
+func (l *recordLedger) lock(domain string) func() {
+	l.mu.Lock()
+	m, ok := l.locks[domain]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[domain] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// add records that value is present at domain.
+func (l *recordLedger) add(domain, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.values[domain] == nil {
+		l.values[domain] = map[string]time.Time{}
+	}
+	if _, ok := l.values[domain][value]; !ok {
+		l.values[domain][value] = l.now()
+	}
+}
+
+// remove forgets value at domain.
+func (l *recordLedger) remove(domain, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.values[domain], value)
+	if len(l.values[domain]) == 0 {
+		delete(l.values, domain)
+	}
+}
+
+// has reports whether value is present at domain.
+func (l *recordLedger) has(domain, value string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.values[domain][value]
+	return ok
+}
+
+// others returns the values present at domain other than value, sorted.
+func (l *recordLedger) others(domain, value string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var vs []string
+	for v := range l.values[domain] {
+		if v != value {
+			vs = append(vs, v)
+		}
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// byAge returns the values present at domain, oldest first.
+func (l *recordLedger) byAge(domain string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	vs := make([]string, 0, len(l.values[domain]))
+	for v := range l.values[domain] {
+		vs = append(vs, v)
+	}
+	times := l.values[domain]
+	sort.Slice(vs, func(i, j int) bool {
+		if times[vs[i]].Equal(times[vs[j]]) {
+			return vs[i] < vs[j]
+		}
+		return times[vs[i]].Before(times[vs[j]])
+	})
+	return vs
+}
+
+// addRecord presents value at domain with ttl through api unless it was
+// presented recently. If maxValues is positive and the webhook already tracks that many values at
+// domain, the oldest ones are pruned first.
+func (c *dodeDNSProviderSolver) addRecord(ctx context.Context, api dodeAPI, token, zone, domain, value string, ttl, maxValues int) error {
+	unlock := c.ledger.lock(domain)
+	defer unlock()
+
+	if c.records.has(domain, value) {
+		klog.V(4).Infof("TXT record for %s was presented recently, skipping API call", domain)
+		return nil
+	}
+	if err := c.backoff.check(zone); err != nil {
+		return classify(errorClassBackoff, err)
+	}
+	if maxValues > 0 {
+		if err := c.pruneRecords(ctx, api, token, zone, domain, ttl, maxValues-1); err != nil {
+			return err
+		}
+	}
+	done := startAPICall(ctx, zone)
+	err := api.Present(ctx, token, domain, value, ttl)
+	done()
+	c.backoff.observe(zone, err)
+	if err != nil {
+		return classify(errorClassProvider, err)
+	}
+	c.records.add(domain, value)
+	c.ledger.add(domain, value)
+	return nil
+}
+
+// pruneRecords makes sure at most keep values tracked by the webhook remain
+// at domain by deleting the oldest ones. The caller must hold the lock of
+// domain.
+func (c *dodeDNSProviderSolver) pruneRecords(ctx context.Context, api dodeAPI, token, zone, domain string, ttl, keep int) error {
+	values := c.ledger.byAge(domain)
+	if len(values) <= keep {
+		return nil
+	}
+	kept := values[len(values)-keep:]
+	_, pruned := diffValues(values, kept)
+	klog.Infof("pruning %d old TXT records at %s to stay below the configured maximum", len(pruned), domain)
+
+	c.records.invalidate(domain)
+	done := startAPICall(ctx, zone)
+	err := api.CleanUp(ctx, token, domain)
+	done()
+	c.backoff.observe(zone, err)
+	if err != nil {
+		return classify(errorClassProvider, err)
+	}
+	for _, v := range pruned {
+		c.ledger.remove(domain, v)
+	}
+	return c.restoreRecords(ctx, api, token, zone, domain, ttl, kept)
+}
+
+// removeRecord removes value from domain. As the API deletes every value at
+// the name, the values of other challenges still in progress at the same name
+// are presented again afterwards with ttl.
+func (c *dodeDNSProviderSolver) removeRecord(ctx context.Context, api dodeAPI, token, zone, domain, value string, ttl int) error {
+	unlock := c.ledger.lock(domain)
+	defer unlock()
+
+	if err := c.backoff.check(zone); err != nil {
+		return classify(errorClassBackoff, err)
+	}
+	others := c.ledger.others(domain, value)
+	c.records.invalidate(domain)
+	done := startAPICall(ctx, zone)
+	err := api.CleanUp(ctx, token, domain)
+	done()
+	c.backoff.observe(zone, err)
+	if err != nil {
+		return classify(errorClassProvider, err)
+	}
+	c.ledger.remove(domain, value)
+
+	if len(others) > 0 {
+		klog.V(4).Infof("restoring %d TXT records of other challenges at %s", len(others), domain)
+	}
+	return c.restoreRecords(ctx, api, token, zone, domain, ttl, others)
+}
+
+// restoreRecords presents values again at domain after all values there were
+// deleted. The values are presented concurrently; the first failure cancels
+// the calls still in flight, and the error names every value that failed
+// before that, so that the challenges left without their record can be told
+// apart from those cancelled on their behalf. The caller must hold the lock
+// of domain.
+func (c *dodeDNSProviderSolver) restoreRecords(ctx context.Context, api dodeAPI, token, zone, domain string, ttl int, values []string) error {
+	values = normalizeValues(values)
+	g, gctx := errgroup.WithContext(ctx)
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, v := range values {
+		v := v
+		g.Go(func() error {
+			if gctx.Err() != nil {
+				return gctx.Err()
+			}
+			done := startAPICall(gctx, zone)
+			err := api.Present(gctx, token, domain, v, ttl)
+			done()
+			if err != nil {
+				mu.Lock()
+				// Calls failing because of the cancellation are not worth
+				// reporting; the failure that caused it is.
+				if len(errs) == 0 || gctx.Err() == nil {
+					errs = append(errs, fmt.Errorf("%s (key %s): %v", domain, keyDigest(v), err))
+				}
+				mu.Unlock()
+				return err
+			}
+			c.records.add(domain, v)
+			return nil
+		})
+	}
+	if g.Wait() == nil {
+		return nil
+	}
+	return classify(errorClassProvider, fmt.Errorf("restoring TXT records of other challenges: %v", utilerrors.NewAggregate(errs)))
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// fakeDodeAPI emulates the do.de API: presenting adds a value at a name and
+// deleting removes every value at the name.
+type fakeDodeAPI struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	records map[string][]string
+	calls   int
+}
+
+func newFakeDodeAPI(token string) *fakeDodeAPI {
+	f := &fakeDodeAPI{records: map[string][]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls++
+
+		q := r.URL.Query()
+		if q.Get("token") != token {
+			fmt.Fprint(w, `{"success":false,"error":"invalid token"}`)
+			return
+		}
+		domain := q.Get("domain")
+		if q.Get("action") == "delete" {
+			delete(f.records, domain)
+		} else {
+			f.records[domain] = append(f.records[domain], q.Get("value"))
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	}))
+	return f
+}
+
+func (f *fakeDodeAPI) values(domain string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vs := append([]string(nil), f.records[domain]...)
+	sort.Strings(vs)
+	return vs
+}
+
+// newTestSolver returns a solver talking to api without a Kubernetes client.
+func newTestSolver(api *fakeDodeAPI) *dodeDNSProviderSolver {
+	client := dode.NewClient(dode.WithBaseURL(api.URL))
+	c := newDodeDNSProviderSolver(nil, client)
+	c.backoff = newZoneBackoff(time.Second, time.Second)
+	c.records = newRecordCache(time.Minute)
+	return c
+}
+
+// TestCleanUpKeepsConcurrentChallengeAtSameName covers the apex and wildcard
+// orders of a domain being validated concurrently: both challenges use the
+// same record name, and cleaning up one must not remove the other's value.
+func TestCleanUpKeepsConcurrentChallengeAtSameName(t *testing.T) {
+	api := newFakeDodeAPI("token")
+	defer api.Close()
+	c := newTestSolver(api)
+	ctx := context.Background()
+	const domain = "_acme-challenge.example.com"
+
+	for _, key := range []string{"apex-key", "wildcard-key"} {
+		if err := c.addRecord(ctx, c.api, "token", "example.com.", domain, key, defaultTTL, 0); err != nil {
+			t.Fatalf("presenting %s: %v", key, err)
+		}
+	}
+	if got, want := api.values(domain), []string{"apex-key", "wildcard-key"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if err := c.removeRecord(ctx, c.api, "token", "example.com.", domain, "apex-key", defaultTTL); err != nil {
+		t.Fatalf("cleaning up apex-key: %v", err)
+	}
+	if got, want := api.values(domain), []string{"wildcard-key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v after cleaning up the apex challenge, got %v", want, got)
+	}
+
+	if err := c.removeRecord(ctx, c.api, "token", "example.com.", domain, "wildcard-key", defaultTTL); err != nil {
+		t.Fatalf("cleaning up wildcard-key: %v", err)
+	}
+	if got := api.values(domain); len(got) != 0 {
+		t.Errorf("expected no values left, got %v", got)
+	}
+}
+
+func TestAddRecordPrunesOldestValues(t *testing.T) {
+	api := newFakeDodeAPI("token")
+	defer api.Close()
+	c := newTestSolver(api)
+	now := time.Unix(0, 0)
+	c.ledger.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	ctx := context.Background()
+	const domain = "_acme-challenge.example.com"
+
+	for _, key := range []string{"c", "b", "a", "d"} {
+		if err := c.addRecord(ctx, c.api, "token", "example.com.", domain, key, defaultTTL, 3); err != nil {
+			t.Fatalf("presenting %s: %v", key, err)
+		}
+	}
+	if got, want := api.values(domain), []string{"a", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the oldest value to be pruned, want %v, got %v", want, got)
+	}
+	if got, want := c.ledger.byAge(domain), []string{"b", "a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ledger content, want %v, got %v", want, got)
+	}
+}
+
+// blockingRestoreAPI fails presenting the value failing and blocks presenting
+// any other value until the request is cancelled.
+type blockingRestoreAPI struct {
+	failing string
+}
+
+func (a *blockingRestoreAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	if value == a.failing {
+		return fmt.Errorf("rate limited")
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (a *blockingRestoreAPI) CleanUp(ctx context.Context, token, domain string) error {
+	return nil
+}
+
+func TestRestoreRecordsCancelsOnFailure(t *testing.T) {
+	c := newDodeDNSProviderSolver(nil, nil)
+	c.records = newRecordCache(time.Minute)
+	api := &blockingRestoreAPI{failing: "b"}
+	const domain = "_acme-challenge.example.com"
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.restoreRecords(context.Background(), api, "token", "example.com.", domain, defaultTTL, []string{"a", "b", "c"})
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		msg := err.Error()
+		if !strings.Contains(msg, domain+" (key "+keyDigest("b")+"): rate limited") {
+			t.Errorf("expected the error to name the failing value, got %q", msg)
+		}
+		if strings.Contains(msg, "value a") || strings.Contains(msg, "value c") {
+			t.Errorf("expected cancelled calls not to be reported, got %q", msg)
+		}
+		if errorClass(err) != errorClassProvider {
+			t.Errorf("expected a provider error, got %v", errorClass(err))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("restoring didn't cancel the calls in flight")
+	}
+}
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Environment variables understood by lego's dode provider, which is used by
+// Traefik and others. Recognizing them lets users migrating from those tools
+// keep their existing configuration.
+const (
+	legoEnvToken              = "DODE_TOKEN"
+	legoEnvHTTPTimeout        = "DODE_HTTP_TIMEOUT"
+	legoEnvPollingInterval    = "DODE_POLLING_INTERVAL"
+	legoEnvPropagationTimeout = "DODE_PROPAGATION_TIMEOUT"
+)
+
+// legoEnv is the configuration read from lego's environment variables. Zero
+// values mean the variable is not set.
+type legoEnv struct {
+	// token is used for issuers without apiTokenSecretRef when cert-manager
+	// allows ambient credentials for them.
+	token              string
+	httpTimeout        time.Duration
+	pollingInterval    time.Duration
+	propagationTimeout time.Duration
+}
+
+// loadLegoEnv reads lego's environment variables using getenv. Durations are
+// given in seconds, like lego expects them.
+func loadLegoEnv(getenv func(string) string) (legoEnv, error) {
+	env := legoEnv{
+		token: getenv(legoEnvToken),
+	}
+	for name, d := range map[string]*time.Duration{
+		legoEnvHTTPTimeout:        &env.httpTimeout,
+		legoEnvPollingInterval:    &env.pollingInterval,
+		legoEnvPropagationTimeout: &env.propagationTimeout,
+	} {
+		v := getenv(name)
+		if v == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return env, fmt.Errorf("%s must be a positive number of seconds, got %q", name, v)
+		}
+		*d = time.Duration(seconds) * time.Second
+	}
+	return env, nil
+}
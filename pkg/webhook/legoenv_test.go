@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadLegoEnv(t *testing.T) {
+	vars := map[string]string{
+		"DODE_TOKEN":               "token",
+		"DODE_HTTP_TIMEOUT":        "10",
+		"DODE_PROPAGATION_TIMEOUT": "300",
+	}
+	env, err := loadLegoEnv(func(name string) string { return vars[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := legoEnv{token: "token", httpTimeout: 10 * time.Second, propagationTimeout: 5 * time.Minute}
+	if env != want {
+		t.Errorf("expected %+v, got %+v", want, env)
+	}
+
+	vars["DODE_POLLING_INTERVAL"] = "2s"
+	if _, err := loadLegoEnv(func(name string) string { return vars[name] }); err == nil {
+		t.Errorf("expected an error for a duration with unit")
+	}
+}
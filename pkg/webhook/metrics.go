@@ -0,0 +1,295 @@
+package webhook
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// metricsNamespace prefixes every metric exported by the webhook. Metrics are
+// registered with the Kubernetes legacy registry so that they are served on
+// the webhook apiserver's own /metrics endpoint.
+const metricsNamespace = "dode_webhook"
+
+var (
+	// zoneFailureStreak is the number of consecutive failed DODE API calls
+	// for a zone. Any non-zero value deserves attention: it usually means
+	// the token used for that zone has been revoked or lacks permissions.
+	zoneFailureStreak = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "zone_failure_streak",
+			Help:           "Number of consecutive failed DODE API calls per zone.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"zone"},
+	)
+
+	// zoneBackoffRejections counts challenges that were refused without
+	// calling the DODE API because their zone was still backing off.
+	zoneBackoffRejections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "zone_backoff_rejections_total",
+			Help:           "Number of challenge operations rejected because the zone was backing off.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"zone"},
+	)
+
+	// recoveredPanics counts panics in solver entry points that were turned
+	// into errors.
+	recoveredPanics = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "recovered_panics_total",
+			Help:           "Number of panics recovered in Present and CleanUp.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action"},
+	)
+
+	// challengeResults counts finished challenge operations by outcome and
+	// error class.
+	challengeResults = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "challenge_results_total",
+			Help:           "Number of finished Present and CleanUp operations by outcome and error class.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action", "outcome", "error_class"},
+	)
+
+	// challengeDuration is the time taken by Present and CleanUp, including
+	// waiting for propagation.
+	challengeDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "challenge_duration_seconds",
+			Help:           "Duration of Present and CleanUp operations.",
+			Buckets:        []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action", "outcome"},
+	)
+
+	// handlerDuration is the time taken by the serving library's handlers for
+	// the requests cert-manager makes to the solvers, including
+	// authentication, authorization and decoding.
+	handlerDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "handler_duration_seconds",
+			Help:           "Duration of the requests served to cert-manager by the solver API, by solver resource and status code.",
+			Buckets:        []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "code"},
+	)
+
+	// timeToFirstAPICall is the time from receiving a ChallengeRequest to
+	// the first DODE API call made for it, the part of challengeDuration
+	// spent in the webhook before the provider is involved.
+	timeToFirstAPICall = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "time_to_first_api_call_seconds",
+			Help:           "Time from receiving a Present or CleanUp request to its first DODE API call.",
+			Buckets:        []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action"},
+	)
+
+	// apiRequestDuration is the time taken by the requests to the DODE API,
+	// the provider's share of challengeDuration.
+	apiRequestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "api_request_duration_seconds",
+			Help:           "Duration of requests to the DODE API by operation (present, cleanup or other) and status code, error if there was no response.",
+			Buckets:        []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "code"},
+	)
+
+	// propagationDuration is the time it took a presented record to become
+	// visible to the quorum of resolvers, or until the check gave up.
+	propagationDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "propagation_duration_seconds",
+			Help:           "Time until a presented TXT record was visible to the propagation check's resolvers, per zone and outcome.",
+			Buckets:        []float64{1, 5, 10, 20, 30, 60, 120, 300, 600},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"zone", "outcome"},
+	)
+
+	// inFlightChallenges is the number of Present and CleanUp calls being
+	// handled right now.
+	inFlightChallenges = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "challenges_in_flight",
+			Help:           "Number of Present and CleanUp operations currently being handled.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action"},
+	)
+
+	// maxInFlightChallenges is the highest value inFlightChallenges has had
+	// since the webhook started.
+	maxInFlightChallenges = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "challenges_in_flight_max",
+			Help:           "Highest number of concurrent Present and CleanUp operations since the webhook started.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action"},
+	)
+
+	// apiMirrorResults counts requests mirrored to a secondary API endpoint
+	// by whether the secondary agreed with the primary on their outcome.
+	apiMirrorResults = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "api_mirror_results_total",
+			Help:           "Number of API requests mirrored to the secondary endpoint by operation and result (match or divergence).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "result"},
+	)
+
+	// slowAPICalls counts API calls that took longer than
+	// --dode.slow-api-threshold.
+	slowAPICalls = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "slow_api_calls_total",
+			Help:           "Number of DODE API calls per zone that took longer than the slow API threshold.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"zone"},
+	)
+
+	// quotaRejections counts Present operations and their API calls refused
+	// because their namespace used up an API quota.
+	quotaRejections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "quota_rejections_total",
+			Help:           "Number of Present operations and API calls rejected because the namespace exceeded its API quota, per namespace and quota period.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "period"},
+	)
+
+	// egressViolations counts outbound connections refused in strict egress
+	// mode.
+	egressViolations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "egress_violations_total",
+			Help:           "Number of outbound connections refused in strict egress mode, per kind (http or dns).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind"},
+	)
+
+	// clockSkew is how far the system clock was ahead of the clock of the
+	// DODE API at startup.
+	clockSkew = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "clock_skew_seconds",
+			Help:           "Difference between the system clock and the Date header of the DODE API at startup, positive if the system clock is ahead.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	// tokenFailovers counts calls retried with the next token of
+	// apiTokenSecretRefs.
+	tokenFailovers = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "token_failovers_total",
+			Help:           "Number of DODE API calls retried with the next token of apiTokenSecretRefs after the API rejected a token.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	// tokenRefreshes counts calls retried with the token read again from
+	// its Secret.
+	tokenRefreshes = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "token_refreshes_total",
+			Help:           "Number of DODE API calls retried with the token read again from its Secret after the API rejected the token.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	// watchdogRepresents counts records presented again by the watchdog
+	// after they were deleted before their challenge was cleaned up.
+	watchdogRepresents = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "watchdog_represents_total",
+			Help:           "Number of TXT records presented again by the watchdog after something else deleted them before the challenge was cleaned up, by result (success or failure).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	// apiSchemaDrift counts API responses whose structure was never seen
+	// before.
+	apiSchemaDrift = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "api_schema_drift_total",
+			Help:           "Number of DODE API responses with a structure (fields and their types) that was never seen before.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	// healthStateGauge is 1 for the current health state of the webhook and
+	// 0 for the others.
+	healthStateGauge = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "health_state",
+			Help:           "Current health state of the webhook (healthy, degraded or unhealthy).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"state"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(
+		zoneFailureStreak,
+		zoneBackoffRejections,
+		healthStateGauge,
+		recoveredPanics,
+		challengeResults,
+		challengeDuration,
+		handlerDuration,
+		timeToFirstAPICall,
+		apiRequestDuration,
+		propagationDuration,
+		inFlightChallenges,
+		maxInFlightChallenges,
+		apiMirrorResults,
+		slowAPICalls,
+		quotaRejections,
+		egressViolations,
+		apiSchemaDrift,
+		clockSkew,
+		tokenFailovers,
+		tokenRefreshes,
+		watchdogRepresents,
+	)
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"k8s.io/klog"
+)
+
+// dodeAPI is the part of the DODE client used by the solver.
+type dodeAPI interface {
+	Present(ctx context.Context, token, domain, value string, ttl int) error
+	CleanUp(ctx context.Context, token, domain string) error
+}
+
+// mirrorTimeout bounds every mirrored request.
+const mirrorTimeout = 30 * time.Second
+
+// mirroredAPI sends a sample of the requests made to the primary API to a
+// secondary endpoint as well, e.g. a new API version or a proxy being
+// migrated to, and reports whether both agreed on the outcome. Mirrored
+// requests are sent without credentials to both endpoints, so they can't
+// change records and the token never leaves for the secondary, and their
+// answers are compared with each other. Only the primary's result is ever
+// returned, so the secondary can't affect challenges.
+type mirroredAPI struct {
+	primary dodeAPI
+	// primaryProbe and secondaryProbe receive the unauthenticated copies of
+	// sampled requests.
+	primaryProbe   dodeAPI
+	secondaryProbe dodeAPI
+	// fraction of requests mirrored, between 0 and 1.
+	fraction float64
+	sample   func() float64
+}
+
+func newMirroredAPI(primary *dode.Client, secondaryURL string, percent float64) (*mirroredAPI, error) {
+	u, err := url.Parse(secondaryURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("--dode.mirror-api-url must be an http or https URL, got %q", secondaryURL)
+	}
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("--dode.mirror-percent must be between 0 and 100, got %v", percent)
+	}
+	return &mirroredAPI{
+		primary:        primary,
+		primaryProbe:   dode.NewClient(dode.WithBaseURL(primary.BaseURL), dode.WithHTTPClient(primary.HTTPClient)),
+		secondaryProbe: dode.NewClient(dode.WithBaseURL(secondaryURL), dode.WithTransport(&egressTransport{base: http.DefaultTransport})),
+		fraction:       percent / 100,
+		sample:         rand.Float64,
+	}, nil
+}
+
+func (m *mirroredAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	err := m.primary.Present(ctx, token, domain, value, ttl)
+	m.mirror("present", domain, func(ctx context.Context, api dodeAPI) error {
+		return api.Present(ctx, "", domain, value, ttl)
+	})
+	return err
+}
+
+func (m *mirroredAPI) CleanUp(ctx context.Context, token, domain string) error {
+	err := m.primary.CleanUp(ctx, token, domain)
+	m.mirror("cleanup", domain, func(ctx context.Context, api dodeAPI) error {
+		return api.CleanUp(ctx, "", domain)
+	})
+	return err
+}
+
+// mirror runs call against both probes in the background if the request is
+// sampled, and compares their outcomes.
+func (m *mirroredAPI) mirror(operation, domain string, call func(context.Context, dodeAPI) error) {
+	if m.sample() >= m.fraction {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+		defer cancel()
+		primaryErr := make(chan error, 1)
+		go func() { primaryErr <- call(ctx, m.primaryProbe) }()
+		secondaryErr := call(ctx, m.secondaryProbe)
+		if err := <-primaryErr; sameOutcome(err, secondaryErr) {
+			apiMirrorResults.WithLabelValues(operation, "match").Inc()
+		} else {
+			apiMirrorResults.WithLabelValues(operation, "divergence").Inc()
+			klog.Warningf("mirrored %s of %s diverged: primary error: %v, secondary error: %v", operation, domain, err, secondaryErr)
+		}
+	}()
+}
+
+// sameOutcome reports whether two answers to the same request agree: both
+// succeeded, or both were rejected by the API with the same status and
+// message.
+func sameOutcome(a, b error) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var apiA, apiB *dode.Error
+	if !errors.As(a, &apiA) || !errors.As(b, &apiB) {
+		return false
+	}
+	return apiA.StatusCode == apiB.StatusCode && apiA.Message == apiB.Message
+}
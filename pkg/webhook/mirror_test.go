@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// outcomeAPI answers every request with err.
+type outcomeAPI struct {
+	err   error
+	calls chan string
+}
+
+func (a *outcomeAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	a.calls <- "present " + domain + " token=" + token
+	return a.err
+}
+
+func (a *outcomeAPI) CleanUp(ctx context.Context, token, domain string) error {
+	a.calls <- "cleanup " + domain + " token=" + token
+	return a.err
+}
+
+func TestMirroredAPI(t *testing.T) {
+	primary := &outcomeAPI{calls: make(chan string, 10)}
+	primaryProbe := &outcomeAPI{err: errors.New("unauthorized"), calls: make(chan string, 10)}
+	secondaryProbe := &outcomeAPI{err: errors.New("unauthorized"), calls: make(chan string, 10)}
+	m := &mirroredAPI{primary: primary, primaryProbe: primaryProbe, secondaryProbe: secondaryProbe, fraction: 0.5}
+
+	samples := []float64{0.2, 0.7}
+	m.sample = func() float64 {
+		s := samples[0]
+		samples = samples[1:]
+		return s
+	}
+
+	if err := m.Present(context.Background(), "token", "a", "key", defaultTTL); err != nil {
+		t.Errorf("expected the primary's result, got %v", err)
+	}
+	for _, probe := range []*outcomeAPI{primaryProbe, secondaryProbe} {
+		if got := <-probe.calls; got != "present a token=" {
+			t.Errorf("expected sampled request to be mirrored without credentials, got %q", got)
+		}
+	}
+	if err := m.CleanUp(context.Background(), "token", "b"); err != nil {
+		t.Errorf("expected the primary's result, got %v", err)
+	}
+	if len(primary.calls) != 2 {
+		t.Errorf("expected both requests to reach the primary, got %d", len(primary.calls))
+	}
+	if len(secondaryProbe.calls) != 0 {
+		t.Errorf("expected request above the sample fraction not to be mirrored, got %q", <-secondaryProbe.calls)
+	}
+}
+
+func TestMirroredAPINeverForwardsCredentials(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	primarySrv := httptest.NewServer(handler)
+	defer primarySrv.Close()
+	secondarySrv := httptest.NewServer(handler)
+	defer secondarySrv.Close()
+
+	m, err := newMirroredAPI(dode.NewClient(dode.WithBaseURL(primarySrv.URL)), secondarySrv.URL, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = m.Present(context.Background(), "secret-token", "example.com", "key", defaultTTL)
+	if r := <-requests; r.URL.Query().Get("token") != "secret-token" {
+		t.Fatalf("expected the real request first, got %s", r.URL)
+	}
+	for i := 0; i < 2; i++ {
+		r := <-requests
+		if _, _, ok := r.BasicAuth(); ok || r.URL.Query().Get("token") != "" {
+			t.Errorf("expected mirrored request without credentials, got %s", r.URL)
+		}
+	}
+}
+
+func TestSameOutcome(t *testing.T) {
+	denied := &dode.Error{StatusCode: http.StatusUnauthorized, Message: "invalid token"}
+	for _, tc := range []struct {
+		a, b error
+		want bool
+	}{
+		{nil, nil, true},
+		{nil, denied, false},
+		{denied, &dode.Error{StatusCode: http.StatusUnauthorized, Message: "invalid token"}, true},
+		{denied, &dode.Error{StatusCode: http.StatusNotFound}, false},
+		{denied, errors.New("connection refused"), false},
+	} {
+		if got := sameOutcome(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameOutcome(%v, %v) = %v, expected %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestNewMirroredAPIValidates(t *testing.T) {
+	if _, err := newMirroredAPI(dode.NewClient(), "not a url", 10); err == nil {
+		t.Errorf("expected invalid URL to be rejected")
+	}
+	if _, err := newMirroredAPI(dode.NewClient(), "https://staging.example/api", 150); err == nil {
+		t.Errorf("expected percentage above 100 to be rejected")
+	}
+}
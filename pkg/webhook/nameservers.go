@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// defaultNameserverCacheTTL is how long the nameservers of a zone are
+// remembered once discovered.
+const defaultNameserverCacheTTL = time.Hour
+
+// zoneNameservers discovers and caches the nameservers serving each zone, so
+// that configs with propagation.nameservers can check propagation on them
+// and name them when the record doesn't show up. Discovery happens on the
+// first challenge of a zone and again once the cached set expired.
+type zoneNameservers struct {
+	ttl      time.Duration
+	now      func() time.Time
+	lookupNS func(ctx context.Context, name string) ([]*net.NS, error)
+
+	mu    sync.Mutex
+	zones map[string]nameserverSet
+}
+
+// nameserverSet is the cached nameservers of a zone.
+type nameserverSet struct {
+	hosts  []string
+	expiry time.Time
+}
+
+func newZoneNameservers(ttl time.Duration) *zoneNameservers {
+	return &zoneNameservers{
+		ttl:      ttl,
+		now:      time.Now,
+		lookupNS: net.DefaultResolver.LookupNS,
+		zones:    map[string]nameserverSet{},
+	}
+}
+
+// get returns the nameservers of zone, sorted, discovering them unless they
+// are cached. Newly discovered sets are logged, as they are the first thing
+// to look at when records don't propagate.
+func (n *zoneNameservers) get(ctx context.Context, zone string) ([]string, error) {
+	zone = normalizeName(zone)
+	n.mu.Lock()
+	set, ok := n.zones[zone]
+	n.mu.Unlock()
+	if ok && n.now().Before(set.expiry) {
+		return set.hosts, nil
+	}
+
+	records, err := n.lookupNS(ctx, zone+".")
+	if err != nil {
+		return nil, fmt.Errorf("discovering the nameservers of zone %q: %v", zone, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no nameservers found for zone %q", zone)
+	}
+	hosts := make([]string, len(records))
+	for i, ns := range records {
+		hosts[i] = normalizeName(ns.Host)
+	}
+	sort.Strings(hosts)
+	if !ok || strings.Join(hosts, ",") != strings.Join(set.hosts, ",") {
+		klog.Infof("zone %q is served by nameservers %s", zone, strings.Join(hosts, ", "))
+	}
+
+	n.mu.Lock()
+	n.zones[zone] = nameserverSet{hosts: hosts, expiry: n.now().Add(n.ttl)}
+	n.mu.Unlock()
+	return hosts, nil
+}
+
+// checkers returns a propagation checker querying each nameserver of zone.
+func (n *zoneNameservers) checkers(ctx context.Context, zone string) ([]PropagationChecker, error) {
+	hosts, err := n.get(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	cs := make([]PropagationChecker, len(hosts))
+	for i, host := range hosts {
+		cs[i] = nameserverChecker{resolverChecker{newDNSResolver(host)}, host}
+	}
+	return cs, nil
+}
+
+// nameserverChecker checks propagation on a nameserver of the zone. It is
+// named after the nameserver in failure messages.
+type nameserverChecker struct {
+	resolverChecker
+	host string
+}
+
+func (c nameserverChecker) String() string {
+	return c.host
+}
+
+// negativeCacheBypass wraps a DoH or recursive checker of a config with
+// cacheBusting. A resolver that looked the record up before it was presented
+// caches its absence for the negative TTL of the zone's SOA record, and no
+// query option gets it to look again before that. If the resolver doesn't
+// see the record, the nameservers of the zone are therefore asked directly,
+// like cert-manager's own propagation check does: once all of them serve the
+// record, the resolver is only held back by its negative cache, and the
+// record counts as seen.
+type negativeCacheBypass struct {
+	PropagationChecker
+	nameservers func(ctx context.Context) ([]PropagationChecker, error)
+}
+
+func (c negativeCacheBypass) String() string {
+	return fmt.Sprint(c.PropagationChecker)
+}
+
+func (c negativeCacheBypass) Check(ctx context.Context, fqdn, value string) (bool, error) {
+	ok, err := c.PropagationChecker.Check(ctx, fqdn, value)
+	if ok {
+		return true, nil
+	}
+	nameservers, nsErr := c.nameservers(ctx)
+	if nsErr != nil {
+		klog.V(4).Infof("not bypassing the negative cache of %v: %v", c, nsErr)
+		return false, err
+	}
+	for _, ns := range nameservers {
+		if seen, nsErr := ns.Check(ctx, fqdn, value); !seen || nsErr != nil {
+			return false, err
+		}
+	}
+	klog.V(4).Infof("%v doesn't see %q yet, but all nameservers of the zone serve it", c, fqdn)
+	return true, nil
+}
+
+// bypassNegativeCaches wraps the DoH and recursive checkers among checkers
+// in a negativeCacheBypass asking the nameservers of zone.
+func (n *zoneNameservers) bypassNegativeCaches(checkers []PropagationChecker, zone string) []PropagationChecker {
+	nameservers := func(ctx context.Context) ([]PropagationChecker, error) {
+		return n.checkers(ctx, zone)
+	}
+	wrapped := make([]PropagationChecker, len(checkers))
+	for i, c := range checkers {
+		wrapped[i] = c
+		if _, ok := c.(resolverChecker); ok {
+			wrapped[i] = negativeCacheBypass{c, nameservers}
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZoneNameservers(t *testing.T) {
+	n := newZoneNameservers(time.Minute)
+	now := time.Unix(0, 0)
+	n.now = func() time.Time { return now }
+	lookups := 0
+	n.lookupNS = func(ctx context.Context, name string) ([]*net.NS, error) {
+		lookups++
+		if name != "example.com." {
+			return nil, errors.New("no such host")
+		}
+		return []*net.NS{{Host: "ns2.do.de."}, {Host: "NS1.do.de."}}, nil
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		hosts, err := n.get(ctx, "Example.com.")
+		if err != nil || !reflect.DeepEqual(hosts, []string{"ns1.do.de", "ns2.do.de"}) {
+			t.Fatalf("expected the sorted nameservers, got %q, %v", hosts, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected the nameservers to be cached, got %d lookups", lookups)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := n.get(ctx, "example.com."); err != nil || lookups != 2 {
+		t.Errorf("expected the nameservers to be discovered again once expired, got %d lookups, %v", lookups, err)
+	}
+	if _, err := n.get(ctx, "example.org."); err == nil || !strings.Contains(err.Error(), "example.org") {
+		t.Errorf("expected an error naming the zone, got %v", err)
+	}
+
+	checkers, err := n.checkers(ctx, "example.com.")
+	if err != nil || len(checkers) != 2 || fmt.Sprint(checkers) != "[ns1.do.de ns2.do.de]" {
+		t.Errorf("expected a checker named after each nameserver, got %v, %v", checkers, err)
+	}
+}
+
+func TestWaitForPropagationNamesMissingCheckers(t *testing.T) {
+	checkers := []PropagationChecker{
+		nameserverChecker{resolverChecker{&staticResolver{values: []string{"key"}}}, "ns1.do.de"},
+		nameserverChecker{resolverChecker{&staticResolver{}}, "ns2.do.de"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := waitForPropagation(ctx, checkers, "_acme-challenge.example.com.", "key", 2, &pollBackoff{interval: time.Millisecond, factor: 1})
+	if err == nil || !strings.Contains(err.Error(), "not visible on [ns2.do.de] after") {
+		t.Errorf("expected the error to name the nameserver missing the record, got %v", err)
+	}
+}
+
+func TestNegativeCacheBypass(t *testing.T) {
+	cached := resolverChecker{&staticResolver{name: "cached"}}
+	serving := nameserverChecker{resolverChecker{&staticResolver{values: []string{"key"}}}, "ns1.do.de"}
+	lagging := nameserverChecker{resolverChecker{&staticResolver{}}, "ns2.do.de"}
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		name        string
+		nameservers []PropagationChecker
+		err         error
+		want        bool
+	}{
+		{"all nameservers serve the record", []PropagationChecker{serving, serving}, nil, true},
+		{"a nameserver lags behind", []PropagationChecker{serving, lagging}, nil, false},
+		{"nameservers unknown", nil, errors.New("no nameservers found"), false},
+	} {
+		c := negativeCacheBypass{cached, func(context.Context) ([]PropagationChecker, error) { return test.nameservers, test.err }}
+		if ok, _ := c.Check(ctx, "_acme-challenge.example.com.", "key"); ok != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, ok)
+		}
+	}
+
+	n := newZoneNameservers(time.Minute)
+	checkers := n.bypassNegativeCaches([]PropagationChecker{cached, &authoritativeChecker{}}, "example.com.")
+	if _, ok := checkers[0].(negativeCacheBypass); !ok || fmt.Sprint(checkers[0]) != "cached" {
+		t.Errorf("expected the resolver checker to be wrapped, got %v", checkers[0])
+	}
+	if _, ok := checkers[1].(*authoritativeChecker); !ok {
+		t.Errorf("expected the authoritative checker to be left alone, got %v", checkers[1])
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog"
+)
+
+// panicReporter forwards panics recovered in solver entry points to an
+// external error reporting service.
+type panicReporter interface {
+	reportPanic(action string, ch *v1alpha1.ChallengeRequest, recovered interface{}, stack []byte)
+}
+
+// recoveredPanic is the error a panic in a solver entry point is converted
+// into. It keeps the recovered value for the audit trail.
+type recoveredPanic struct {
+	action string
+	fqdn   string
+	value  interface{}
+}
+
+func (p *recoveredPanic) Error() string {
+	return fmt.Sprintf("internal error in %s of %s: %v", p.action, p.fqdn, p.value)
+}
+
+// recoverPanic converts a panic in the solver entry point action into an
+// error stored in *errp, so that a single malformed challenge can't take the
+// webhook down for every tenant. It must be deferred directly, after
+// auditLog.trace, which records the panic and dumps the audit trail.
+func (c *dodeDNSProviderSolver) recoverPanic(action string, ch *v1alpha1.ChallengeRequest, errp *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	klog.Errorf("Recovered from panic in %s of %s: %v\n%s", action, ch.ResolvedFQDN, r, stack)
+	recoveredPanics.WithLabelValues(action).Inc()
+	if c.panicReporter != nil {
+		c.panicReporter.reportPanic(action, ch, r, stack)
+	}
+	*errp = classify(errorClassInternal, &recoveredPanic{action: action, fqdn: ch.ResolvedFQDN, value: r})
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+type recordingReporter struct {
+	actions []string
+}
+
+func (r *recordingReporter) reportPanic(action string, ch *v1alpha1.ChallengeRequest, recovered interface{}, stack []byte) {
+	r.actions = append(r.actions, action)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	reporter := &recordingReporter{}
+	c := &dodeDNSProviderSolver{panicReporter: reporter}
+	ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com."}
+
+	err := func() (err error) {
+		defer c.recoverPanic("Present", ch, &err)
+		var cfg *dodeDNSProviderConfig
+		_ = cfg.APITokenSecretRef
+		return nil
+	}()
+	if err == nil || !strings.Contains(err.Error(), "internal error in Present") {
+		t.Errorf("expected panic to be converted into an error, got %v", err)
+	}
+	if len(reporter.actions) != 1 || reporter.actions[0] != "Present" {
+		t.Errorf("expected panic to be reported, got %v", reporter.actions)
+	}
+}
+
+func TestSentryReporter(t *testing.T) {
+	events := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/store/" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=public") {
+			t.Errorf("unexpected auth header %q", r.Header.Get("X-Sentry-Auth"))
+		}
+		var event map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer srv.Close()
+
+	s, err := newSentryReporter(strings.Replace(srv.URL, "://", "://public@", 1) + "/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.reportPanic("CleanUp", &v1alpha1.ChallengeRequest{ResolvedZone: "example.com."}, "boom", nil)
+
+	select {
+	case event := <-events:
+		if event["message"] != "panic in CleanUp: boom" {
+			t.Errorf("unexpected message %v", event["message"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic was not reported")
+	}
+
+	for _, dsn := range []string{"", "https://sentry.example.com/42", "https://public@sentry.example.com"} {
+		if _, err := newSentryReporter(dsn); err == nil {
+			t.Errorf("expected DSN %q to be rejected", dsn)
+		}
+	}
+}
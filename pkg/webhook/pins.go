@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// spkiPins are SHA-256 digests of the DER encoded SubjectPublicKeyInfo of the
+// keys connections to the DODE API must use. Pinning keys rather than
+// certificates lets do.de renew certificates without breaking the pins, and
+// accepting several pins lets operators add the next key before it is
+// rolled out and remove the old one afterwards.
+type spkiPins [][]byte
+
+// parseSPKIPins parses comma separated pins in the base64 form of HPKP,
+// optionally prefixed with sha256/, as printed by
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func parseSPKIPins(s string) (spkiPins, error) {
+	var pins spkiPins
+	for _, pin := range strings.Split(s, ",") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid SPKI pin %q, expected the base64 encoded SHA-256 digest of a public key", pin)
+		}
+		pins = append(pins, digest)
+	}
+	return pins, nil
+}
+
+// verify accepts the connection if any certificate of the verified chains
+// has a pinned key, so that pinning the key of an intermediate CA works as
+// well. It runs after the usual verification, which still applies.
+func (p spkiPins) verify(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range p {
+				if bytes.Equal(digest[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("no certificate presented by the DODE API matches the configured SPKI pins")
+}
+
+// sameHost reports whether the URLs a and b point at the same host and port.
+// Pins only apply to the host of --dode.api-url, as other endpoints, such as
+// those of apiUrl, present other keys. Hosts are compared without case and a
+// trailing dot, and a missing port counts as the default port of the scheme,
+// so that spelling the same endpoint differently can't skip the pins.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSuffix(ua.Hostname(), "."), strings.TrimSuffix(ub.Hostname(), ".")) &&
+		urlPort(ua) == urlPort(ub)
+}
+
+// urlPort returns the port of u, or the default port of its scheme.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSPKIPins(t *testing.T) {
+	digest := sha256.Sum256([]byte("key"))
+	pin := base64.StdEncoding.EncodeToString(digest[:])
+	pins, err := parseSPKIPins("sha256/" + pin + ", " + pin)
+	if err != nil || len(pins) != 2 {
+		t.Fatalf("expected two pins, got %d, %v", len(pins), err)
+	}
+	for _, s := range []string{"sha256/not-base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parseSPKIPins(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+	if pins, err := parseSPKIPins(""); err != nil || len(pins) != 0 {
+		t.Errorf("expected no pins, got %d, %v", len(pins), err)
+	}
+}
+
+func TestSPKIPinsTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	digest := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	other := sha256.Sum256([]byte("other key"))
+
+	get := func(pins spkiPins) error {
+		rt := tlsTransport(&tls.Config{RootCAs: roots, VerifyPeerCertificate: pins.verify}, nil)
+		resp, err := (&http.Client{Transport: rt}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	// The next key is pinned alongside the current one during a rotation.
+	if err := get(spkiPins{other[:], digest[:]}); err != nil {
+		t.Errorf("expected the pinned key to be accepted, got %v", err)
+	}
+	if err := get(spkiPins{other[:]}); err == nil || !strings.Contains(err.Error(), "SPKI pins") {
+		t.Errorf("expected an unpinned key to be refused, got %v", err)
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"https://www.do.de/api/letsencrypt", "https://WWW.do.de/other", true},
+		{"https://www.do.de/api", "https://proxy.example.com/api", false},
+		{"https://www.do.de:8443/api", "https://www.do.de/api", false},
+		{"https://www.do.de./api", "https://www.do.de/api", true},
+		{"https://www.do.de:443/api", "https://www.do.de/api", true},
+		{"http://www.do.de:80/api", "http://www.do.de/api", true},
+		{"http://www.do.de/api", "https://www.do.de/api", false},
+	} {
+		if got := sameHost(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameHost(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+)
+
+// cert-manager resources read to pre-validate the solver configs of new
+// Certificates.
+var (
+	certificatesResource   = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+	issuersResource        = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "issuers"}
+	clusterIssuersResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "clusterissuers"}
+)
+
+// reasonPrevalidationFailed is the reason of the Event emitted on a
+// Certificate whose challenges are bound to fail.
+const reasonPrevalidationFailed = "DODEPrevalidationFailed"
+
+// certificatePrewarmer watches Certificates and, as soon as one that isn't
+// ready yet appears, performs the checks of Present that don't touch any
+// records for every name solved by this webhook: loading the solver config
+// of its issuer and fetching the API token. Problems are reported in a
+// warning Event on the Certificate minutes before its challenges would run
+// into them.
+type certificatePrewarmer struct {
+	solver *dodeDNSProviderSolver
+	client dynamic.Interface
+	// clusterResourceNamespace is where cert-manager looks up the Secrets
+	// of ClusterIssuers.
+	clusterResourceNamespace string
+
+	mu      sync.Mutex
+	checked map[types.UID]bool
+}
+
+func newCertificatePrewarmer(solver *dodeDNSProviderSolver, client dynamic.Interface, clusterResourceNamespace string) *certificatePrewarmer {
+	return &certificatePrewarmer{
+		solver:                   solver,
+		client:                   client,
+		clusterResourceNamespace: clusterResourceNamespace,
+		checked:                  map[types.UID]bool{},
+	}
+}
+
+// run watches Certificates until stopCh is closed.
+func (p *certificatePrewarmer) run(stopCh <-chan struct{}) {
+	wait.Until(func() { p.watch(stopCh) }, time.Minute, stopCh)
+}
+
+// watch checks the Certificates added until the watch ends. Certificates
+// are only checked once, so the Certificates listed again when the watch is
+// reopened are skipped.
+func (p *certificatePrewarmer) watch(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	w, err := p.client.Resource(certificatesResource).Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Warningf("failed to watch Certificates for pre-validation: %v", err)
+		return
+	}
+	defer w.Stop()
+	for ev := range w.ResultChan() {
+		cert, ok := ev.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		uid := cert.GetUID()
+		switch ev.Type {
+		case watch.Added:
+			p.mu.Lock()
+			done := p.checked[uid]
+			p.checked[uid] = true
+			p.mu.Unlock()
+			if !done && !certificateReady(cert) {
+				p.check(ctx, cert)
+			}
+		case watch.Deleted:
+			p.mu.Lock()
+			delete(p.checked, uid)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// check pre-validates cert and reports the problems found in an Event.
+func (p *certificatePrewarmer) check(ctx context.Context, cert *unstructured.Unstructured) {
+	group, _, _ := unstructured.NestedString(cert.Object, "spec", "issuerRef", "group")
+	if group != "" && group != certificatesResource.Group {
+		return
+	}
+	name, _, _ := unstructured.NestedString(cert.Object, "spec", "issuerRef", "name")
+	kind, _, _ := unstructured.NestedString(cert.Object, "spec", "issuerRef", "kind")
+
+	var (
+		issuer    *unstructured.Unstructured
+		err       error
+		namespace = cert.GetNamespace()
+	)
+	if kind == "ClusterIssuer" {
+		issuer, err = p.client.Resource(clusterIssuersResource).Get(ctx, name, metav1.GetOptions{})
+		namespace = p.clusterResourceNamespace
+	} else {
+		issuer, err = p.client.Resource(issuersResource).Namespace(cert.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		// cert-manager reports missing issuers on the Certificate itself.
+		klog.V(4).Infof("skipping pre-validation of Certificate %s/%s: %v", cert.GetNamespace(), cert.GetName(), err)
+		return
+	}
+	solvers, _, _ := unstructured.NestedSlice(issuer.Object, "spec", "acme", "solvers")
+	labels, _, _ := unstructured.NestedStringMap(cert.Object, "metadata", "labels")
+
+	checked := map[string]bool{}
+	for _, dnsName := range certificateDNSNames(cert) {
+		cfgJSON, ok := dodeSolverConfig(solvers, dnsName, labels)
+		if !ok {
+			continue
+		}
+		key := string(cfgJSON.Raw)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		if err := p.solver.prevalidate(cfgJSON, namespace, kind == "ClusterIssuer"); err != nil {
+			klog.Warningf("pre-validation of Certificate %s/%s failed for %s: %v", cert.GetNamespace(), cert.GetName(), dnsName, err)
+			if p.solver.recorder != nil {
+				p.solver.recorder.Eventf(certificateReference(cert), corev1.EventTypeWarning, reasonPrevalidationFailed,
+					"Challenges for %s will fail: %v", dnsName, err)
+			}
+			continue
+		}
+		klog.V(4).Infof("pre-validated Certificate %s/%s for %s", cert.GetNamespace(), cert.GetName(), dnsName)
+	}
+}
+
+// prevalidate performs the checks of Present that don't change any records
+// for a challenge solved with cfgJSON on behalf of namespace. The tokens of
+// all zoneTokens are fetched, as the zones of the challenges are only known
+// once they are created.
+func (c *dodeDNSProviderSolver) prevalidate(cfgJSON *extapi.JSON, namespace string, allowAmbient bool) error {
+	cfg, err := loadConfig(cfgJSON, c.defaults.get())
+	if err != nil {
+		return err
+	}
+	if err := c.quotas.check(context.TODO(), namespace); err != nil {
+		return err
+	}
+	configs := []*dodeDNSProviderConfig{&cfg}
+	if len(cfg.ZoneTokens) > 0 {
+		if cfg.APITokenSecretRef.Name == "" && len(cfg.APITokenSecretRefs) == 0 {
+			configs = nil
+		}
+		for _, zone := range zoneTokenZones(&cfg) {
+			configs = append(configs, secretRefConfig(&cfg, cfg.ZoneTokens[zone]))
+		}
+	}
+	for _, cfg := range configs {
+		if _, err := c.getAPIKeys(cfg, namespace, allowAmbient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificateReady reports whether cert has a true Ready condition.
+func certificateReady(cert *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == "Ready" && m["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateDNSNames returns the names cert requests.
+func certificateDNSNames(cert *unstructured.Unstructured) []string {
+	names, _, _ := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+	if cn, _, _ := unstructured.NestedString(cert.Object, "spec", "commonName"); cn != "" && !containsString(names, cn) {
+		names = append(names, cn)
+	}
+	return names
+}
+
+// dodeSolverConfig returns the config of the solver cert-manager picks among
+// solvers for dnsName in a Certificate labelled with labels, if that is a
+// webhook solver handled by this webhook. Like cert-manager, it prefers
+// solvers selecting dnsName explicitly over those selecting the longest
+// matching dnsZone, over those without dnsNames and dnsZones.
+func dodeSolverConfig(solvers []interface{}, dnsName string, labels map[string]string) (*extapi.JSON, bool) {
+	var (
+		best      map[string]interface{}
+		bestScore = -1
+	)
+	for _, s := range solvers {
+		solver, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok, _ := unstructured.NestedMap(solver, "dns01"); !ok {
+			continue
+		}
+		matchLabels, _, _ := unstructured.NestedStringMap(solver, "selector", "matchLabels")
+		matches := true
+		for k, v := range matchLabels {
+			if labels[k] != v {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		dnsNames, _, _ := unstructured.NestedStringSlice(solver, "selector", "dnsNames")
+		dnsZones, _, _ := unstructured.NestedStringSlice(solver, "selector", "dnsZones")
+		score := -1
+		switch {
+		case containsString(dnsNames, dnsName):
+			score = 1 << 16
+		case len(dnsNames) == 0 && len(dnsZones) == 0:
+			score = 0
+		}
+		for _, z := range dnsZones {
+			if (dnsName == z || strings.HasSuffix(dnsName, "."+z)) && len(z) > score {
+				score = len(z)
+			}
+		}
+		if score > bestScore {
+			best, bestScore = solver, score
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	webhook, _, _ := unstructured.NestedMap(best, "dns01", "webhook")
+	if webhook == nil || webhook["groupName"] != GroupName || webhook["solverName"] != solverName {
+		return nil, false
+	}
+	raw, err := json.Marshal(webhook["config"])
+	if err != nil {
+		return nil, false
+	}
+	return &extapi.JSON{Raw: raw}, true
+}
+
+// certificateReference returns a reference to cert for use in Events.
+func certificateReference(cert *unstructured.Unstructured) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: cert.GetAPIVersion(),
+		Kind:       "Certificate",
+		Namespace:  cert.GetNamespace(),
+		Name:       cert.GetName(),
+		UID:        cert.GetUID(),
+	}
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDodeSolverConfig(t *testing.T) {
+	defer func(g string) { GroupName = g }(GroupName)
+	GroupName = "acme.example.com"
+
+	var solvers []interface{}
+	if err := json.Unmarshal([]byte(`[
+		{"http01": {"ingress": {}}},
+		{"dns01": {"webhook": {"groupName": "acme.example.com", "solverName": "dode", "config": {"apiTokenSecretRef": {"name": "default"}}}}},
+		{"selector": {"dnsZones": ["example.com"]},
+		 "dns01": {"webhook": {"groupName": "acme.example.com", "solverName": "dode", "config": {"apiTokenSecretRef": {"name": "zone"}}}}},
+		{"selector": {"dnsZones": ["sub.example.com"]},
+		 "dns01": {"cloudflare": {}}},
+		{"selector": {"dnsNames": ["www.sub.example.com"], "matchLabels": {"team": "a"}},
+		 "dns01": {"webhook": {"groupName": "acme.example.com", "solverName": "dode", "config": {"apiTokenSecretRef": {"name": "team-a"}}}}}
+	]`), &solvers); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dnsName string
+		labels  map[string]string
+		want    string
+	}{
+		{dnsName: "example.org", want: "default"},
+		{dnsName: "www.example.com", want: "zone"},
+		{dnsName: "www.sub.example.com"},
+		{dnsName: "www.sub.example.com", labels: map[string]string{"team": "a"}, want: "team-a"},
+	}
+	for _, test := range tests {
+		cfgJSON, ok := dodeSolverConfig(solvers, test.dnsName, test.labels)
+		if !ok {
+			if test.want != "" {
+				t.Errorf("%s: expected the %q solver, got none", test.dnsName, test.want)
+			}
+			continue
+		}
+		cfg, err := decodeConfig(cfgJSON, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.APITokenSecretRef.Name != test.want {
+			t.Errorf("%s: expected the %q solver, got %q", test.dnsName, test.want, cfg.APITokenSecretRef.Name)
+		}
+	}
+}
+
+func TestCertificateReady(t *testing.T) {
+	cert := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Issuing", "status": "True"},
+				map[string]interface{}{"type": "Ready", "status": "False"},
+			},
+		},
+	}}
+	if certificateReady(cert) {
+		t.Error("expected the certificate not to be ready")
+	}
+	cert.Object["status"].(map[string]interface{})["conditions"] = []interface{}{
+		map[string]interface{}{"type": "Ready", "status": "True"},
+	}
+	if !certificateReady(cert) {
+		t.Error("expected the certificate to be ready")
+	}
+}
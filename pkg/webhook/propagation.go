@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Defaults of the propagation check. They can be overridden for the whole
+// webhook through lego's DODE_PROPAGATION_TIMEOUT and DODE_POLLING_INTERVAL.
+var (
+	defaultPropagationTimeout      = 120 * time.Second
+	defaultPropagationPollInterval = 5 * time.Second
+)
+
+// propagationConfig configures the optional check, performed at the end of
+// Present, that waits until the presented TXT record is visible to the
+// configured propagation checkers.
+type propagationConfig struct {
+	// DoHServers lists DNS-over-HTTPS JSON APIs to query, either by provider
+	// name ("google", "cloudflare") or as https URLs.
+	DoHServers []string `json:"dohServers,omitempty"`
+	// TimeoutSeconds bounds how long Present waits for the record.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// PollIntervalSeconds is the delay between two rounds of lookups.
+	PollIntervalSeconds int `json:"pollIntervalSeconds,omitempty"`
+	// Quorum is the number of checkers that must see the record before it
+	// is considered propagated. Zero requires all of them.
+	Quorum int `json:"quorum,omitempty"`
+	// PollBackoffFactor multiplies the poll interval after every round in
+	// which the record wasn't visible yet. Resolvers that cached the absence
+	// of the record only see it once the negative TTL of the zone expired,
+	// so polling them at a fixed high rate is wasted effort.
+	PollBackoffFactor float64 `json:"pollBackoffFactor,omitempty"`
+	// MaxPollIntervalSeconds caps the poll interval when backing off.
+	MaxPollIntervalSeconds int `json:"maxPollIntervalSeconds,omitempty"`
+	// CacheBusting adds a random padding parameter and no-cache headers to
+	// DoH queries, so that HTTP caches in front of the resolvers can't
+	// answer with a stale response. DoH and recursive checkers not seeing
+	// the record yet also ask the nameservers of the zone directly, so that
+	// a resolver's negative cache doesn't hold the check up.
+	CacheBusting bool `json:"cacheBusting,omitempty"`
+	// Checkers configures further propagation checkers, e.g. querying the
+	// authoritative nameservers of the zone. Each of them counts towards
+	// the quorum like a DoH server.
+	Checkers []checkerConfig `json:"checkers,omitempty"`
+	// Nameservers adds a checker for every nameserver of the resolved zone,
+	// discovered on the first challenge of the zone and cached. Each of them
+	// counts towards the quorum, and failures name the nameservers that
+	// didn't see the record.
+	Nameservers bool `json:"nameservers,omitempty"`
+}
+
+// txtResolver looks up the TXT records present at a name.
+type txtResolver interface {
+	lookupTXT(ctx context.Context, fqdn string) ([]string, error)
+	String() string
+}
+
+// checkers builds the propagation checkers configured in cfg, one for every
+// DoH server followed by the ones in Checkers.
+func (cfg *propagationConfig) checkers() ([]PropagationChecker, error) {
+	client := egressClient(10 * time.Second)
+	var cs []PropagationChecker
+	for _, s := range cfg.DoHServers {
+		r, err := newDoHResolver(s, client)
+		if err != nil {
+			return nil, err
+		}
+		r.cacheBusting = cfg.CacheBusting
+		cs = append(cs, resolverChecker{r})
+	}
+	for i := range cfg.Checkers {
+		c, err := cfg.Checkers[i].build(client, cfg.CacheBusting)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// numCheckers returns the number of checkers configured in cfg.
+func (cfg *propagationConfig) numCheckers() int {
+	return len(cfg.DoHServers) + len(cfg.Checkers)
+}
+
+func (cfg *propagationConfig) timeout() time.Duration {
+	if cfg.TimeoutSeconds > 0 {
+		return seconds(cfg.TimeoutSeconds)
+	}
+	return defaultPropagationTimeout
+}
+
+// poll returns the schedule to poll resolvers with.
+func (cfg *propagationConfig) poll() *pollBackoff {
+	p := &pollBackoff{
+		interval: defaultPropagationPollInterval,
+		factor:   1,
+	}
+	if cfg.PollIntervalSeconds > 0 {
+		p.interval = seconds(cfg.PollIntervalSeconds)
+	}
+	if cfg.PollBackoffFactor > 1 {
+		p.factor = cfg.PollBackoffFactor
+	}
+	if cfg.MaxPollIntervalSeconds > 0 {
+		p.max = seconds(cfg.MaxPollIntervalSeconds)
+	}
+	return p
+}
+
+// pollBackoff yields the delays between rounds of propagation lookups,
+// growing exponentially by factor up to max (unbounded if zero).
+type pollBackoff struct {
+	interval time.Duration
+	factor   float64
+	max      time.Duration
+}
+
+// next returns the delay before the next round.
+func (p *pollBackoff) next() time.Duration {
+	d := p.interval
+	if next := float64(p.interval) * p.factor; next < math.MaxInt64 {
+		p.interval = time.Duration(next)
+	} else {
+		p.interval = math.MaxInt64
+	}
+	if p.max > 0 && p.interval > p.max {
+		p.interval = p.max
+	}
+	if p.max > 0 && d > p.max {
+		d = p.max
+	}
+	return d
+}
+
+// seconds converts a number of seconds from the solver config into a
+// duration, saturating instead of overflowing.
+func seconds(n int) time.Duration {
+	if int64(n) > math.MaxInt64/int64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(n) * time.Second
+}
+
+// quorum returns how many of n checkers must see the record.
+func (cfg *propagationConfig) quorum(n int) int {
+	if cfg.Quorum > 0 && cfg.Quorum < n {
+		return cfg.Quorum
+	}
+	return n
+}
+
+// waitForPropagation polls checkers in parallel until at least quorum of
+// them saw value among the TXT records at fqdn, or ctx is done. A checker
+// that has seen the record once is not queried again. Rounds are spaced
+// according to poll.
+func waitForPropagation(ctx context.Context, checkers []PropagationChecker, fqdn, value string, quorum int, poll *pollBackoff) error {
+	pending := checkers
+	seen := 0
+	start := time.Now()
+	for {
+		found := make([]bool, len(pending))
+		var wg sync.WaitGroup
+		for i, r := range pending {
+			wg.Add(1)
+			go func(i int, c PropagationChecker) {
+				defer wg.Done()
+				ok, err := c.Check(ctx, fqdn, value)
+				if err != nil {
+					klog.V(4).Infof("propagation check of %q against %v failed: %v", fqdn, c, err)
+				}
+				found[i] = ok
+			}(i, r)
+		}
+		wg.Wait()
+
+		var stillPending []PropagationChecker
+		for i, c := range pending {
+			if found[i] {
+				seen++
+			} else {
+				stillPending = append(stillPending, c)
+			}
+		}
+		if seen >= quorum {
+			return nil
+		}
+		pending = stillPending
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT record %q not visible on %v after %s, seen by %d of the %d required checkers: %v",
+				fqdn, pending, time.Since(start).Round(time.Second), seen, quorum, ctx.Err())
+		case <-time.After(poll.next()):
+		}
+	}
+}
+
+// settle waits for d, e.g. for the nameservers of the zone to catch up with
+// a presented record, or until ctx is done.
+func settle(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	klog.V(4).Infof("waiting %s for the record to settle", d)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func hasTXTValue(ctx context.Context, r txtResolver, fqdn, value string) (bool, error) {
+	values, err := r.lookupTXT(ctx, fqdn)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range values {
+		if v == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
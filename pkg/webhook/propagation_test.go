@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// staticResolver is a txtResolver answering from a fixed set of values.
+type staticResolver struct {
+	name   string
+	values []string
+	err    error
+}
+
+func (r *staticResolver) lookupTXT(ctx context.Context, fqdn string) ([]string, error) {
+	return r.values, r.err
+}
+
+func (r *staticResolver) String() string {
+	return r.name
+}
+
+func TestWaitForPropagationQuorum(t *testing.T) {
+	checkers := []PropagationChecker{
+		resolverChecker{&staticResolver{name: "a", values: []string{"key"}}},
+		resolverChecker{&staticResolver{name: "b", values: []string{"other"}}},
+		resolverChecker{&staticResolver{name: "c", err: errors.New("timeout")}},
+		resolverChecker{&staticResolver{name: "d", values: []string{"other", "key"}}},
+	}
+
+	tests := []struct {
+		quorum  int
+		wantErr bool
+	}{
+		{quorum: 1},
+		{quorum: 2},
+		{quorum: 3, wantErr: true},
+		{quorum: 4, wantErr: true},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := waitForPropagation(ctx, checkers, "_acme-challenge.example.com.", "key", test.quorum, &pollBackoff{interval: time.Millisecond, factor: 1})
+		cancel()
+		if (err != nil) != test.wantErr {
+			t.Errorf("quorum %d: unexpected result %v", test.quorum, err)
+		}
+	}
+}
+
+func TestPropagationConfigQuorum(t *testing.T) {
+	for _, test := range []struct {
+		quorum, n, want int
+	}{
+		{quorum: 0, n: 3, want: 3},
+		{quorum: 2, n: 3, want: 2},
+		{quorum: 5, n: 3, want: 3},
+	} {
+		cfg := &propagationConfig{Quorum: test.quorum}
+		if got := cfg.quorum(test.n); got != test.want {
+			t.Errorf("quorum %d of %d: got %d, want %d", test.quorum, test.n, got, test.want)
+		}
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	cfg := &propagationConfig{PollIntervalSeconds: 2, PollBackoffFactor: 2, MaxPollIntervalSeconds: 10}
+	p := cfg.poll()
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, p.next())
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected intervals %v, got %v", want, got)
+		}
+	}
+
+	p = (&propagationConfig{}).poll()
+	if d1, d2 := p.next(), p.next(); d1 != defaultPropagationPollInterval || d2 != defaultPropagationPollInterval {
+		t.Errorf("expected constant default interval, got %s, %s", d1, d2)
+	}
+}
+
+func TestPollBackoffSaturates(t *testing.T) {
+	p := (&propagationConfig{PollIntervalSeconds: 1 << 62, PollBackoffFactor: 1e308}).poll()
+	for i := 0; i < 3; i++ {
+		if d := p.next(); d <= 0 {
+			t.Fatalf("expected a positive interval, got %s", d)
+		}
+	}
+}
+
+func TestSettle(t *testing.T) {
+	if err := settle(context.Background(), 0); err != nil {
+		t.Errorf("expected no wait without delay, got %v", err)
+	}
+	start := time.Now()
+	if err := settle(context.Background(), 10*time.Millisecond); err != nil || time.Since(start) < 10*time.Millisecond {
+		t.Errorf("expected to wait for the delay, got %v after %s", err, time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := settle(ctx, time.Hour); err == nil {
+		t.Errorf("expected an error once the context is done")
+	}
+}
@@ -0,0 +1,267 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+// Periods API quotas can be defined for. Usage is counted per calendar day
+// or month in UTC.
+const (
+	quotaPerDay   = "day"
+	quotaPerMonth = "month"
+)
+
+// quotaDefault is the namespace a quota applies to when a namespace has no
+// quota of its own.
+const quotaDefault = "*"
+
+// quotaLimit allows limit API calls per period.
+type quotaLimit struct {
+	period string
+	limit  int
+}
+
+// quotaUsage is the number of calls a namespace made in the current window
+// of a period, e.g. the day 2021-03-01.
+type quotaUsage struct {
+	Window string `json:"window"`
+	Calls  int    `json:"calls"`
+}
+
+// apiQuotas limits the number of API calls made on behalf of the challenges
+// of a namespace, so that one tenant's runaway automation can't exhaust the
+// shared do.de account. Usage is kept in a ConfigMap shared by all replicas,
+// under a key per namespace, so that it survives restarts and a namespace
+// can't use the quota once per replica. Every call is reserved there before
+// it is made.
+type apiQuotas struct {
+	limits map[string][]quotaLimit
+	now    func() time.Time
+
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// parseAPIQuotas parses comma separated quotas of the form
+// <namespace>=<calls>/<day|month>. The namespace "*" sets the quota of all
+// namespaces without quotas of their own.
+func parseAPIQuotas(s string) (*apiQuotas, error) {
+	q := &apiQuotas{
+		limits: map[string][]quotaLimit{},
+		now:    time.Now,
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid API quota %q, expected <namespace>=<calls>/<day|month>", entry)
+		}
+		value := strings.SplitN(parts[1], "/", 2)
+		limit, err := strconv.Atoi(value[0])
+		if err != nil || limit < 0 || len(value) != 2 || (value[1] != quotaPerDay && value[1] != quotaPerMonth) {
+			return nil, fmt.Errorf("invalid API quota %q, expected <namespace>=<calls>/<day|month>", entry)
+		}
+		q.limits[parts[0]] = append(q.limits[parts[0]], quotaLimit{period: value[1], limit: limit})
+	}
+	return q, nil
+}
+
+// useConfigMap keeps the usage in the ConfigMap ref, of the form
+// namespace/name, which is created when the first call is reserved.
+func (q *apiQuotas) useConfigMap(client kubernetes.Interface, ref string) error {
+	if ref == "" {
+		return fmt.Errorf("--%sapi-quotas needs --%sapi-quota-configmap to share the usage between replicas and restarts", flagPrefix, flagPrefix)
+	}
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("--%sapi-quota-configmap must be of the form namespace/name, got %q", flagPrefix, ref)
+	}
+	q.client, q.namespace, q.name = client, parts[0], parts[1]
+	return nil
+}
+
+// quotaWindow returns the window of period t falls into.
+func quotaWindow(period string, t time.Time) string {
+	if period == quotaPerMonth {
+		return t.UTC().Format("2006-01")
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func (q *apiQuotas) limitsOf(namespace string) []quotaLimit {
+	if limits, ok := q.limits[namespace]; ok {
+		return limits
+	}
+	return q.limits[quotaDefault]
+}
+
+// usage returns the ConfigMap and the usage of namespace stored in it, by
+// period. Usage of past windows is dropped. The ConfigMap is nil if it
+// doesn't exist yet.
+func (q *apiQuotas) usage(ctx context.Context, namespace string) (*v1.ConfigMap, map[string]quotaUsage, error) {
+	cm, err := q.client.CoreV1().ConfigMaps(q.namespace).Get(ctx, q.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, map[string]quotaUsage{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the API quota usage from ConfigMap %s/%s: %v", q.namespace, q.name, err)
+	}
+	usage := map[string]quotaUsage{}
+	if data, ok := cm.Data[namespace]; ok {
+		if err := json.Unmarshal([]byte(data), &usage); err != nil {
+			return nil, nil, fmt.Errorf("unable to decode the API quota usage of namespace %q from ConfigMap %s/%s: %v", namespace, q.namespace, q.name, err)
+		}
+	}
+	now := q.now()
+	for period, u := range usage {
+		if u.Window != quotaWindow(period, now) {
+			delete(usage, period)
+		}
+	}
+	return cm, usage, nil
+}
+
+// exceeded returns an error, and counts the rejection, if usage reached any
+// of limits.
+func exceeded(namespace string, limits []quotaLimit, usage map[string]quotaUsage) error {
+	for _, l := range limits {
+		if used := usage[l.period].Calls; used >= l.limit {
+			quotaRejections.WithLabelValues(namespace, l.period).Inc()
+			return fmt.Errorf("namespace %q used %d of its %d DODE API calls per %s", namespace, used, l.limit, l.period)
+		}
+	}
+	return nil
+}
+
+// check returns an error if namespace used up any of its quotas. It does
+// nothing if q is nil.
+func (q *apiQuotas) check(ctx context.Context, namespace string) error {
+	if q == nil {
+		return nil
+	}
+	limits := q.limitsOf(namespace)
+	if len(limits) == 0 {
+		return nil
+	}
+	_, usage, err := q.usage(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	return exceeded(namespace, limits, usage)
+}
+
+// reserve counts an API call of namespace about to be made. With enforce,
+// the call is refused with an error if it would exceed a quota; otherwise,
+// e.g. for CleanUp, it is only counted. Concurrent reservations of other
+// replicas are resolved by retrying on conflicts.
+func (q *apiQuotas) reserve(ctx context.Context, namespace string, enforce bool) error {
+	limits := q.limitsOf(namespace)
+	if len(limits) == 0 {
+		return nil
+	}
+	var refused error
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, usage, err := q.usage(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		if enforce {
+			if refused = exceeded(namespace, limits, usage); refused != nil {
+				return nil
+			}
+		}
+		now := q.now()
+		for _, l := range limits {
+			u := usage[l.period]
+			usage[l.period] = quotaUsage{Window: quotaWindow(l.period, now), Calls: u.Calls + 1}
+		}
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		cms := q.client.CoreV1().ConfigMaps(q.namespace)
+		if cm == nil {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: q.namespace, Name: q.name}}
+			cm.Data = map[string]string{namespace: string(data)}
+			_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				// Created by another replica in the meantime.
+				return errors.NewConflict(v1.Resource("configmaps"), q.name, err)
+			}
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[namespace] = string(data)
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to reserve a DODE API call of namespace %q in ConfigMap %s/%s: %v", namespace, q.namespace, q.name, err)
+	}
+	return refused
+}
+
+// quotaAPI reserves every API call in the quota of the namespace of the
+// operation carried by the call's context before making it, so that retries,
+// fallback tokens and restored records are counted as well. Only Present
+// calls are refused; CleanUp always runs, so that no records are left
+// behind. Calls without an operation, e.g. of the watchdog, aren't counted.
+type quotaAPI struct {
+	dodeAPI
+	quotas *apiQuotas
+}
+
+// enforce returns api with its calls counted towards the quotas, or api
+// itself if q is nil.
+func (q *apiQuotas) enforce(api dodeAPI) dodeAPI {
+	if q == nil {
+		return api
+	}
+	return &quotaAPI{dodeAPI: api, quotas: q}
+}
+
+func (a *quotaAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	if err := a.reserve(ctx); err != nil {
+		return err
+	}
+	return a.dodeAPI.Present(ctx, token, domain, value, ttl)
+}
+
+func (a *quotaAPI) CleanUp(ctx context.Context, token, domain string) error {
+	if err := a.reserve(ctx); err != nil {
+		return err
+	}
+	return a.dodeAPI.CleanUp(ctx, token, domain)
+}
+
+func (a *quotaAPI) reserve(ctx context.Context) error {
+	r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult)
+	if !ok {
+		return nil
+	}
+	enforce := r.Action == "Present"
+	err := a.quotas.reserve(ctx, r.Namespace, enforce)
+	if err != nil && !enforce {
+		klog.Warningf("counting DODE API call of %s: %v", r.Action, err)
+		return nil
+	}
+	return classify(errorClassQuota, err)
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAPIQuotas(t *testing.T) {
+	q, err := parseAPIQuotas("*=3/day, team-a=5/day,team-a=6/month")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset()
+	if err := q.useConfigMap(client, "dode/api-quotas"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 31, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+	reserve := func(namespace string, calls int) {
+		for i := 0; i < calls; i++ {
+			if err := q.reserve(ctx, namespace, true); err != nil {
+				t.Fatalf("reserving call %d of %s: %v", i+1, namespace, err)
+			}
+		}
+	}
+
+	reserve("default", 3)
+	if err := q.check(ctx, "default"); err == nil {
+		t.Error("expected the default quota to be used up")
+	}
+	if err := q.reserve(ctx, "default", true); err == nil {
+		t.Error("expected a call beyond the quota to be refused")
+	}
+	if err := q.reserve(ctx, "default", false); err != nil {
+		t.Errorf("expected calls that aren't enforced to be counted only: %v", err)
+	}
+	reserve("team-a", 4)
+	if err := q.check(ctx, "team-a"); err != nil {
+		t.Errorf("expected team-a to have calls left: %v", err)
+	}
+
+	// Another replica, or the webhook after a restart, sees the usage.
+	other, _ := parseAPIQuotas("*=3/day, team-a=5/day,team-a=6/month")
+	other.useConfigMap(client, "dode/api-quotas")
+	other.now = q.now
+	if err := other.check(ctx, "default"); err == nil {
+		t.Error("expected the usage to be shared through the ConfigMap")
+	}
+
+	now = now.Add(24 * time.Hour)
+	if err := q.check(ctx, "default"); err != nil {
+		t.Errorf("expected the daily quota to be reset: %v", err)
+	}
+	reserve("team-a", 2)
+	if err := q.check(ctx, "team-a"); err != nil {
+		t.Errorf("expected the monthly quota to be reset in April: %v", err)
+	}
+	reserve("team-a", 4)
+	if err := q.check(ctx, "team-a"); err == nil {
+		t.Error("expected the monthly quota of team-a to be used up")
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("dode").Get(ctx, "api-quotas", metav1.GetOptions{})
+	if err != nil || cm.Data["team-a"] == "" {
+		t.Errorf("expected the usage of team-a to be stored under its own key, got %v, %v", cm, err)
+	}
+}
+
+func TestQuotaAPI(t *testing.T) {
+	srv := newFakeDodeAPI("token")
+	defer srv.Close()
+	q, _ := parseAPIQuotas("team-a=1/day")
+	q.useConfigMap(fake.NewSimpleClientset(), "dode/api-quotas")
+	api := q.enforce(dode.NewClient(dode.WithBaseURL(srv.URL)))
+
+	present := withChallengeResult(context.Background(), &ChallengeResult{Action: "Present", Namespace: "team-a"})
+	if err := api.Present(present, "token", "_acme-challenge.example.com", "key", defaultTTL); err != nil {
+		t.Fatal(err)
+	}
+	err := api.Present(present, "token", "_acme-challenge.example.com", "key", defaultTTL)
+	if errorClass(err) != errorClassQuota || srv.calls != 1 {
+		t.Errorf("expected the second call to be refused before it was made, got %v after %d calls", err, srv.calls)
+	}
+	cleanUp := withChallengeResult(context.Background(), &ChallengeResult{Action: "CleanUp", Namespace: "team-a"})
+	if err := api.CleanUp(cleanUp, "token", "_acme-challenge.example.com"); err != nil || srv.calls != 2 {
+		t.Errorf("expected CleanUp to run beyond the quota, got %v after %d calls", err, srv.calls)
+	}
+}
+
+func TestParseAPIQuotasInvalid(t *testing.T) {
+	for _, s := range []string{"team-a", "=1/day", "team-a=x/day", "team-a=1/week", "team-a=-1/day"} {
+		if _, err := parseAPIQuotas(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+	q, _ := parseAPIQuotas("team-a=1/day")
+	for _, ref := range []string{"", "api-quotas", "dode/"} {
+		if err := q.useConfigMap(fake.NewSimpleClientset(), ref); err == nil {
+			t.Errorf("expected ConfigMap %q to be rejected", ref)
+		}
+	}
+}
+
+func TestNilAPIQuotas(t *testing.T) {
+	var q *apiQuotas
+	if err := q.check(context.Background(), "default"); err != nil {
+		t.Error(err)
+	}
+	if api := q.enforce(nil); api != nil {
+		t.Errorf("expected the API to be returned as is, got %v", api)
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRecordCacheTTL is how long a presented record is remembered.
+const defaultRecordCacheTTL = 2 * time.Minute
+
+// recordCache remembers the TXT records the webhook recently created, so that
+// cert-manager calling Present again for the same challenge doesn't result in
+// another API call. Entries expire after a short TTL so that records removed
+// outside of the webhook are eventually re-created.
+type recordCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	records map[string]map[string]time.Time // domain -> value -> expiry
+}
+
+func newRecordCache(ttl time.Duration) *recordCache {
+	return &recordCache{
+		ttl:     ttl,
+		now:     time.Now,
+		records: map[string]map[string]time.Time{},
+	}
+}
+
+// has reports whether value was presented at domain within the TTL.
+func (rc *recordCache) has(domain, value string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	expiry, ok := rc.records[domain][value]
+	if !ok {
+		return false
+	}
+	if rc.now().After(expiry) {
+		delete(rc.records[domain], value)
+		if len(rc.records[domain]) == 0 {
+			delete(rc.records, domain)
+		}
+		return false
+	}
+	return true
+}
+
+// add remembers that value was presented at domain.
+func (rc *recordCache) add(domain, value string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.records[domain] == nil {
+		rc.records[domain] = map[string]time.Time{}
+	}
+	rc.records[domain][value] = rc.now().Add(rc.ttl)
+}
+
+// invalidate forgets every value presented at domain.
+func (rc *recordCache) invalidate(domain string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	delete(rc.records, domain)
+}
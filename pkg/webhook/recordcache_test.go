@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	rc := newRecordCache(time.Minute)
+	rc.now = func() time.Time { return now }
+
+	rc.add("_acme-challenge.example.com", "a")
+	rc.add("_acme-challenge.example.com", "b")
+	if !rc.has("_acme-challenge.example.com", "a") || !rc.has("_acme-challenge.example.com", "b") {
+		t.Fatalf("expected both values to be cached")
+	}
+	if rc.has("_acme-challenge.example.com", "c") || rc.has("_acme-challenge.example.org", "a") {
+		t.Errorf("unexpected cache hit")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if rc.has("_acme-challenge.example.com", "a") {
+		t.Errorf("expected entry to expire")
+	}
+
+	rc.add("_acme-challenge.example.com", "a")
+	rc.invalidate("_acme-challenge.example.com")
+	if rc.has("_acme-challenge.example.com", "a") {
+		t.Errorf("expected entry to be invalidated")
+	}
+}
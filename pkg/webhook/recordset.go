@@ -0,0 +1,46 @@
+package webhook
+
+import "sort"
+
+// normalizeValues returns values sorted and without duplicates or empty
+// values, so that the same set of TXT values always results in the same
+// API calls in the same order.
+func normalizeValues(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var vs []string
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// diffValues returns the values to add to and to delete from current to get
+// desired, both normalized. The do.de API can only add a single value or
+// delete all values at a name, so a diff with deletions is applied by
+// deleting everything and adding back the values of desired; the diff tells
+// whether a deletion is needed at all.
+func diffValues(current, desired []string) (add, del []string) {
+	current, desired = normalizeValues(current), normalizeValues(desired)
+	have := make(map[string]bool, len(current))
+	for _, v := range current {
+		have[v] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, v := range desired {
+		want[v] = true
+		if !have[v] {
+			add = append(add, v)
+		}
+	}
+	for _, v := range current {
+		if !want[v] {
+			del = append(del, v)
+		}
+	}
+	return add, del
+}
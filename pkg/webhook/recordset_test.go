@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeValues(t *testing.T) {
+	got := normalizeValues([]string{"b", "a", "", "b", "c", "a"})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := normalizeValues(nil); got != nil {
+		t.Errorf("expected no values, got %q", got)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		current, desired []string
+		add, del         []string
+	}{
+		{current: nil, desired: []string{"b", "a", "a"}, add: []string{"a", "b"}},
+		{current: []string{"a", "b"}, desired: []string{"b", "a"}},
+		{current: []string{"a", "b", "c"}, desired: []string{"c"}, del: []string{"a", "b"}},
+		{current: []string{"a", "b"}, desired: []string{"b", "c"}, add: []string{"c"}, del: []string{"a"}},
+	}
+	for _, test := range tests {
+		add, del := diffValues(test.current, test.desired)
+		if !reflect.DeepEqual(add, test.add) || !reflect.DeepEqual(del, test.del) {
+			t.Errorf("%q -> %q: expected to add %q and delete %q, got %q and %q",
+				test.current, test.desired, test.add, test.del, add, del)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// challengesResource are cert-manager's ACME Challenges.
+var challengesResource = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}
+
+// finishedChallengeStates are the states of Challenges whose records are no
+// longer needed.
+var finishedChallengeStates = []string{"valid", "invalid", "expired", "errored"}
+
+// presentedRecord is a TXT value the webhook presented and hasn't cleaned up
+// yet, as served on /debug/records of the admin endpoint.
+type presentedRecord struct {
+	Domain      string    `json:"domain"`
+	Value       string    `json:"value"`
+	PresentedAt time.Time `json:"presentedAt"`
+}
+
+// records returns the values in the ledger, sorted by domain and value.
+func (l *recordLedger) records() []presentedRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rs []presentedRecord
+	for domain, values := range l.values {
+		for v, at := range values {
+			rs = append(rs, presentedRecord{Domain: domain, Value: v, PresentedAt: at})
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Domain != rs[j].Domain {
+			return rs[i].Domain < rs[j].Domain
+		}
+		return rs[i].Value < rs[j].Value
+	})
+	return rs
+}
+
+func (l *recordLedger) serveRecords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(l.records())
+}
+
+// challengeInfo is what the report needs to know about a Challenge.
+type challengeInfo struct {
+	namespace string
+	name      string
+	dnsName   string
+	key       string
+	state     string
+	created   time.Time
+}
+
+func (ch *challengeInfo) finished() bool {
+	return containsString(finishedChallengeStates, ch.state)
+}
+
+// reportEntry is a TXT value found at a challenge record name.
+type reportEntry struct {
+	name  string
+	value string
+	// since is when the value was presented, or, if the webhook doesn't
+	// know, when its Challenge was created. Zero if neither is known.
+	since     time.Time
+	challenge *challengeInfo
+}
+
+// stale reports whether no Challenge in progress needs the value.
+func (e *reportEntry) stale() bool {
+	return e.challenge == nil || e.challenge.finished()
+}
+
+// challengeRecordName returns the name of the challenge record of dnsName,
+// with a trailing dot.
+func challengeRecordName(dnsName string) string {
+	return "_acme-challenge." + normalizeName(strings.TrimPrefix(dnsName, "*.")) + "."
+}
+
+// reportNames returns the challenge record names in zone of the apex, of
+// dnsNames and of extra, sorted and without duplicates.
+func reportNames(zone string, dnsNames, extra []string) []string {
+	seen := map[string]bool{}
+	add := func(name string) {
+		if checkFQDNInZone(name, zone) == nil {
+			seen[strings.ToLower(name)] = true
+		}
+	}
+	add(challengeRecordName(zone))
+	for _, n := range dnsNames {
+		add(challengeRecordName(n))
+	}
+	for _, n := range extra {
+		add(normalizeName(n) + ".")
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildReport looks up the TXT values at names and matches them with
+// challenges and the records presented by the webhook.
+func buildReport(ctx context.Context, names []string, lookup func(ctx context.Context, fqdn string) ([]string, error),
+	challenges []challengeInfo, presented []presentedRecord) ([]reportEntry, error) {
+	byKey := map[string]*challengeInfo{}
+	for i := range challenges {
+		byKey[challenges[i].key] = &challenges[i]
+	}
+	presentedAt := map[string]time.Time{}
+	for _, r := range presented {
+		presentedAt[r.Value] = r.PresentedAt
+	}
+
+	var entries []reportEntry
+	for _, name := range names {
+		values, err := lookup(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("looking up TXT records at %s: %v", name, err)
+		}
+		sort.Strings(values)
+		for _, v := range values {
+			e := reportEntry{name: name, value: v, since: presentedAt[v], challenge: byKey[v]}
+			if e.since.IsZero() && e.challenge != nil {
+				e.since = e.challenge.created
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// writeReport prints entries as a table followed by the names that can be
+// cleaned up. As the API deletes all values at a name at once, a name is
+// only recommended for cleanup if none of its values is still needed.
+func writeReport(w io.Writer, zone string, entries []reportEntry, now time.Time) {
+	if len(entries) == 0 {
+		fmt.Fprintf(w, "No _acme-challenge TXT records found in %s.\n", zone)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tAGE\tCHALLENGE\tSTATUS")
+	var (
+		names   []string
+		seen    = map[string]bool{}
+		stale   = map[string]int{}
+		inUse   = map[string]bool{}
+		summary = map[bool]int{}
+	)
+	for i := range entries {
+		e := &entries[i]
+		age := "unknown"
+		if !e.since.IsZero() {
+			age = now.Sub(e.since).Round(time.Minute).String()
+		}
+		challenge, status := "-", "stale"
+		if e.challenge != nil {
+			challenge = fmt.Sprintf("%s/%s (%s)", e.challenge.namespace, e.challenge.name, e.challenge.state)
+		}
+		if !e.stale() {
+			status = "in use"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.name, e.value, age, challenge, status)
+
+		if !seen[e.name] {
+			seen[e.name] = true
+			names = append(names, e.name)
+		}
+		if e.stale() {
+			stale[e.name]++
+		} else {
+			inUse[e.name] = true
+		}
+		summary[e.stale()]++
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d stale and %d in use values at %d names.\n", summary[true], summary[false], len(names))
+	var cleanup []string
+	for _, name := range names {
+		if stale[name] == 0 {
+			continue
+		}
+		if inUse[name] {
+			fmt.Fprintf(w, "Wait for the challenges in progress at %s before cleaning up its %d stale values.\n", name, stale[name])
+			continue
+		}
+		cleanup = append(cleanup, name)
+	}
+	if len(cleanup) == 0 {
+		fmt.Fprintln(w, "Nothing to clean up.")
+		return
+	}
+	fmt.Fprintln(w, "Recommended cleanup, deleting all TXT values at:")
+	for _, name := range cleanup {
+		fmt.Fprintf(w, "  %s (%d stale)\n", name, stale[name])
+	}
+}
+
+// listChallenges returns the Challenges in the cluster.
+func listChallenges(ctx context.Context, client dynamic.Interface) ([]challengeInfo, error) {
+	list, err := client.Resource(challengesResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing Challenges: %w", err)
+	}
+	var challenges []challengeInfo
+	for i := range list.Items {
+		item := &list.Items[i]
+		ch := challengeInfo{namespace: item.GetNamespace(), name: item.GetName()}
+		ch.dnsName, _, _ = unstructured.NestedString(item.Object, "spec", "dnsName")
+		ch.key, _, _ = unstructured.NestedString(item.Object, "spec", "key")
+		ch.state, _, _ = unstructured.NestedString(item.Object, "status", "state")
+		if created, _, _ := unstructured.NestedString(item.Object, "metadata", "creationTimestamp"); created != "" {
+			ch.created, _ = time.Parse(time.RFC3339, created)
+		}
+		challenges = append(challenges, ch)
+	}
+	return challenges, nil
+}
+
+// listCertificateDNSNames returns the names requested by the Certificates in
+// the cluster.
+func listCertificateDNSNames(ctx context.Context, client dynamic.Interface) ([]string, error) {
+	list, err := client.Resource(certificatesResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing Certificates: %w", err)
+	}
+	var names []string
+	for i := range list.Items {
+		names = append(names, certificateDNSNames(&list.Items[i])...)
+	}
+	return names, nil
+}
+
+// fetchPresentedRecords reads the records presented by the webhook from its
+// admin endpoint at adminURL.
+func fetchPresentedRecords(ctx context.Context, adminURL string) ([]presentedRecord, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(adminURL, "/")+"/debug/records", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin endpoint returned status %d", resp.StatusCode)
+	}
+	var records []presentedRecord
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, fmt.Errorf("decoding presented records: %v", err)
+	}
+	return records, nil
+}
+
+// authoritativeLookup returns a function looking up TXT records on the
+// first nameserver of zone, so that the report isn't skewed by caches.
+func authoritativeLookup(ctx context.Context, zone string) (func(ctx context.Context, fqdn string) ([]string, error), error) {
+	ns, err := net.DefaultResolver.LookupNS(ctx, normalizeName(zone)+".")
+	if err != nil {
+		return nil, fmt.Errorf("looking up the nameservers of %s: %w", zone, err)
+	}
+	if len(ns) == 0 {
+		return nil, fmt.Errorf("%s has no nameservers", zone)
+	}
+	return newDNSResolver(ns[0].Host).lookupTXT, nil
+}
+
+// runReport runs the report subcommand with args and exits with the exit
+// code of its failure category.
+func runReport(args []string) {
+	os.Exit(executeSubcommand(newReportCommand(), args, os.Stderr))
+}
+
+// newReportCommand returns the report subcommand, which lists the
+// _acme-challenge TXT records of a zone and recommends which to clean up.
+// The API can't list records, so the report looks up the names of the
+// Certificates and Challenges in the cluster and those given with --name.
+func newReportCommand() *cobra.Command {
+	var (
+		zone, kubeconfig, adminURL string
+		names                      []string
+	)
+	cmd := &cobra.Command{
+		Use:          "report",
+		Short:        "List the _acme-challenge TXT records of a zone and recommend which to clean up.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if zone == "" {
+				return classify(errorClassConfig, fmt.Errorf("--zone is required"))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+			if err != nil {
+				return classify(errorClassConfig, err)
+			}
+			client, err := dynamic.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+			challenges, err := listChallenges(ctx, client)
+			if err != nil {
+				return err
+			}
+			dnsNames, err := listCertificateDNSNames(ctx, client)
+			if err != nil {
+				return err
+			}
+			for _, ch := range challenges {
+				dnsNames = append(dnsNames, ch.dnsName)
+			}
+			var presented []presentedRecord
+			if adminURL != "" {
+				if presented, err = fetchPresentedRecords(ctx, adminURL); err != nil {
+					return err
+				}
+			}
+			lookup, err := authoritativeLookup(ctx, zone)
+			if err != nil {
+				return err
+			}
+			entries, err := buildReport(ctx, reportNames(zone, dnsNames, names), lookup, challenges, presented)
+			if err != nil {
+				return err
+			}
+			writeReport(cmd.OutOrStdout(), zone, entries, time.Now())
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&zone, "zone", "", "Zone to report on, e.g. example.com.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig of the cluster to read Certificates and Challenges from. Uses the in-cluster config if empty.")
+	fs.StringVar(&adminURL, "admin-url", "", "URL of the admin endpoint of a running webhook (--dode.admin-bind-address), to report when values were presented.")
+	fs.StringSliceVar(&names, "name", nil, "Further record names to look up, e.g. of Certificates deleted since.")
+	return cmd
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportNames(t *testing.T) {
+	got := reportNames("example.com.", []string{"www.example.com", "*.example.com", "example.org", "WWW.example.com"}, []string{"_acme-challenge.old.example.com"})
+	want := []string{"_acme-challenge.example.com.", "_acme-challenge.old.example.com.", "_acme-challenge.www.example.com."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	txt := map[string][]string{
+		"_acme-challenge.example.com.":     {"old", "pending-key"},
+		"_acme-challenge.www.example.com.": {"done-key", "forgotten"},
+	}
+	lookup := func(ctx context.Context, fqdn string) ([]string, error) { return txt[fqdn], nil }
+	challenges := []challengeInfo{
+		{namespace: "default", name: "pending", key: "pending-key", state: "pending", created: now.Add(-5 * time.Minute)},
+		{namespace: "default", name: "done", key: "done-key", state: "valid", created: now.Add(-time.Hour)},
+	}
+	presented := []presentedRecord{{Domain: "_acme-challenge.www.example.com", Value: "forgotten", PresentedAt: now.Add(-72 * time.Hour)}}
+
+	entries, err := buildReport(context.Background(), []string{"_acme-challenge.example.com.", "_acme-challenge.www.example.com."},
+		lookup, challenges, presented)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeReport(&buf, "example.com.", entries, now)
+	out := buf.String()
+	for _, want := range []string{
+		"pending-key  5m0s",
+		"default/pending (pending)  in use",
+		"forgotten    72h0m0s",
+		"3 stale and 1 in use values at 2 names.",
+		"Wait for the challenges in progress at _acme-challenge.example.com. before cleaning up its 1 stale values.",
+		"  _acme-challenge.www.example.com. (2 stale)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected report to contain %q, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "  _acme-challenge.example.com. (") {
+		t.Errorf("expected the name with a challenge in progress not to be recommended for cleanup:\n%s", out)
+	}
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog"
+)
+
+// Classes of errors reported in ChallengeResult.ErrorClass.
+const (
+	errorClassConfig      = "config"
+	errorClassCredentials = "credentials"
+	errorClassApproval    = "approval"
+	errorClassBackoff     = "backoff"
+	errorClassQuota       = "quota"
+	errorClassHook        = "hook"
+	errorClassProvider    = "provider"
+	errorClassPropagation = "propagation"
+	errorClassExpired     = "expired"
+	errorClassInternal    = "internal"
+	errorClassUnknown     = "unknown"
+)
+
+// classifiedError attaches an error class to an error without changing its
+// message.
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// classify marks err as belonging to class. Already classified errors and
+// nil are returned unchanged.
+func classify(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// errorClass returns the class err was marked with.
+func errorClass(err error) string {
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return errorClassUnknown
+}
+
+// keyDigest returns the first 8 hex digits of the SHA-256 digest of the key
+// of a challenge. Logs name keys by their digest, which is enough to tell
+// the records of challenges apart without spreading their values.
+func keyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// ChallengeResult summarizes a single Present or CleanUp operation. It is
+// logged as one line at the end of every operation, the line to grep for
+// when investigating a challenge.
+type ChallengeResult struct {
+	Action    string
+	Namespace string
+	FQDN      string
+	Zone      string
+	// KeyDigest identifies the key of the challenge, see keyDigest.
+	KeyDigest     string
+	Attempts      int32
+	MaxAPILatency time.Duration
+	// FirstAPICallDelay is the time from the start of the operation to its
+	// first API call, zero if it made none.
+	FirstAPICallDelay time.Duration
+	Duration          time.Duration
+	Outcome           string
+	ErrorClass        string
+	Error             string
+	// TraceID is the W3C trace ID of the operation, set with
+	// --dode.trace-context.
+	TraceID string
+
+	start time.Time
+	// tokenRefs are the Secrets the tokens of the operation were read from,
+	// in the order they are tried, and tokenIndex the index of the token
+	// the last API call used.
+	tokenRefs  []secretKeySelector
+	tokenIndex int32
+}
+
+func newChallengeResult(action string, ch *v1alpha1.ChallengeRequest) *ChallengeResult {
+	r := &ChallengeResult{
+		Action:    action,
+		Namespace: ch.ResourceNamespace,
+		FQDN:      ch.ResolvedFQDN,
+		Zone:      ch.ResolvedZone,
+		KeyDigest: keyDigest(ch.Key),
+		start:     time.Now(),
+	}
+	if *traceContext {
+		r.TraceID = newTraceID()
+	}
+	return r
+}
+
+// String formats the result as logfmt.
+func (r *ChallengeResult) String() string {
+	fields := []string{
+		"action=" + r.Action,
+		"namespace=" + r.Namespace,
+		"fqdn=" + r.FQDN,
+		"zone=" + r.Zone,
+		"key=" + r.KeyDigest,
+		"attempts=" + strconv.Itoa(int(atomic.LoadInt32(&r.Attempts))),
+		"max_api_latency=" + r.maxAPILatency().String(),
+		"time_to_first_api_call=" + r.firstAPICallDelay().String(),
+		"duration=" + r.Duration.String(),
+		"outcome=" + r.Outcome,
+	}
+	if r.ErrorClass != "" {
+		fields = append(fields, "error_class="+r.ErrorClass, "error="+strconv.Quote(r.Error))
+	}
+	if r.TraceID != "" {
+		fields = append(fields, "trace_id="+r.TraceID)
+	}
+	return strings.Join(fields, " ")
+}
+
+// finish completes the result with the outcome *errp of the operation, logs
+// it and records it in the challenge metrics. It must be deferred.
+func (r *ChallengeResult) finish(errp *error) {
+	r.Duration = time.Since(r.start)
+	r.Outcome = "success"
+	if err := *errp; err != nil {
+		r.Outcome = "error"
+		r.ErrorClass = errorClass(err)
+		r.Error = err.Error()
+	}
+
+	challengeResults.WithLabelValues(r.Action, r.Outcome, r.ErrorClass).Inc()
+	challengeDuration.WithLabelValues(r.Action, r.Outcome).Observe(r.Duration.Seconds())
+	if r.Outcome == "success" {
+		klog.Infof("challenge result: %s", r)
+	} else {
+		klog.Warningf("challenge result: %s", r)
+	}
+}
+
+type challengeResultKey struct{}
+
+// withChallengeResult returns a context carrying r, so that API calls made
+// on behalf of the operation are counted as its attempts.
+func withChallengeResult(ctx context.Context, r *ChallengeResult) context.Context {
+	return context.WithValue(ctx, challengeResultKey{}, r)
+}
+
+// countAttempt records an API call in the result carried by ctx, if any.
+func countAttempt(ctx context.Context) {
+	if r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult); ok {
+		atomic.AddInt32(&r.Attempts, 1)
+	}
+}
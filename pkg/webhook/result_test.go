@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestErrorClass(t *testing.T) {
+	err := classify(errorClassProvider, errors.New("boom"))
+	if got := errorClass(err); got != errorClassProvider {
+		t.Errorf("expected class %q, got %q", errorClassProvider, got)
+	}
+	if err.Error() != "boom" {
+		t.Errorf("classify changed the message to %q", err)
+	}
+	if got := errorClass(classify(errorClassConfig, err)); got != errorClassProvider {
+		t.Errorf("reclassifying must keep the innermost class, got %q", got)
+	}
+	if got := errorClass(fmt.Errorf("plain")); got != errorClassUnknown {
+		t.Errorf("expected class %q for unclassified errors, got %q", errorClassUnknown, got)
+	}
+	if classify(errorClassConfig, nil) != nil {
+		t.Errorf("classifying nil must return nil")
+	}
+}
+
+func TestKeyDigest(t *testing.T) {
+	// The first 8 hex digits of sha256("abc").
+	if got := keyDigest("abc"); got != "ba7816bf" {
+		t.Errorf("expected ba7816bf, got %q", got)
+	}
+	if keyDigest("a") == keyDigest("b") {
+		t.Errorf("expected different keys to have different digests")
+	}
+}
+
+func TestChallengeResultCountsAttempts(t *testing.T) {
+	api := newFakeDodeAPI("token")
+	defer api.Close()
+	c := newTestSolver(api)
+	const domain = "_acme-challenge.example.com"
+
+	res := newChallengeResult("CleanUp", &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: domain + ".",
+		ResolvedZone: "example.com.",
+	})
+	ctx := withChallengeResult(context.Background(), res)
+	for _, key := range []string{"a", "b"} {
+		if err := c.addRecord(context.Background(), c.api, "token", "example.com.", domain, key, defaultTTL, 0); err != nil {
+			t.Fatalf("presenting %s: %v", key, err)
+		}
+	}
+	// Deleting a restores b, so two API calls are made.
+	err := c.removeRecord(ctx, c.api, "token", "example.com.", domain, "a", defaultTTL)
+	res.finish(&err)
+	if res.Attempts != 2 || res.Outcome != "success" {
+		t.Errorf("unexpected result %s", res)
+	}
+
+	err = c.removeRecord(ctx, c.api, "wrong", "example.com.", domain, "b", defaultTTL)
+	res.finish(&err)
+	if res.Outcome != "error" || res.ErrorClass != errorClassProvider {
+		t.Errorf("unexpected result %s", res)
+	}
+	if s := res.String(); !strings.Contains(s, "fqdn=_acme-challenge.example.com.") || !strings.Contains(s, "error_class=provider") {
+		t.Errorf("unexpected logfmt %q", s)
+	}
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"k8s.io/klog"
+)
+
+const (
+	// defaultInitialBackoff is the delay before the first retry of configs
+	// setting maxRetries but not initialBackoffSeconds. Every further retry
+	// doubles it.
+	defaultInitialBackoff = time.Second
+	// defaultMaxBackoff caps the delay between retries of configs not
+	// setting maxBackoffSeconds.
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// retryingAPI retries calls that failed transiently, e.g. with a timeout or
+// a 503, up to maxRetries times with exponential backoff, before the error
+// is returned to cert-manager, which retries challenges only much later.
+// The zone backoff and the credential stats only see the outcome of the last
+// attempt.
+type retryingAPI struct {
+	dodeAPI
+	maxRetries int
+	initial    time.Duration
+	max        time.Duration
+}
+
+// withRetries returns the API of cfg, retrying transient failures if cfg
+// sets maxRetries.
+func withRetries(api dodeAPI, cfg *dodeDNSProviderConfig) dodeAPI {
+	if cfg.MaxRetries <= 0 {
+		return api
+	}
+	r := &retryingAPI{dodeAPI: api, maxRetries: cfg.MaxRetries, initial: defaultInitialBackoff, max: defaultMaxBackoff}
+	if cfg.InitialBackoffSeconds > 0 {
+		r.initial = seconds(cfg.InitialBackoffSeconds)
+	}
+	if cfg.MaxBackoffSeconds > 0 {
+		r.max = seconds(cfg.MaxBackoffSeconds)
+	}
+	return r
+}
+
+func (a *retryingAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	return a.retry(ctx, func() error {
+		return a.dodeAPI.Present(ctx, token, domain, value, ttl)
+	})
+}
+
+func (a *retryingAPI) CleanUp(ctx context.Context, token, domain string) error {
+	return a.retry(ctx, func() error {
+		return a.dodeAPI.CleanUp(ctx, token, domain)
+	})
+}
+
+func (a *retryingAPI) retry(ctx context.Context, call func() error) error {
+	err := call()
+	delay := a.initial
+	for i := 0; i < a.maxRetries && isTransient(err); i++ {
+		klog.V(4).Infof("DODE API call failed transiently, retry %d of %d in %s: %v", i+1, a.maxRetries, delay, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		if delay *= 2; delay > a.max {
+			delay = a.max
+		}
+		err = call()
+	}
+	return err
+}
+
+// isTransient reports whether err may go away by retrying the call: any
+// failure to get a response, and 429 and 5xx responses. Errors reported by
+// the API in its response body, such as an invalid token, are permanent.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *dode.Error
+	if !errors.As(err, &e) {
+		return true
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// flakyAPI fails the first len(errs) calls with errs, in order.
+type flakyAPI struct {
+	errs  []error
+	calls int
+}
+
+func (a *flakyAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	return a.CleanUp(ctx, token, domain)
+}
+
+func (a *flakyAPI) CleanUp(context.Context, string, string) error {
+	a.calls++
+	if a.calls <= len(a.errs) {
+		return a.errs[a.calls-1]
+	}
+	return nil
+}
+
+func TestRetryingAPI(t *testing.T) {
+	unavailable := &dode.Error{StatusCode: http.StatusServiceUnavailable}
+	for _, test := range []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds after transient failures", []error{unavailable, errors.New("connection reset")}, 3, false},
+		{"gives up after maxRetries", []error{unavailable, unavailable, unavailable, unavailable}, 3, true},
+		{"doesn't retry permanent errors", []error{&dode.Error{StatusCode: http.StatusOK, Message: "invalid token"}}, 1, true},
+		{"doesn't retry client errors", []error{&dode.Error{StatusCode: http.StatusBadRequest}}, 1, true},
+	} {
+		api := &flakyAPI{errs: test.errs}
+		r := &retryingAPI{dodeAPI: api, maxRetries: 2, initial: time.Millisecond, max: 2 * time.Millisecond}
+		err := r.Present(context.Background(), "token", "_acme-challenge.example.com", "key", defaultTTL)
+		if (err != nil) != test.wantErr || api.calls != test.wantCalls {
+			t.Errorf("%s: expected %d calls and error %v, got %d calls and %v", test.name, test.wantCalls, test.wantErr, api.calls, err)
+		}
+	}
+}
+
+func TestRetryingAPIStopsWithContext(t *testing.T) {
+	api := &flakyAPI{errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	r := &retryingAPI{dodeAPI: api, maxRetries: 1, initial: time.Hour, max: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.CleanUp(ctx, "token", "_acme-challenge.example.com"); err == nil || api.calls != 1 {
+		t.Errorf("expected to give up once the context is done, got %d calls and %v", api.calls, err)
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	api := &flakyAPI{}
+	if withRetries(api, &dodeDNSProviderConfig{}) != dodeAPI(api) {
+		t.Errorf("expected no retries without maxRetries")
+	}
+	r, ok := withRetries(api, &dodeDNSProviderConfig{MaxRetries: 3, MaxBackoffSeconds: 10}).(*retryingAPI)
+	if !ok {
+		t.Fatal("expected retries with maxRetries")
+	}
+	if r.maxRetries != 3 || r.initial != defaultInitialBackoff || r.max != 10*time.Second {
+		t.Errorf("unexpected retry settings %+v", r)
+	}
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// tokenRotation is a rotation of the API token stored in a Secret.
+type tokenRotation struct {
+	namespace, name string
+	// key is the key of the Secret to store the token under. If empty, the
+	// key the webhook finds the token under is used.
+	key      string
+	newToken string
+	// canaryDomain is the name whose _acme-challenge record is presented
+	// and deleted to check tokens. It should not be used by Certificates,
+	// as deleting the canary deletes all values at the name.
+	canaryDomain string
+}
+
+// run checks the new token against api, stores it in the Secret and checks
+// the token the webhook now reads from the Secret with a canary challenge.
+// The Secret is restored if the canary fails.
+func (r *tokenRotation) run(ctx context.Context, client kubernetes.Interface, api dodeAPI, out io.Writer) error {
+	secrets := client.CoreV1().Secrets(r.namespace)
+	sec, err := secrets.Get(ctx, r.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading secret %s/%s: %w", r.namespace, r.name, err)
+	}
+	keys := defaultAPITokenSecretKeys
+	if r.key != "" {
+		keys = []string{r.key}
+	}
+	_, key, legacy, found := tokenFromSecret(sec, keys)
+	if legacy {
+		return classify(errorClassConfig, fmt.Errorf("secret %s/%s holds the token as an env file under key %q; pass --key to store the new token under a key of its own", r.namespace, r.name, key))
+	}
+	if !found {
+		key = keys[0]
+	}
+
+	fmt.Fprintf(out, "Checking the new token with a canary challenge for %s.\n", r.canaryDomain)
+	if err := r.canary(ctx, api, r.newToken); err != nil {
+		return fmt.Errorf("the new token was not accepted, secret %s/%s left unchanged: %w", r.namespace, r.name, err)
+	}
+
+	old, hadKey := sec.Data[key]
+	updated := sec.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+	updated.Data[key] = []byte(r.newToken)
+	if updated, err = secrets.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("updating secret %s/%s: %w", r.namespace, r.name, err)
+	}
+	fmt.Fprintf(out, "Stored the new token in secret %s/%s under key %q.\n", r.namespace, r.name, key)
+
+	err = r.verify(ctx, client, api, key)
+	if err == nil {
+		fmt.Fprintln(out, "Verified a canary challenge with the token read back from the secret. Revoke the old token once running challenges finished.")
+		return nil
+	}
+	if hadKey {
+		updated.Data[key] = old
+	} else {
+		delete(updated.Data, key)
+	}
+	if _, rbErr := secrets.Update(ctx, updated, metav1.UpdateOptions{}); rbErr != nil {
+		return fmt.Errorf("canary challenge with the stored token failed: %v; rolling back secret %s/%s failed as well: %w", err, r.namespace, r.name, rbErr)
+	}
+	fmt.Fprintf(out, "Rolled back secret %s/%s.\n", r.namespace, r.name)
+	return fmt.Errorf("canary challenge with the stored token failed, secret %s/%s rolled back: %w", r.namespace, r.name, err)
+}
+
+// verify reads the token from the Secret like the webhook does and checks it
+// with a canary challenge.
+func (r *tokenRotation) verify(ctx context.Context, client kubernetes.Interface, api dodeAPI, key string) error {
+	sec, err := client.CoreV1().Secrets(r.namespace).Get(ctx, r.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	token, _, _, ok := tokenFromSecret(sec, []string{key})
+	if !ok || token != r.newToken {
+		return fmt.Errorf("secret %s/%s doesn't hold the new token under key %q", r.namespace, r.name, key)
+	}
+	return r.canary(ctx, api, token)
+}
+
+// canary presents a TXT record at the canary name with token and deletes it
+// again.
+func (r *tokenRotation) canary(ctx context.Context, api dodeAPI, token string) error {
+	domain := dode.Domain(challengeRecordName(r.canaryDomain))
+	value := fmt.Sprintf("dode-rotate-token-%d", time.Now().Unix())
+	if err := api.Present(ctx, token, domain, value, minTTL); err != nil {
+		return err
+	}
+	return api.CleanUp(ctx, token, domain)
+}
+
+// runRotateToken runs the rotate-token subcommand with args and exits with
+// the exit code of its failure category.
+func runRotateToken(args []string) {
+	os.Exit(executeSubcommand(newRotateTokenCommand(), args, os.Stderr))
+}
+
+// newRotateTokenCommand returns the rotate-token subcommand, which replaces
+// the API token in a Secret only after the DODE API accepted it, and rolls
+// the Secret back unless a canary challenge succeeds with the stored token.
+func newRotateTokenCommand() *cobra.Command {
+	var (
+		r                                   tokenRotation
+		secret, tokenFile, kubeconfig, base string
+	)
+	cmd := &cobra.Command{
+		Use:          "rotate-token",
+		Short:        "Replace the API token in a Secret, checking it with canary challenges and rolling back on failure.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parts := strings.SplitN(secret, "/", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return classify(errorClassConfig, fmt.Errorf("--secret must be of the form namespace/name, got %q", secret))
+			}
+			r.namespace, r.name = parts[0], parts[1]
+			if tokenFile == "" || r.canaryDomain == "" {
+				return classify(errorClassConfig, fmt.Errorf("--new-token-file and --canary-domain are required"))
+			}
+			data, err := ioutil.ReadFile(tokenFile)
+			if err != nil {
+				return classify(errorClassConfig, err)
+			}
+			if r.newToken = strings.TrimSpace(string(data)); r.newToken == "" {
+				return classify(errorClassConfig, fmt.Errorf("%s is empty", tokenFile))
+			}
+			if err := validateAPIURL(base); err != nil {
+				return classify(errorClassConfig, fmt.Errorf("--api-url %v", err))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+			if err != nil {
+				return classify(errorClassConfig, err)
+			}
+			client, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+			return r.run(ctx, client, dode.NewClient(dode.WithBaseURL(base)), cmd.OutOrStdout())
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&secret, "secret", "", "Secret (namespace/name) holding the API token to replace.")
+	fs.StringVar(&r.key, "key", "", "Key of the Secret to store the token under. Defaults to the key the webhook finds the current token under, or "+defaultAPITokenSecretKeys[0]+".")
+	fs.StringVar(&tokenFile, "new-token-file", "", "File holding the new API token.")
+	fs.StringVar(&r.canaryDomain, "canary-domain", "", "Domain whose _acme-challenge record is presented and deleted to check the tokens, e.g. rotate-canary.example.com. Must not be used by Certificates.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig of the cluster holding the Secret. Uses the in-cluster config if empty.")
+	fs.StringVar(&base, "api-url", dode.DefaultAPIURL, "DODE API endpoint to check the tokens against.")
+	return cmd
+}
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTokenRotation(t *testing.T) {
+	rejected := &dode.Error{StatusCode: http.StatusOK, Message: "invalid token"}
+	for _, test := range []struct {
+		name      string
+		errs      []error
+		wantToken string
+		wantErr   string
+	}{
+		{name: "rotated", wantToken: "new-token"},
+		{name: "new token rejected", errs: []error{rejected}, wantToken: "old-token", wantErr: "left unchanged"},
+		{name: "canary fails", errs: []error{nil, nil, rejected}, wantToken: "old-token", wantErr: "rolled back"},
+	} {
+		client := fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "dode"},
+			Data:       map[string][]byte{"api-token": []byte("old-token")},
+		})
+		api := &flakyAPI{errs: test.errs}
+		r := &tokenRotation{namespace: "cert-manager", name: "dode", newToken: "new-token", canaryDomain: "canary.example.com"}
+		ctx := context.Background()
+		var out bytes.Buffer
+
+		err := r.run(ctx, client, api, &out)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+		}
+		sec, err := client.CoreV1().Secrets("cert-manager").Get(ctx, "dode", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(sec.Data["api-token"]); got != test.wantToken {
+			t.Errorf("%s: expected the secret to hold %q under the existing key, got %q", test.name, test.wantToken, got)
+		}
+	}
+}
+
+func TestTokenRotationRefusesEnvFile(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "dode"},
+		Data:       map[string][]byte{"env": []byte("DODE_TOKEN=old-token\n")},
+	})
+	r := &tokenRotation{namespace: "cert-manager", name: "dode", newToken: "new-token", canaryDomain: "canary.example.com"}
+	err := r.run(context.Background(), client, &flakyAPI{}, &bytes.Buffer{})
+	if exitCode(err) != exitValidation {
+		t.Errorf("expected a validation error for an env file, got %v", err)
+	}
+}
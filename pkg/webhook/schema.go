@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+// schemaFile is the file in the writable directory the known response
+// shapes are kept in.
+const schemaFile = "api-response-schema.json"
+
+// baselineShapes are the shapes of the responses of the do.de API at the
+// time of writing: success and failure.
+var baselineShapes = [][]string{
+	{"success:bool"},
+	{"error:string", "success:bool"},
+}
+
+// schemaTracker warns when the API answers with a response whose structure,
+// the set of its field paths and their JSON types, was never seen before.
+// That is an early sign of the provider changing its API before the change
+// breaks challenges outright. Known shapes are kept in a file in the
+// writable directory, so that a shape is only reported once even across
+// restarts.
+type schemaTracker struct {
+	path string
+
+	mu    sync.Mutex
+	known map[string][]string
+}
+
+// newSchemaTracker returns a tracker knowing the baseline shapes and those
+// stored in dir, if any.
+func newSchemaTracker(dir string) *schemaTracker {
+	t := &schemaTracker{known: map[string][]string{}}
+	for _, shape := range baselineShapes {
+		t.known[strings.Join(shape, ",")] = shape
+	}
+	if dir == "" {
+		return t
+	}
+	t.path = filepath.Join(dir, schemaFile)
+	data, err := ioutil.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return t
+	}
+	var shapes [][]string
+	if err == nil {
+		err = json.Unmarshal(data, &shapes)
+	}
+	if err != nil {
+		klog.Warningf("failed to read known API response shapes from %s: %v", t.path, err)
+		return t
+	}
+	for _, shape := range shapes {
+		t.known[strings.Join(shape, ",")] = shape
+	}
+	return t
+}
+
+// observe checks the structure of the decoded response v.
+func (t *schemaTracker) observe(v interface{}) {
+	shape := responseShape(v)
+	key := strings.Join(shape, ",")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.known[key]; ok {
+		return
+	}
+	added, removed := shapeDiff(t.closest(shape), shape)
+	apiSchemaDrift.Inc()
+	klog.Warningf("DODE API answered with a response of unknown structure, the API may have changed: new fields %q, missing fields %q", added, removed)
+	t.known[key] = shape
+	t.save()
+}
+
+// closest returns the known shape sharing the most fields with shape. The
+// caller must hold t.mu.
+func (t *schemaTracker) closest(shape []string) []string {
+	var (
+		best      []string
+		bestScore = -1
+	)
+	keys := make([]string, 0, len(t.known))
+	for k := range t.known {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		added, removed := shapeDiff(t.known[k], shape)
+		if score := len(shape) - len(added) - len(removed); score > bestScore {
+			best, bestScore = t.known[k], score
+		}
+	}
+	return best
+}
+
+// save writes the known shapes to t.path. The caller must hold t.mu.
+func (t *schemaTracker) save() {
+	if t.path == "" {
+		return
+	}
+	shapes := make([][]string, 0, len(t.known))
+	for _, shape := range t.known {
+		shapes = append(shapes, shape)
+	}
+	sort.Slice(shapes, func(i, j int) bool {
+		return strings.Join(shapes[i], ",") < strings.Join(shapes[j], ",")
+	})
+	data, err := json.Marshal(shapes)
+	if err == nil {
+		err = ioutil.WriteFile(t.path, data, 0644)
+	}
+	if err != nil {
+		klog.Warningf("failed to store known API response shapes in %s: %v", t.path, err)
+	}
+}
+
+// responseShape returns the sorted field paths of v with their JSON types,
+// e.g. "success:bool" or "data[].id:number". Elements of arrays share the
+// path of the array.
+func responseShape(v interface{}) []string {
+	fields := map[string]bool{}
+	collectShape(fields, "", v)
+	shape := make([]string, 0, len(fields))
+	for f := range fields {
+		shape = append(shape, f)
+	}
+	sort.Strings(shape)
+	return shape
+}
+
+func collectShape(fields map[string]bool, path string, v interface{}) {
+	field := func(typ string) {
+		fields[path+":"+typ] = true
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if path != "" {
+			field("object")
+		}
+		for k, e := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			collectShape(fields, p, e)
+		}
+	case []interface{}:
+		field("array")
+		for _, e := range t {
+			collectShape(fields, path+"[]", e)
+		}
+	case string:
+		field("string")
+	case float64:
+		field("number")
+	case bool:
+		field("bool")
+	case nil:
+		field("null")
+	}
+}
+
+// shapeDiff returns the fields of b missing in a and those of a missing in b.
+func shapeDiff(a, b []string) (added, removed []string) {
+	inA := map[string]bool{}
+	for _, f := range a {
+		inA[f] = true
+	}
+	inB := map[string]bool{}
+	for _, f := range b {
+		inB[f] = true
+		if !inA[f] {
+			added = append(added, f)
+		}
+	}
+	for _, f := range a {
+		if !inB[f] {
+			removed = append(removed, f)
+		}
+	}
+	return added, removed
+}
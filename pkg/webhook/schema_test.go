@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestResponseShape(t *testing.T) {
+	got := responseShape(decodeJSON(t, `{"success":true,"data":{"records":[{"id":1},{"id":2,"ttl":null}]}}`))
+	want := []string{"data.records:array", "data.records[].id:number", "data.records[].ttl:null", "data.records[]:object", "data:object", "success:bool"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSchemaTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tr := newSchemaTracker(dir)
+	tr.observe(decodeJSON(t, `{"success":true}`))
+	tr.observe(decodeJSON(t, `{"success":false,"error":"invalid token"}`))
+	if _, err := os.Stat(tr.path); !os.IsNotExist(err) {
+		t.Errorf("expected known shapes not to be stored, got %v", err)
+	}
+
+	tr.observe(decodeJSON(t, `{"success":true,"requestId":"abc"}`))
+	if len(tr.known) != len(baselineShapes)+1 {
+		t.Errorf("expected the new shape to be known, got %q", tr.known)
+	}
+
+	// A restarted webhook knows the shape from the file.
+	tr = newSchemaTracker(dir)
+	if _, ok := tr.known["requestId:string,success:bool"]; !ok {
+		t.Errorf("expected the stored shape to be loaded, got %q", tr.known)
+	}
+
+	added, removed := shapeDiff([]string{"error:string", "success:bool"}, []string{"error:object", "success:bool"})
+	if !reflect.DeepEqual(added, []string{"error:object"}) || !reflect.DeepEqual(removed, []string{"error:string"}) {
+		t.Errorf("unexpected diff %q, %q", added, removed)
+	}
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// secretCache serves the Secrets of a few namespaces from informers instead
+// of fetching them from the API server for every Present and CleanUp. It
+// only answers for the clientset its informers were started with, so that
+// workload clusters and rebuilt clients keep reading Secrets live.
+type secretCache struct {
+	client  kubernetes.Interface
+	listers map[string]corelisters.SecretNamespaceLister
+}
+
+// newSecretCache starts an informer on the Secrets of each of namespaces and
+// waits for them to sync.
+func newSecretCache(client kubernetes.Interface, namespaces []string, stopCh <-chan struct{}) (*secretCache, error) {
+	s := &secretCache{
+		client:  client,
+		listers: make(map[string]corelisters.SecretNamespaceLister),
+	}
+	var synced []cache.InformerSynced
+	for _, ns := range namespaces {
+		if ns == "" || s.listers[ns] != nil {
+			continue
+		}
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(ns))
+		secrets := factory.Core().V1().Secrets()
+		s.listers[ns] = secrets.Lister().Secrets(ns)
+		synced = append(synced, secrets.Informer().HasSynced)
+		factory.Start(stopCh)
+	}
+	if !cache.WaitForCacheSync(stopCh, synced...) {
+		return nil, fmt.Errorf("secrets of namespaces %q did not sync", namespaces)
+	}
+	klog.Infof("serving the secrets of namespaces %q from cache", namespaces)
+	return s, nil
+}
+
+// parseNamespaces splits a comma separated list of namespaces.
+func parseNamespaces(s string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(s, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// get returns the Secret namespace/name from the cache. ok is false if the
+// cache can't answer, as it doesn't hold namespace or client is not the one
+// it was built with. Secrets that don't exist are reported with a NotFound
+// error like a live GET. The returned Secret is shared and must not be
+// modified.
+func (s *secretCache) get(client kubernetes.Interface, namespace, name string) (sec *corev1.Secret, ok bool, err error) {
+	if s == nil || client != s.client {
+		return nil, false, nil
+	}
+	lister, ok := s.listers[namespace]
+	if !ok {
+		return nil, false, nil
+	}
+	sec, err = lister.Get(name)
+	return sec, true, err
+}
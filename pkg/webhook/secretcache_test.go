@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	if got, want := parseNamespaces(" cert-manager,,team-a "), []string{"cert-manager", "team-a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := parseNamespaces(""); got != nil {
+		t.Errorf("expected no namespaces, got %q", got)
+	}
+}
+
+func TestSecretCache(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "dode"},
+		Data:       map[string][]byte{"token": []byte("abc")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	secrets, err := newSecretCache(client, []string{"cert-manager"}, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newDodeDNSProviderSolver(client, nil)
+	c.secrets = secrets
+	client.ClearActions()
+
+	sec, err := c.getSecret(client, "cert-manager", "dode", false)
+	if err != nil || string(sec.Data["token"]) != "abc" {
+		t.Fatalf("expected the cached secret, got %v, %v", sec, err)
+	}
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "get" {
+			t.Errorf("expected the secret to be served from cache, got %v", a)
+		}
+	}
+
+	if _, ok, _ := secrets.get(client, "default", "dode"); ok {
+		t.Errorf("expected no answer for namespaces that aren't cached")
+	}
+	if _, ok, _ := secrets.get(fake.NewSimpleClientset(), "cert-manager", "dode"); ok {
+		t.Errorf("expected no answer for other clients")
+	}
+	if _, ok, err := secrets.get(client, "cert-manager", "missing"); !ok || err == nil {
+		t.Errorf("expected missing secrets to be reported, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// secretNotFoundBackoff is how long getSecret keeps retrying a Secret that
+// doesn't exist yet: 1+2+4+8 seconds. This covers GitOps setups where the
+// Issuer is applied slightly before its Secret, while still failing well
+// within cert-manager's own retry period.
+var secretNotFoundBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Steps:    5,
+}
+
+// secretKeySelector refers to a key of the Secret holding the API token.
+type secretKeySelector struct {
+	cmmeta.SecretKeySelector `json:",inline"`
+	// Namespace of the Secret, if not that of the challenge. It must be
+	// listed in --dode.allowed-secret-namespaces.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// secretNamespace returns the namespace the Secret ref refers to is read from
+// for a challenge in namespace.
+func (c *dodeDNSProviderSolver) secretNamespace(ref *secretKeySelector, namespace string) (string, error) {
+	if ref.Namespace == "" || ref.Namespace == namespace {
+		return namespace, nil
+	}
+	if !c.secretNamespaces[ref.Namespace] {
+		return "", classify(errorClassConfig, fmt.Errorf("namespace %q of secret `%s` is not listed in --dode.allowed-secret-namespaces", ref.Namespace, ref.Name))
+	}
+	return ref.Namespace, nil
+}
+
+// missingKeyError reports a Secret that holds none of the keys a credential
+// is looked up under.
+type missingKeyError struct {
+	msg string
+}
+
+func (e *missingKeyError) Error() string {
+	return e.msg
+}
+
+func missingKey(format string, args ...interface{}) error {
+	return &missingKeyError{msg: fmt.Sprintf(format, args...)}
+}
+
+// defaultAPITokenSecretKeys are tried in order when a solver config names
+// neither apiTokenSecretRef.key nor apiTokenSecretKeys. api-token is the
+// default key, and the one new tokens are stored under; the others cover the
+// names used by other webhooks.
+var defaultAPITokenSecretKeys = []string{"api-token", "token", "apiKey", "DODE_TOKEN"}
+
+// apiTokenSecretKeys returns the keys of the API token Secret to try, in
+// order.
+func apiTokenSecretKeys(cfg *dodeDNSProviderConfig) []string {
+	if cfg.APITokenSecretRef.Key != "" {
+		return []string{cfg.APITokenSecretRef.Key}
+	}
+	if len(cfg.APITokenSecretKeys) > 0 {
+		return cfg.APITokenSecretKeys
+	}
+	return defaultAPITokenSecretKeys
+}
+
+// lookupSecretKey returns the value of the first of keys present in sec.
+func lookupSecretKey(sec *corev1.Secret, keys []string) ([]byte, string, bool) {
+	for _, key := range keys {
+		if v, ok := sec.Data[key]; ok {
+			return v, key, true
+		}
+	}
+	return nil, "", false
+}
+
+// tokenFromSecret returns the API token stored in sec under the first of
+// keys. Secrets created for other do.de integrations are understood as well:
+// an env file in the style of lego (DODE_TOKEN=...), either under one of keys
+// or, if none of them is present, under any key. legacy reports whether the
+// token was found in such a file.
+func tokenFromSecret(sec *corev1.Secret, keys []string) (token, key string, legacy, ok bool) {
+	if v, key, ok := lookupSecretKey(sec, keys); ok {
+		if token, ok := parseEnvFileToken(v); ok {
+			return token, key, true, true
+		}
+		return strings.TrimSpace(string(v)), key, false, true
+	}
+	var all []string
+	for key := range sec.Data {
+		all = append(all, key)
+	}
+	sort.Strings(all)
+	for _, key := range all {
+		if token, ok := parseEnvFileToken(sec.Data[key]); ok {
+			return token, key, true, true
+		}
+	}
+	return "", "", false, false
+}
+
+// parseEnvFileToken returns the value of DODE_TOKEN if data is an env file
+// setting it.
+func parseEnvFileToken(data []byte) (string, bool) {
+	prefix := legoEnvToken + "="
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		line = strings.TrimPrefix(line, "export ")
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		v := strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		return v, v != ""
+	}
+	return "", false
+}
+
+// legacySecretWarnings remembers the secrets a migration hint was logged for,
+// so that it is logged once per secret rather than for every challenge.
+var legacySecretWarnings sync.Map
+
+func warnLegacySecret(namespace, name, key string) {
+	if _, warned := legacySecretWarnings.LoadOrStore(namespace+"/"+name, true); warned {
+		return
+	}
+	klog.Warningf("secret %s/%s holds the API token as an env file under key %q; it keeps working, "+
+		"but consider storing the token alone, e.g. under the key %q, and referencing that key in apiTokenSecretRef",
+		namespace, name, key, defaultAPITokenSecretKeys[0])
+}
+
+// assumedKeyLogs remembers the secrets the key assumed for a missing
+// apiTokenSecretRef.key was logged for, so that it is logged once per secret
+// and key rather than for every challenge.
+var assumedKeyLogs sync.Map
+
+func logAssumedKey(namespace, name, key string) {
+	if _, logged := assumedKeyLogs.LoadOrStore(namespace+"/"+name+"/"+key, true); logged {
+		return
+	}
+	klog.Infof("apiTokenSecretRef.key of secret %s/%s is not set, assuming key %q", namespace, name, key)
+}
+
+// getSecret fetches the Secret namespace/name using client, or from the
+// secret cache if it holds namespace and live is false. If it doesn't exist,
+// an Event telling the user we are waiting for it is emitted and the lookup
+// is retried with exponential backoff before giving up.
+func (c *dodeDNSProviderSolver) getSecret(client kubernetes.Interface, namespace, name string, live bool) (*corev1.Secret, error) {
+	var (
+		sec     *corev1.Secret
+		lastErr error
+		waiting bool
+	)
+	err := wait.ExponentialBackoff(secretNotFoundBackoff, func() (bool, error) {
+		var cached bool
+		if !live {
+			sec, cached, lastErr = c.secrets.get(client, namespace, name)
+		}
+		if !cached {
+			sec, lastErr = client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+		if lastErr == nil {
+			return true, nil
+		}
+		if !apierrors.IsNotFound(lastErr) {
+			return false, lastErr
+		}
+		if !waiting {
+			waiting = true
+			klog.Infof("secret %s/%s not found, waiting for it to be created", namespace, name)
+			if c.recorder != nil {
+				c.recorder.Eventf(secretReference(namespace, name), corev1.EventTypeWarning, reasonWaitingForSecret,
+					"waiting for secret %s to be created", name)
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("gave up waiting for secret to be created: %w", lastErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+// getBasicAuth returns the credentials of the username and password in the
+// Secrets cfg refers to, for accounts without an API token.
+func (c *dodeDNSProviderSolver) getBasicAuth(cfg *dodeDNSProviderConfig, namespace string) (string, error) {
+	username, err := c.secretValue(&cfg.UsernameSecretRef, "username", namespace, cfg.fresh)
+	if err != nil {
+		return "", err
+	}
+	password, err := c.secretValue(&cfg.PasswordSecretRef, "password", namespace, cfg.fresh)
+	if err != nil {
+		return "", err
+	}
+	return dode.BasicAuth(username, password), nil
+}
+
+// secretValue returns the value at the key of ref, or else at defaultKey, in
+// its Secret, read from the API server rather than the cache if live is set.
+func (c *dodeDNSProviderSolver) secretValue(ref *secretKeySelector, defaultKey, namespace string, live bool) (string, error) {
+	mgmt, err := c.kube.get()
+	if err != nil {
+		return "", err
+	}
+	if mgmt == nil {
+		return "", fmt.Errorf("no Kubernetes client configured to load secret `%s`", ref.Name)
+	}
+	if namespace, err = c.secretNamespace(ref, namespace); err != nil {
+		return "", err
+	}
+	key := ref.Key
+	if key == "" {
+		key = defaultKey
+	}
+	sec, err := c.getSecret(mgmt, namespace, ref.Name, live)
+	c.kube.observe(mgmt, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to get secret `%s`; %w", ref.Name, err)
+	}
+	v := strings.TrimSpace(string(sec.Data[key]))
+	if v == "" {
+		return "", missingKey("key %q not found in secret \"%s/%s\"", key, ref.Name, namespace)
+	}
+	return v, nil
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAPITokenSecretKeys(t *testing.T) {
+	cfg := &dodeDNSProviderConfig{}
+	if got := apiTokenSecretKeys(cfg); !reflect.DeepEqual(got, defaultAPITokenSecretKeys) {
+		t.Errorf("expected default keys, got %q", got)
+	}
+	cfg.APITokenSecretKeys = []string{"dode", "key"}
+	if got := apiTokenSecretKeys(cfg); !reflect.DeepEqual(got, []string{"dode", "key"}) {
+		t.Errorf("expected configured keys, got %q", got)
+	}
+	cfg.APITokenSecretRef.Key = "explicit"
+	if got := apiTokenSecretKeys(cfg); !reflect.DeepEqual(got, []string{"explicit"}) {
+		t.Errorf("expected apiTokenSecretRef.key to take precedence, got %q", got)
+	}
+}
+
+func TestLookupSecretKey(t *testing.T) {
+	sec := &corev1.Secret{Data: map[string][]byte{
+		"apiKey":     []byte("b"),
+		"DODE_TOKEN": []byte("c"),
+	}}
+	v, key, ok := lookupSecretKey(sec, defaultAPITokenSecretKeys)
+	if !ok || key != "apiKey" || string(v) != "b" {
+		t.Errorf("expected the first present key to be used, got %q=%q", key, v)
+	}
+	if _, _, ok := lookupSecretKey(sec, []string{"token"}); ok {
+		t.Errorf("expected missing key not to be found")
+	}
+}
+
+func TestLookupSecretKeyPrefersAPIToken(t *testing.T) {
+	sec := &corev1.Secret{Data: map[string][]byte{
+		"token":     []byte("old"),
+		"api-token": []byte("new"),
+	}}
+	v, key, ok := lookupSecretKey(sec, defaultAPITokenSecretKeys)
+	if !ok || key != "api-token" || string(v) != "new" {
+		t.Errorf("expected api-token to be the default key, got %q=%q", key, v)
+	}
+}
+
+func TestTokenFromSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       map[string]string
+		token, key string
+		legacy     bool
+	}{
+		{"plain", map[string]string{"token": "abc\n"}, "abc", "token", false},
+		{"env file under candidate key", map[string]string{"DODE_TOKEN": "# lego\nexport DODE_TOKEN='abc'\n"}, "abc", "DODE_TOKEN", true},
+		{"env file under other key", map[string]string{".env": "DODE_HTTP_TIMEOUT=30\nDODE_TOKEN=\"abc\"\n"}, "abc", ".env", true},
+	}
+	for _, test := range tests {
+		sec := &corev1.Secret{Data: map[string][]byte{}}
+		for k, v := range test.data {
+			sec.Data[k] = []byte(v)
+		}
+		token, key, legacy, ok := tokenFromSecret(sec, defaultAPITokenSecretKeys)
+		if !ok || token != test.token || key != test.key || legacy != test.legacy {
+			t.Errorf("%s: got token %q from key %q (legacy %v, ok %v)", test.name, token, key, legacy, ok)
+		}
+	}
+
+	sec := &corev1.Secret{Data: map[string][]byte{"other": []byte("DODE_HTTP_TIMEOUT=30")}}
+	if _, _, _, ok := tokenFromSecret(sec, defaultAPITokenSecretKeys); ok {
+		t.Errorf("expected no token in a secret without DODE_TOKEN")
+	}
+}
+
+func TestGetAPIKeyAmbient(t *testing.T) {
+	c := newDodeDNSProviderSolver(nil, nil)
+	c.env.token = "lego"
+	cfg := &dodeDNSProviderConfig{}
+
+	if _, err := c.getAPIKey(cfg, "default", false); err == nil {
+		t.Errorf("expected an error without ambient credentials")
+	}
+	if token, err := c.getAPIKey(cfg, "default", true); err != nil || token != "lego" {
+		t.Errorf("expected the lego token if cert-manager allows ambient credentials, got %q, %v", token, err)
+	}
+	c.ambientToken = "ambient"
+	if token, err := c.getAPIKey(cfg, "default", false); err != nil || token != "ambient" {
+		t.Errorf("expected the ambient token, got %q, %v", token, err)
+	}
+}
+
+func TestGetAPIKey(t *testing.T) {
+	defer func(b wait.Backoff) { secretNotFoundBackoff = b }(secretNotFoundBackoff)
+	secretNotFoundBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 1}
+
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dode"},
+			Data:       map[string][]byte{"apiKey": []byte("abc\n"), "other": []byte("def")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "lego"},
+			Data:       map[string][]byte{".env": []byte("DODE_TOKEN=ghi\n")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unrelated"},
+			Data:       map[string][]byte{"password": []byte("jkl")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "central", Name: "dode"},
+			Data:       map[string][]byte{"token": []byte("mno")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "dode"},
+			Data:       map[string][]byte{"token": []byte("pqr")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "login"},
+			Data:       map[string][]byte{"username": []byte("user\n"), "pass": []byte("pw")},
+		},
+	)
+	c := newDodeDNSProviderSolver(client, nil)
+	c.secretNamespaces = map[string]bool{"central": true}
+
+	tests := []struct {
+		name    string
+		cfg     string
+		ns      string
+		token   string
+		wantErr string
+	}{
+		{name: "default keys", cfg: `{"apiTokenSecretRef":{"name":"dode"}}`, ns: "default", token: "abc"},
+		{name: "explicit key", cfg: `{"apiTokenSecretRef":{"name":"dode","key":"other"}}`, ns: "default", token: "def"},
+		{name: "env file", cfg: `{"apiTokenSecretRef":{"name":"lego"}}`, ns: "default", token: "ghi"},
+		{name: "missing key", cfg: `{"apiTokenSecretRef":{"name":"dode","key":"token"}}`, ns: "default", wantErr: `key "token" not found`},
+		{name: "missing default keys", cfg: `{"apiTokenSecretRef":{"name":"unrelated"}}`, ns: "default", wantErr: "apiTokenSecretRef.key is not set"},
+		{name: "missing keys", cfg: `{"apiTokenSecretRef":{"name":"dode"},"apiTokenSecretKeys":["a","b"]}`, ns: "default", wantErr: `none of the keys`},
+		{name: "other namespace", cfg: `{"apiTokenSecretRef":{"name":"dode"}}`, ns: "kube-system", wantErr: "gave up waiting"},
+		{name: "allowed namespace", cfg: `{"apiTokenSecretRef":{"name":"dode","namespace":"central"}}`, ns: "default", token: "mno"},
+		{name: "own namespace", cfg: `{"apiTokenSecretRef":{"name":"dode","namespace":"default"}}`, ns: "default", token: "abc"},
+		{name: "namespace not allowed", cfg: `{"apiTokenSecretRef":{"name":"dode","namespace":"team-b"}}`, ns: "default", wantErr: "--dode.allowed-secret-namespaces"},
+		{name: "basic auth", cfg: `{"usernameSecretRef":{"name":"login"},"passwordSecretRef":{"name":"login","key":"pass"}}`, ns: "default", token: dode.BasicAuth("user", "pw")},
+		{name: "basic auth missing key", cfg: `{"usernameSecretRef":{"name":"login"},"passwordSecretRef":{"name":"login"}}`, ns: "default", wantErr: `key "password" not found`},
+		{name: "workload cluster without fleet mode", cfg: `{"apiTokenSecretRef":{"name":"dode"},"workloadCluster":{"name":"w"}}`, ns: "default", wantErr: "fleet-mode"},
+	}
+	for _, test := range tests {
+		cfg, err := decodeConfig(&extapi.JSON{Raw: []byte(test.cfg)}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		token, err := c.getAPIKey(&cfg, test.ns, false)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || token != test.token {
+			t.Errorf("%s: expected token %q, got %q, %v", test.name, test.token, token, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// sentryDSNSecretKey is the key of the Secret referenced by --dode.sentry-dsn-secret
+// holding the DSN.
+const sentryDSNSecretKey = "dsn"
+
+// sentryReporter reports panics to Sentry using its plain HTTP store API.
+type sentryReporter struct {
+	storeURL string
+	auth     string
+	client   *http.Client
+}
+
+// newSentryReporter returns a reporter for a DSN of the form
+// https://<public key>@<host>/<project id>.
+func newSentryReporter(dsn string) (*sentryReporter, error) {
+	u, err := url.Parse(strings.TrimSpace(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: %v", err)
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN: expected <scheme>://<key>@<host>/<project>")
+	}
+	return &sentryReporter{
+		storeURL: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", eventComponent, u.User.Username()),
+		client:   egressClient(10 * time.Second),
+	}, nil
+}
+
+// loadSentryReporter reads the DSN from the Secret namespace/name.
+func loadSentryReporter(client kubernetes.Interface, ref string) (*sentryReporter, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("--dode.sentry-dsn-secret must be of the form namespace/name, got %q", ref)
+	}
+	sec, err := client.CoreV1().Secrets(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get Sentry DSN secret `%s`; %v", ref, err)
+	}
+	dsn, ok := sec.Data[sentryDSNSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in secret `%s`", sentryDSNSecretKey, ref)
+	}
+	return newSentryReporter(string(dsn))
+}
+
+// reportPanic sends the panic to Sentry in the background.
+func (s *sentryReporter) reportPanic(action string, ch *v1alpha1.ChallengeRequest, recovered interface{}, stack []byte) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"level":     "fatal",
+		"platform":  "go",
+		"logger":    eventComponent,
+		"message":   fmt.Sprintf("panic in %s: %v", action, recovered),
+		"tags": map[string]string{
+			"action":    action,
+			"zone":      ch.ResolvedZone,
+			"namespace": ch.ResourceNamespace,
+		},
+		"extra": map[string]string{
+			"fqdn":  ch.ResolvedFQDN,
+			"stack": string(stack),
+		},
+	}
+	go func() {
+		if err := s.send(event); err != nil {
+			klog.Errorf("Failed to report panic to Sentry: %v", err)
+		}
+	}()
+}
+
+func (s *sentryReporter) send(event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
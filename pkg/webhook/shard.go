@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// zoneShardRegexPrefix marks a --dode.zone-shard value as a regular
+// expression rather than a list of suffixes.
+const zoneShardRegexPrefix = "regex:"
+
+// zoneShard selects the zones a webhook deployment is responsible for, so
+// that a large estate can be split across deployments with their own tokens
+// and rate limits.
+type zoneShard struct {
+	spec     string
+	suffixes []string
+	re       *regexp.Regexp
+}
+
+// parseZoneShard parses either "regex:<expression>", matched against zones
+// without their trailing dot, or a comma separated list of domains whose
+// zones, including the domains themselves, belong to the shard.
+func parseZoneShard(spec string) (*zoneShard, error) {
+	s := &zoneShard{spec: spec}
+	if strings.HasPrefix(spec, zoneShardRegexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(spec, zoneShardRegexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --dode.zone-shard expression: %v", err)
+		}
+		s.re = re
+		return s, nil
+	}
+	for _, suffix := range strings.Split(spec, ",") {
+		if suffix = normalizeName(strings.TrimSpace(suffix)); suffix != "" {
+			s.suffixes = append(s.suffixes, suffix)
+		}
+	}
+	if len(s.suffixes) == 0 {
+		return nil, fmt.Errorf("--dode.zone-shard lists no domains")
+	}
+	return s, nil
+}
+
+// check returns an error if zone is outside the shard. It does nothing if s
+// is nil.
+func (s *zoneShard) check(zone string) error {
+	if s == nil || s.contains(normalizeName(zone)) {
+		return nil
+	}
+	return fmt.Errorf("zone %q is outside the shard of this webhook (%s); point the issuer at the webhook deployment responsible for it", zone, s.spec)
+}
+
+func (s *zoneShard) contains(zone string) bool {
+	if s.re != nil {
+		return s.re.MatchString(zone)
+	}
+	for _, suffix := range s.suffixes {
+		if zone == suffix || strings.HasSuffix(zone, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
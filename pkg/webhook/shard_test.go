@@ -0,0 +1,44 @@
+package webhook
+
+import "testing"
+
+func TestZoneShard(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   []string
+		out  []string
+	}{
+		{
+			spec: "example.com, Example.ORG.",
+			in:   []string{"example.com.", "sub.example.com.", "example.org"},
+			out:  []string{"notexample.com.", "example.net."},
+		},
+		{
+			spec: `regex:^[a-m][^.]*\.com$`,
+			in:   []string{"alpha.com.", "mango.com."},
+			out:  []string{"zulu.com.", "sub.alpha.com."},
+		},
+	}
+	for _, test := range tests {
+		s, err := parseZoneShard(test.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", test.spec, err)
+		}
+		for _, zone := range test.in {
+			if err := s.check(zone); err != nil {
+				t.Errorf("%s: expected %s to be in the shard: %v", test.spec, zone, err)
+			}
+		}
+		for _, zone := range test.out {
+			if err := s.check(zone); err == nil {
+				t.Errorf("%s: expected %s to be outside the shard", test.spec, zone)
+			}
+		}
+	}
+
+	for _, spec := range []string{"regex:(", " , "} {
+		if _, err := parseZoneShard(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
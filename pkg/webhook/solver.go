@@ -0,0 +1,897 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+
+	acmewebhook "github.com/jetstack/cert-manager/pkg/acme/webhook"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+)
+
+// TTL of the TXT records in seconds, unless set in the solver config, and
+// the range it may be set to.
+const (
+	defaultTTL = 600
+	minTTL     = 60
+	maxTTL     = 86400
+)
+
+// ambientTokenEnv is the environment variable holding the token used for
+// issuers without apiTokenSecretRef with --dode.allow-ambient-credentials.
+const ambientTokenEnv = "DODE_API_TOKEN"
+
+// GroupName groupname
+var GroupName = os.Getenv("GROUP_NAME")
+
+// Main runs the webhook as a program of its own: the report and
+// rotate-token subcommands, or else the solver API of GroupName, configured
+// by the command line.
+func Main() {
+	defer dumpAuditLogOnPanic()
+
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		runReport(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rotate-token" {
+		runRotateToken(os.Args[2:])
+	}
+	if GroupName == "" {
+		panic("GROUP_NAME must be specified")
+	}
+
+	// This will register our dode DNS provider with the webhook serving
+	// library, making it available as an API under the provided GroupName.
+	// You can register multiple DNS provider implementations with a single
+	// webhook, where the Name() method will be used to disambiguate between
+	// the different implementations.
+	runWebhookServer(GroupName,
+		NewSolver(),
+	)
+}
+
+// NewSolver returns the do.de solver, configured by the webhook's flags when
+// it is initialized, for serving next to solvers of other providers with
+// NewRunnable or RegisterWithManager.
+func NewSolver() acmewebhook.Solver {
+	return &dodeDNSProviderSolver{}
+}
+
+// dodeDNSProviderSolver implements the provider-specific logic needed to
+// 'present' an ACME challenge TXT record for your own DNS provider.
+// To do so, it must implement the `github.com/jetstack/cert-manager/pkg/acme/webhook.Solver`
+// interface.
+type dodeDNSProviderSolver struct {
+	kube     *kubeClient
+	recorder record.EventRecorder
+	api      dodeAPI
+	// endpoints are the clients of solver configs setting their own
+	// endpoint or request timeout.
+	endpoints *apiEndpoints
+	backoff   *zoneBackoff
+	records   *recordCache
+	ledger    *recordLedger
+	pending   *delayedCleanups
+	ages      *challengeAges
+	watchdog  *recordWatchdog
+	fleet     *fleetClients
+	health    *healthChecker
+	creds     *credentialStats
+	failures  *configFailures
+	events    *cloudEventsSink
+	hooks     []hook
+	// approvals is only set if new zones require manual approval.
+	approvals *zoneApprovals
+	// quotas is only set if API calls are limited per namespace.
+	quotas *apiQuotas
+	// shard is only set if this deployment handles a subset of the zones.
+	shard *zoneShard
+	// tokens is only set if token providers are configured.
+	tokens *tokenProviders
+	// tokenFiles is only set if --dode.token-file-dir is.
+	tokenFiles *tokenFiles
+	// defaults are the solver config defaults, only set if
+	// --dode.defaults-configmap is.
+	defaults *configDefaults
+	// vault is only set if --dode.vault-addresses is.
+	vault *vaultTokens
+	// secrets is only set if --dode.secret-cache-namespaces is.
+	secrets *secretCache
+	// staleTokens are the tokens last read from Secrets, used while the
+	// API server is unavailable.
+	staleTokens *staleTokens
+	// apiKeys are the tokens recently read from Secrets.
+	apiKeys *apiKeyCache
+	// secretNamespaces are the namespaces apiTokenSecretRef.namespace may
+	// name besides the challenge's own, from
+	// --dode.allowed-secret-namespaces.
+	secretNamespaces map[string]bool
+	// nameservers caches the nameservers of zones for configs with
+	// propagation.nameservers.
+	nameservers *zoneNameservers
+
+	panicReporter panicReporter
+	env           legoEnv
+	// ambientToken is used for issuers without apiTokenSecretRef if
+	// --dode.allow-ambient-credentials is set.
+	ambientToken string
+	// initialized is set once Initialize succeeded. It is guarded by
+	// initMu.
+	initialized bool
+}
+
+// initMu serializes calls of Initialize.
+var initMu sync.Mutex
+
+// newDodeDNSProviderSolver returns a solver reading Secrets through client and
+// calling the DODE API through api, with the state it keeps across challenges
+// set up. Initialize builds it from the webhook's kubeconfig, tests pass a
+// fake clientset.
+func newDodeDNSProviderSolver(client kubernetes.Interface, api dodeAPI) *dodeDNSProviderSolver {
+	return &dodeDNSProviderSolver{
+		kube:      staticKubeClient(client),
+		api:       api,
+		endpoints: newAPIEndpoints(dode.DefaultAPIURL, plainAPIClient),
+		backoff:   newZoneBackoff(defaultZoneBackoffBase, defaultZoneBackoffMax),
+		records:   newRecordCache(defaultRecordCacheTTL),
+		ledger:    newRecordLedger(),
+		pending:   newDelayedCleanups(),
+		ages:      newChallengeAges(),
+		watchdog:  newRecordWatchdog(),
+		creds:     newCredentialStats(),
+		failures:  newConfigFailures(defaultConfigFailureTTL),
+
+		nameservers: newZoneNameservers(defaultNameserverCacheTTL),
+		staleTokens: newStaleTokens(defaultMaxTokenStaleness),
+		apiKeys:     newAPIKeyCache(defaultAPIKeyCacheTTL),
+	}
+}
+
+// dodeDNSProviderConfig is a structure that is used to decode into when
+// solving a DNS01 challenge.
+// This information is provided by cert-manager, and may be a reference to
+// additional configuration that's needed to solve the challenge for this
+// particular certificate or issuer.
+// This typically includes references to Secret resources containing DNS
+// provider credentials, in cases where a 'multi-tenant' DNS solver is being
+// created.
+// If you do *not* require per-issuer or per-certificate configuration to be
+// provided to your webhook, you can skip decoding altogether in favour of
+// using CLI flags or similar to provide configuration.
+// You should not include sensitive information here. If credentials need to
+// be used by your provider here, you should reference a Kubernetes Secret
+// resource and fetch these credentials using a Kubernetes clientset.
+type dodeDNSProviderConfig struct {
+	APITokenSecretRef secretKeySelector `json:"apiTokenSecretRef"`
+	// APITokenSecretKeys are the keys of the APITokenSecretRef Secret tried
+	// in order if APITokenSecretRef.Key is empty. Defaults to
+	// defaultAPITokenSecretKeys.
+	APITokenSecretKeys []string `json:"apiTokenSecretKeys,omitempty"`
+	// APITokenSecretRefs are used instead of APITokenSecretRef to list
+	// several tokens, e.g. the old and the new one while rotating. Calls the
+	// API rejects the token of are retried with the next token, in order.
+	APITokenSecretRefs []secretKeySelector `json:"apiTokenSecretRefs,omitempty"`
+	// ZoneTokens maps zones to the Secret holding the token of the do.de
+	// account they belong to. Challenges use the entry of the longest zone
+	// containing their ResolvedZone, or else APITokenSecretRef.
+	ZoneTokens map[string]secretKeySelector `json:"zoneTokens,omitempty"`
+	// TokenProvider names a provider set up with --dode.token-providers
+	// that mints short-lived tokens, used instead of APITokenSecretRef.
+	TokenProvider string `json:"tokenProvider,omitempty"`
+	// APITokenFile is a file below the challenge's namespace directory in
+	// --dode.token-file-dir holding the token, read for every challenge,
+	// used instead of APITokenSecretRef.
+	APITokenFile string `json:"apiTokenFile,omitempty"`
+	// APITokenVaultRef reads the token from HashiCorp Vault at challenge
+	// time, used instead of APITokenSecretRef.
+	APITokenVaultRef *vaultRef `json:"apiTokenVaultRef,omitempty"`
+	// UsernameSecretRef and PasswordSecretRef authenticate accounts
+	// without an API token with their username and password, used instead
+	// of APITokenSecretRef. Their keys default to username and password.
+	UsernameSecretRef secretKeySelector `json:"usernameSecretRef,omitempty"`
+	PasswordSecretRef secretKeySelector `json:"passwordSecretRef,omitempty"`
+	// Propagation optionally makes Present wait until the TXT record is
+	// visible to a set of resolvers.
+	Propagation *propagationConfig `json:"propagation,omitempty"`
+	// Zones restricts the config to challenges for these zones and names
+	// below them. Set it on each of several solvers of an Issuer, matching
+	// their selectors, so that challenges routed to the wrong one fail.
+	Zones []string `json:"zones,omitempty"`
+	// PropagationDelaySeconds makes Present wait this long after the record
+	// was presented, and visible if Propagation is set, before returning, for
+	// zones whose nameservers lag behind cert-manager's self check.
+	PropagationDelaySeconds int `json:"propagationDelaySeconds,omitempty"`
+	// DryRun logs the API requests of challenges using this config instead
+	// of sending them, to try a new issuer without changing any records.
+	// Present doesn't wait for propagation.
+	DryRun bool `json:"dryRun,omitempty"`
+	// ChallengeAliasDomain presents the TXT record at
+	// _acme-challenge.<ChallengeAliasDomain> instead of the challenge's
+	// name, for _acme-challenge records CNAMEd into a validation zone at
+	// do.de.
+	ChallengeAliasDomain string `json:"challengeAliasDomain,omitempty"`
+	// FailOnZoneMismatch rejects challenges whose ResolvedFQDN is not inside
+	// their ResolvedZone instead of only logging a warning.
+	FailOnZoneMismatch bool `json:"failOnZoneMismatch,omitempty"`
+	// WorkloadCluster makes the solver read APITokenSecretRef from a Cluster
+	// API workload cluster. Only honoured when running with --fleet-mode.
+	WorkloadCluster *workloadClusterRef `json:"workloadCluster,omitempty"`
+	// CleanupDelaySeconds makes CleanUp return right away and delete the
+	// record only after this delay, for ACME servers that re-check records
+	// shortly after the authorization.
+	CleanupDelaySeconds int `json:"cleanupDelaySeconds,omitempty"`
+	// MaxRecordsPerName caps the number of TXT values the webhook keeps at a
+	// single name. When exceeded, the oldest values it created are pruned.
+	MaxRecordsPerName int `json:"maxRecordsPerName,omitempty"`
+	// MaxChallengeAgeSeconds makes Present give up on challenges first
+	// presented longer ago than this, cleaning up their record, so that
+	// challenges retried forever don't use up the API quota. Zero disables
+	// the limit.
+	MaxChallengeAgeSeconds int `json:"maxChallengeAgeSeconds,omitempty"`
+	// WatchdogIntervalSeconds makes the webhook check this often whether
+	// the record of a challenge is still served by the zone's nameservers
+	// until it is cleaned up, and present it again if it was deleted, e.g.
+	// by a zone sync tool. Zero disables the watchdog.
+	WatchdogIntervalSeconds int `json:"watchdogIntervalSeconds,omitempty"`
+	// ValueTransforms are text/template templates presenting a value
+	// derived from the challenge key, e.g. prefixed or truncated, for
+	// delegated zones expecting one. Each is executed on the output of the
+	// previous one; see valueTransformData for what they can refer to.
+	ValueTransforms []string `json:"valueTransforms,omitempty"`
+	// DomainStrategy selects what is sent as the domain parameter to the
+	// API: "fqdn" (the default), "registrable" or "zone".
+	DomainStrategy string `json:"domainStrategy,omitempty"`
+	// APIURL overrides the API endpoint of the webhook, e.g. with a proxy.
+	// It must be an https URL.
+	APIURL string `json:"apiUrl,omitempty"`
+	// RequestTimeoutSeconds bounds every API request of challenges using
+	// this config instead of the webhook's default of 30 seconds.
+	RequestTimeoutSeconds int `json:"requestTimeoutSeconds,omitempty"`
+	// ProxyURL sends the API requests of challenges using this config
+	// through an http or https proxy instead of that of HTTPS_PROXY.
+	ProxyURL string `json:"proxyUrl,omitempty"`
+	// MaxRetries is how often API calls failing transiently, e.g. with a
+	// timeout or a 5xx status, are retried before Present or CleanUp fail.
+	// Zero, the default, leaves retrying to cert-manager.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// InitialBackoffSeconds is the delay before the first retry, doubled
+	// for every further one. Defaults to defaultInitialBackoff.
+	InitialBackoffSeconds int `json:"initialBackoffSeconds,omitempty"`
+	// MaxBackoffSeconds caps the delay between retries. Defaults to
+	// defaultMaxBackoff.
+	MaxBackoffSeconds int `json:"maxBackoffSeconds,omitempty"`
+	// TTL is the TTL of the TXT records in seconds, between minTTL and
+	// maxTTL. Defaults to defaultTTL.
+	TTL int `json:"ttl,omitempty"`
+
+	// fresh makes getAPIKey read Secrets from the API server even if they
+	// are cached, to pick up a token the DODE API rejected being replaced.
+	fresh bool
+}
+
+// Name is used as the name for this DNS solver when referencing it on the ACME
+// Issuer resource.
+// This should be unique **within the group name**, i.e. you can have two
+// solvers configured with the same Name() **so long as they do not co-exist
+// within a single webhook deployment**.
+func (c *dodeDNSProviderSolver) Name() string {
+	return solverName
+}
+
+// solverName is the name of the solver returned by Name.
+const solverName = "dode"
+
+// Present is responsible for actually presenting the DNS record with the
+// DNS provider.
+// This method should tolerate being called multiple times with the same value.
+// cert-manager itself will later perform a self check to ensure that the
+// solver has correctly configured the DNS provider.
+func (c *dodeDNSProviderSolver) Present(ch *v1alpha1.ChallengeRequest) (err error) {
+	defer challengesInFlight.start("Present")()
+	res := newChallengeResult("Present", ch)
+	ctx := withChallengeResult(context.Background(), res)
+	defer c.events.publish(res)
+	defer res.finish(&err)
+	defer auditLog.trace("Present", ch, time.Now(), &err)
+	defer c.recoverPanic("Present", ch, &err)
+	failureKey := configFailureKey(ch)
+	if err := c.failures.check(failureKey); err != nil {
+		return err
+	}
+	defer func() { c.failures.observe(failureKey, err) }()
+
+	cfg, err := loadConfig(ch.Config, c.defaults.get())
+	if err != nil {
+		klog.Errorf("Failed to load config %s: %v", summarizeConfig(ch.Config), err)
+		return classify(errorClassConfig, err)
+	}
+	defer c.reportSlowAPI(res)
+	if err := c.checkZone(&cfg, ch); err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if err := checkConfigZones(cfg.Zones, ch.DNSName); err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if err := c.shard.check(ch.ResolvedZone); err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if c.approvals != nil {
+		if err := c.approvals.check(ctx, ch.ResolvedZone); err != nil {
+			return classify(errorClassApproval, err)
+		}
+	}
+	if err := c.quotas.check(ctx, ch.ResourceNamespace); err != nil {
+		return classify(errorClassQuota, err)
+	}
+	fqdn, zone := challengeRecord(&cfg, ch)
+	cfg = *zoneTokenConfig(&cfg, zone)
+	apiKeys, refs, err := c.getAPIKeyRefs(&cfg, ch.ResourceNamespace, ch.AllowAmbientCredentials)
+	if err != nil {
+		klog.Errorf("Failed to get API key %s: %v", summarizeConfig(ch.Config), err)
+		return classify(errorClassCredentials, err)
+	}
+	res.tokenRefs = refs
+	apiKey := apiKeys[0]
+	var checkers []PropagationChecker
+	if cfg.Propagation != nil && !cfg.DryRun {
+		if checkers, err = cfg.Propagation.checkers(); err != nil {
+			return classify(errorClassConfig, err)
+		}
+		if cfg.Propagation.CacheBusting {
+			checkers = c.nameservers.bypassNegativeCaches(checkers, zone)
+		}
+		if cfg.Propagation.Nameservers {
+			nameservers, err := c.nameservers.checkers(ctx, zone)
+			if err != nil && len(checkers) == 0 {
+				return classify(errorClassPropagation, err)
+			}
+			if err != nil {
+				klog.Warningf("checking propagation without the zone's nameservers: %v", err)
+			}
+			checkers = append(checkers, nameservers...)
+		}
+	}
+	domain, err := apiDomain(cfg.DomainStrategy, fqdn, zone)
+	if err != nil {
+		return classify(errorClassConfig, err)
+	}
+	value, err := transformValue(cfg.ValueTransforms, ch.Key, fqdn, zone)
+	if err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if err := c.ages.check(ch.ResolvedFQDN, ch.Key, seconds(cfg.MaxChallengeAgeSeconds)); err != nil {
+		klog.Warning(err)
+		c.expireRecord(ctx, c.withTokenRefresh(withFallbackTokens(c.apiFor(&cfg), apiKeys[1:]), &cfg, ch.ResourceNamespace), apiKey, zone, domain, value, cfg.TTL)
+		return classify(errorClassExpired, err)
+	}
+	if c.pending.cancel(domain, value) {
+		klog.V(4).Infof("cancelled delayed cleanup of TXT record for %s as it is presented again", domain)
+	}
+	api := c.withTokenRefresh(withFallbackTokens(c.apiFor(&cfg), apiKeys[1:]), &cfg, ch.ResourceNamespace)
+	err = c.presentValue(ctx, &cfg, ch, api, apiKey, zone, domain, value)
+	c.creds.observe(credentialName(&cfg, ch.ResourceNamespace), zone, err)
+	if err != nil {
+		return err
+	}
+	c.watchRecord(&cfg, ch, api, apiKey, zone, fqdn, domain, value)
+
+	if len(checkers) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Propagation.timeout())
+		defer cancel()
+		start := time.Now()
+		err = waitForPropagation(ctx, checkers, fqdn, value,
+			cfg.Propagation.quorum(len(checkers)), cfg.Propagation.poll())
+		outcome := "visible"
+		if err != nil {
+			outcome = "timeout"
+		}
+		propagationDuration.WithLabelValues(normalizeName(zone), outcome).Observe(time.Since(start).Seconds())
+		if err != nil {
+			return classify(errorClassPropagation, err)
+		}
+	}
+
+	if cfg.DryRun {
+		return nil
+	}
+	return settle(ctx, seconds(cfg.PropagationDelaySeconds))
+}
+
+// CleanUp should delete the relevant TXT record from the DNS provider console.
+// If multiple TXT records exist with the same record name (e.g.
+// _acme-challenge.example.com) then **only** the record with the same `key`
+// value provided on the ChallengeRequest should be cleaned up.
+// This is in order to facilitate multiple DNS validations for the same domain
+// concurrently.
+func (c *dodeDNSProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) (err error) {
+	defer challengesInFlight.start("CleanUp")()
+	res := newChallengeResult("CleanUp", ch)
+	ctx := withChallengeResult(context.Background(), res)
+	defer c.events.publish(res)
+	defer res.finish(&err)
+	defer auditLog.trace("CleanUp", ch, time.Now(), &err)
+	defer c.recoverPanic("CleanUp", ch, &err)
+
+	c.ages.forget(ch.ResolvedFQDN, ch.Key)
+	c.watchdog.stop(ch.ResolvedFQDN, ch.Key)
+	failureKey := configFailureKey(ch)
+	if err := c.failures.check(failureKey); err != nil {
+		return err
+	}
+	defer func() { c.failures.observe(failureKey, err) }()
+	cfg, err := loadConfig(ch.Config, c.defaults.get())
+	if err != nil {
+		klog.Errorf("Failed to load config %s: %v", summarizeConfig(ch.Config), err)
+		return classify(errorClassConfig, err)
+	}
+	defer c.reportSlowAPI(res)
+	if err := c.checkZone(&cfg, ch); err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if err := c.shard.check(ch.ResolvedZone); err != nil {
+		// Nothing was presented outside the shard, and failing would keep
+		// the challenge from being deleted.
+		klog.Warningf("skipping cleanup of %s: %v", ch.ResolvedFQDN, err)
+		return nil
+	}
+	if c.approvals != nil {
+		// Nothing was presented for a zone that is not approved, and
+		// failing would keep the challenge from being deleted.
+		ok, err := c.approvals.isApproved(ctx, ch.ResolvedZone)
+		if err != nil {
+			return classify(errorClassApproval, err)
+		}
+		if !ok {
+			klog.V(4).Infof("skipping cleanup of %s in zone %q, which is not approved", ch.ResolvedFQDN, ch.ResolvedZone)
+			return nil
+		}
+	}
+	fqdn, zone := challengeRecord(&cfg, ch)
+	cfg = *zoneTokenConfig(&cfg, zone)
+	apiKeys, refs, err := c.getAPIKeyRefs(&cfg, ch.ResourceNamespace, ch.AllowAmbientCredentials)
+	if err != nil {
+		klog.Errorf("Failed to get API key %s: %v", summarizeConfig(ch.Config), err)
+		return classify(errorClassCredentials, err)
+	}
+	res.tokenRefs = refs
+	apiKey := apiKeys[0]
+	domain, err := apiDomain(cfg.DomainStrategy, fqdn, zone)
+	if err != nil {
+		return classify(errorClassConfig, err)
+	}
+	value, err := transformValue(cfg.ValueTransforms, ch.Key, fqdn, zone)
+	if err != nil {
+		return classify(errorClassConfig, err)
+	}
+	if cfg.CleanupDelaySeconds > 0 {
+		delay := seconds(cfg.CleanupDelaySeconds)
+		api, cred := c.withTokenRefresh(withFallbackTokens(c.apiFor(&cfg), apiKeys[1:]), &cfg, ch.ResourceNamespace), credentialName(&cfg, ch.ResourceNamespace)
+		klog.V(4).Infof("deleting TXT record for %s in %s", domain, delay)
+		c.pending.schedule(domain, value, delay, func() {
+			err := c.cleanUpValue(context.Background(), &cfg, ch, api, apiKey, zone, domain, value)
+			c.creds.observe(cred, zone, err)
+			if err != nil {
+				klog.Errorf("Delayed cleanup of TXT record for %s failed: %v", domain, err)
+			}
+		})
+		return nil
+	}
+	err = c.cleanUpValue(ctx, &cfg, ch, c.withTokenRefresh(withFallbackTokens(c.apiFor(&cfg), apiKeys[1:]), &cfg, ch.ResourceNamespace), apiKey, zone, domain, value)
+	c.creds.observe(credentialName(&cfg, ch.ResourceNamespace), zone, err)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Initialize will be called when the webhook first starts.
+// This method can be used to instantiate the webhook, i.e. initialising
+// connections or warming up caches.
+// Typically, the kubeClientConfig parameter is used to build a Kubernetes
+// client that can be used to fetch resources from the Kubernetes API, e.g.
+// Secret resources containing credentials used to authenticate with DNS
+// provider accounts.
+// The stopCh can be used to handle early termination of the webhook, in cases
+// where a SIGTERM or similar signal is sent to the webhook process.
+//
+// Only the first successful call sets the solver up, later calls are
+// ignored, so that calling Initialize again neither replaces the state of
+// challenges in progress nor starts the background tasks twice.
+func (c *dodeDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	if c.initialized {
+		klog.Warning("Initialize called more than once, keeping the existing setup")
+		return nil
+	}
+	if err := c.initialize(kubeClientConfig, stopCh); err != nil {
+		return err
+	}
+	c.initialized = true
+	return nil
+}
+
+func (c *dodeDNSProviderSolver) initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	dir := probeWritableDir(*writableDir)
+	auditLog = newAuditBuffer(*auditBufferSize)
+	auditLog.dir = dir
+
+	klog.Infof("using Kubernetes API server %s", kubeClientConfig.Host)
+	cl, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		klog.Errorf("Failed to new kubernetes client: %v", err)
+		return err
+	}
+	env, err := loadLegoEnv(os.Getenv)
+	if err != nil {
+		return err
+	}
+	var opts []dode.Option
+	if env.httpTimeout > 0 {
+		opts = append(opts, dode.WithTimeout(env.httpTimeout))
+	}
+	var response *dode.ResponseFields
+	if *responseSuccessPath != "" || *responseSuccessValue != "" || *responseErrorPath != "" {
+		response = &dode.ResponseFields{
+			SuccessPath:  *responseSuccessPath,
+			SuccessValue: *responseSuccessValue,
+			ErrorPath:    *responseErrorPath,
+		}
+	}
+	schema := newSchemaTracker(dir)
+	pins, err := parseSPKIPins(*apiSPKIPins)
+	if err != nil {
+		return fmt.Errorf("--dode.api-spki-pins: %v", err)
+	}
+	var roots *x509.CertPool
+	if *caBundleFile != "" {
+		if roots, err = loadCABundle(*caBundleFile); err != nil {
+			return fmt.Errorf("--dode.ca-bundle-file: %v", err)
+		}
+		klog.Infof("trusting the CAs in %s for the DODE API", *caBundleFile)
+	}
+	var custom, pinned http.RoundTripper
+	if roots != nil {
+		custom = tlsTransport(&tls.Config{RootCAs: roots}, nil)
+	}
+	if len(pins) > 0 {
+		pinned = tlsTransport(&tls.Config{RootCAs: roots, VerifyPeerCertificate: pins.verify}, nil)
+		klog.Infof("accepting %d SPKI pins for the DODE API at %s", len(pins), *apiURL)
+	}
+	newAPIClient := func(key endpointKey) *dode.Client {
+		clientOpts := append([]dode.Option{dode.WithBaseURL(key.baseURL)}, opts...)
+		pin := len(pins) > 0 && sameHost(key.baseURL, *apiURL)
+		base := custom
+		if pin {
+			base = pinned
+		}
+		if proxy, err := url.Parse(key.proxyURL); err == nil && key.proxyURL != "" {
+			tlsConfig := &tls.Config{RootCAs: roots}
+			if pin {
+				tlsConfig.VerifyPeerCertificate = pins.verify
+			}
+			base = tlsTransport(tlsConfig, fixedProxy(proxy))
+		}
+		var transport http.RoundTripper = &apiMetricsTransport{base: base}
+		if *traceContext {
+			transport = &traceTransport{base: transport}
+		}
+		clientOpts = append(clientOpts, dode.WithTransport(transport))
+		if key.timeout > 0 {
+			clientOpts = append(clientOpts, dode.WithTimeout(key.timeout))
+		}
+		api := dode.NewClient(clientOpts...)
+		api.Response = response
+		api.OnResponse = schema.observe
+		return api
+	}
+	if err := validateAPIURL(*apiURL); err != nil {
+		return fmt.Errorf("--dode.api-url %v", err)
+	}
+	api := newAPIClient(endpointKey{baseURL: *apiURL})
+	*c = *newDodeDNSProviderSolver(cl, api)
+	c.endpoints = newAPIEndpoints(*apiURL, func(key endpointKey) dodeAPI {
+		return newAPIClient(key)
+	})
+	c.kube = newKubeClient(kubeClientConfig, cl)
+	c.env = env
+	if *allowAmbientCredentials {
+		if c.ambientToken = os.Getenv(ambientTokenEnv); c.ambientToken == "" {
+			return fmt.Errorf("--dode.allow-ambient-credentials requires the token in %s", ambientTokenEnv)
+		}
+	}
+	c.recorder = newEventRecorder(cl)
+	c.staleTokens = newStaleTokens(*maxTokenStaleness)
+	c.apiKeys = newAPIKeyCache(*apiKeyCacheTTL)
+	if *sentryDSNSecret != "" {
+		reporter, err := loadSentryReporter(cl, *sentryDSNSecret)
+		if err != nil {
+			return err
+		}
+		c.panicReporter = reporter
+	}
+	if *tokenProvidersFlag != "" {
+		if c.tokens, err = parseTokenProviders(*tokenProvidersFlag); err != nil {
+			return err
+		}
+	}
+	if *vaultAddresses != "" {
+		addresses, err := parseVaultAddresses(*vaultAddresses)
+		if err != nil {
+			return err
+		}
+		c.vault = newVaultTokens(addresses)
+		if err := c.vault.scope(*vaultPathTemplates, *vaultRoleTemplate); err != nil {
+			return err
+		}
+	}
+	// The egress policy is read by clients without synchronization, so it is
+	// set before any goroutine is started.
+	if *strictEgress {
+		hosts := []string{api.BaseURL, *mirrorAPIURL, *hookURL, *cloudEventsSinkURL}
+		hosts = append(hosts, c.tokens.urls()...)
+		hosts = append(hosts, c.vault.urls()...)
+		for _, endpoint := range dohProviders {
+			hosts = append(hosts, endpoint)
+		}
+		if r, ok := c.panicReporter.(*sentryReporter); ok {
+			hosts = append(hosts, r.storeURL)
+		}
+		hosts = append(hosts, strings.Split(*egressAllowedHosts, ",")...)
+		enableStrictEgress(hosts...)
+	}
+	c.secretNamespaces = make(map[string]bool)
+	for _, ns := range parseNamespaces(*allowedSecretNamespaces) {
+		c.secretNamespaces[ns] = true
+	}
+	if namespaces := parseNamespaces(*secretCacheNamespaces); len(namespaces) > 0 {
+		if c.secrets, err = newSecretCache(cl, namespaces, stopCh); err != nil {
+			return err
+		}
+	}
+	go checkCertManagerVersion(cl.Discovery())
+	go checkClockSkew(api.HTTPClient, api.BaseURL)
+	if *mirrorAPIURL != "" {
+		if c.api, err = newMirroredAPI(api, *mirrorAPIURL, *mirrorPercent); err != nil {
+			return err
+		}
+	}
+	if c.env.propagationTimeout > 0 {
+		defaultPropagationTimeout = c.env.propagationTimeout
+	}
+	if c.env.pollingInterval > 0 {
+		defaultPropagationPollInterval = c.env.pollingInterval
+	}
+	if *zoneShardFlag != "" {
+		if c.shard, err = parseZoneShard(*zoneShardFlag); err != nil {
+			return err
+		}
+	}
+	if *defaultsConfigMap != "" {
+		defaults, err := newConfigDefaults(cl, *defaultsConfigMap)
+		if err != nil {
+			return err
+		}
+		if err := defaults.load(context.Background()); err != nil {
+			return err
+		}
+		c.defaults = defaults
+		go defaults.run(stopCh)
+	}
+	if *tokenFileDir != "" {
+		c.tokenFiles = newTokenFiles(*tokenFileDir)
+		go wait.Until(c.tokenFiles.poll, tokenFilePollInterval, stopCh)
+	}
+	if *apiQuotasFlag != "" {
+		if c.quotas, err = parseAPIQuotas(*apiQuotasFlag); err != nil {
+			return err
+		}
+		if err := c.quotas.useConfigMap(cl, *apiQuotaConfigMap); err != nil {
+			return err
+		}
+	}
+	if *hookURL != "" {
+		h, err := newHTTPHooks(*hookURL, *hookPhasesFlag)
+		if err != nil {
+			return err
+		}
+		c.hooks = append(c.hooks, h)
+	}
+	if *hookJobTemplate != "" {
+		h, err := newJobHooks(cl, *hookJobTemplate, *hookJobNamespace, *hookPhasesFlag)
+		if err != nil {
+			return err
+		}
+		c.hooks = append(c.hooks, h)
+	}
+	if *cloudEventsSinkURL != "" {
+		if c.events, err = newCloudEventsSink(*cloudEventsSinkURL); err != nil {
+			return err
+		}
+	}
+	go wait.Until(c.creds.logSummary, credentialSummaryInterval, stopCh)
+	if *prewarmCertificates {
+		dc, err := dynamic.NewForConfig(kubeClientConfig)
+		if err != nil {
+			return err
+		}
+		go newCertificatePrewarmer(c, dc, *clusterResourceNamespace).run(stopCh)
+	}
+	if *fleetMode {
+		c.fleet = newFleetClients()
+	}
+
+	if *zoneBackoffConfigMap != "" {
+		store, err := newBackoffStore(cl, *zoneBackoffConfigMap, c.backoff)
+		if err != nil {
+			return err
+		}
+		if err := store.load(context.Background()); err != nil {
+			klog.Warning(err)
+		}
+		go store.run(stopCh)
+	}
+
+	c.health = newHealthChecker()
+	c.health.register("zones", c.backoff.healthCheck)
+	if *zoneApprovalConfigMap != "" {
+		if c.approvals, err = newZoneApprovals(cl, *zoneApprovalConfigMap); err != nil {
+			return err
+		}
+		c.health.register("zone-approval", c.approvals.healthCheck)
+	}
+	if *startupTokenCheckWipeDomain != "" {
+		check := &startupTokenCheck{domain: *startupTokenCheckWipeDomain}
+		c.health.register("tokens", check.healthCheck)
+		go check.run(c.api, c.ledger, c.configuredTokens())
+	}
+	go wait.Until(func() { c.health.report() }, healthReportInterval, stopCh)
+	if *adminBindAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/readyz", c.health)
+		mux.HandleFunc("/debug/config", c.serveRuntimeConfig)
+		mux.HandleFunc("/debug/records", c.ledger.serveRecords)
+		mux.HandleFunc("/debug/solvers", serveSolverReport)
+		if c.approvals != nil {
+			mux.HandleFunc("/zones", c.approvals.serveZones)
+			mux.HandleFunc("/zones/approve", c.approvals.serveApprove)
+		}
+		go serveAdmin(*adminBindAddress, mux, stopCh)
+	}
+	currentSolverReport().log()
+
+	return nil
+}
+
+// checkZone warns about, or with FailOnZoneMismatch rejects, challenges whose
+// FQDN lies outside their resolved zone.
+func (c *dodeDNSProviderSolver) checkZone(cfg *dodeDNSProviderConfig, ch *v1alpha1.ChallengeRequest) error {
+	err := checkFQDNInZone(ch.ResolvedFQDN, ch.ResolvedZone)
+	if err == nil {
+		return nil
+	}
+	if cfg.FailOnZoneMismatch {
+		return err
+	}
+	klog.Warningf("%v", err)
+	return nil
+}
+
+// Get DODE API key from Kubernetes secret, or from the environment for
+// issuers without secret reference that may use ambient credentials.
+func (c *dodeDNSProviderSolver) getAPIKey(cfg *dodeDNSProviderConfig, namespace string, allowAmbient bool) (string, error) {
+	if cfg.TokenProvider != "" {
+		return c.tokens.token(context.TODO(), cfg.TokenProvider, namespace)
+	}
+	if cfg.APITokenFile != "" {
+		return c.tokenFiles.read(namespace, cfg.APITokenFile)
+	}
+	if cfg.APITokenVaultRef != nil {
+		return c.vault.token(context.TODO(), cfg.APITokenVaultRef, namespace)
+	}
+	if cfg.UsernameSecretRef.Name != "" {
+		return c.getBasicAuth(cfg, namespace)
+	}
+	if cfg.APITokenSecretRef.Name == "" && allowAmbient && c.env.token != "" {
+		klog.V(6).Infof("using ambient token from %s", legoEnvToken)
+		return c.env.token, nil
+	}
+	if cfg.APITokenSecretRef.Name == "" && c.ambientToken != "" {
+		klog.V(6).Infof("using ambient token from %s", ambientTokenEnv)
+		return c.ambientToken, nil
+	}
+	mgmt, err := c.kube.get()
+	if err != nil {
+		return "", err
+	}
+	if mgmt == nil {
+		return "", fmt.Errorf("no Kubernetes client configured to load secret `%s`", cfg.APITokenSecretRef.Name)
+	}
+	secretName := cfg.APITokenSecretRef.Name
+	if namespace, err = c.secretNamespace(&cfg.APITokenSecretRef, namespace); err != nil {
+		return "", err
+	}
+
+	client := mgmt
+	if cfg.WorkloadCluster != nil {
+		if c.fleet == nil {
+			return "", fmt.Errorf("workloadCluster %q is configured but the webhook is not running with --fleet-mode", cfg.WorkloadCluster.Name)
+		}
+		cl, err := c.fleet.get(mgmt, namespace, cfg.WorkloadCluster)
+		if err != nil {
+			return "", err
+		}
+		client = cl
+		if cfg.WorkloadCluster.SecretNamespace != "" {
+			namespace = cfg.WorkloadCluster.SecretNamespace
+		}
+	}
+
+	keys := apiTokenSecretKeys(cfg)
+	klog.V(6).Infof("try to load secret `%s` with keys %q", secretName, keys)
+
+	cred := fmt.Sprintf("%s/%s[%s]", namespace, secretName, strings.Join(keys, "|"))
+	if client == mgmt {
+		if cfg.fresh {
+			c.apiKeys.invalidate(cred)
+		} else if token, ok := c.apiKeys.get(cred); ok {
+			return token, nil
+		}
+	}
+	sec, err := c.getSecret(client, namespace, secretName, cfg.fresh)
+	if client == mgmt {
+		c.kube.observe(mgmt, err)
+	}
+	if err != nil {
+		if client == mgmt && apiServerUnavailable(err) {
+			if token, age, ok := c.staleTokens.get(cred); ok {
+				klog.Warningf("Kubernetes API server unavailable, using the token read from secret %s %s ago: %v",
+					cred, age.Round(time.Second), err)
+				return token, nil
+			}
+		}
+		return "", fmt.Errorf("unable to get secret `%s`; %w", secretName, err)
+	}
+
+	apiKey, key, legacy, ok := tokenFromSecret(sec, keys)
+	if !ok {
+		if len(keys) == 1 {
+			return "", missingKey("key %q not found in secret \"%s/%s\"", keys[0],
+				cfg.APITokenSecretRef.Name, namespace)
+		}
+		if cfg.APITokenSecretRef.Key == "" && len(cfg.APITokenSecretKeys) == 0 {
+			return "", missingKey("apiTokenSecretRef.key is not set and none of the default keys %q found in secret \"%s/%s\"; set apiTokenSecretRef.key",
+				keys, cfg.APITokenSecretRef.Name, namespace)
+		}
+		return "", missingKey("none of the keys %q found in secret \"%s/%s\"", keys,
+			cfg.APITokenSecretRef.Name, namespace)
+	}
+	if legacy {
+		warnLegacySecret(namespace, secretName, key)
+	} else if cfg.APITokenSecretRef.Key == "" {
+		logAssumedKey(namespace, secretName, key)
+	}
+	if client == mgmt {
+		c.staleTokens.add(cred, apiKey)
+		c.apiKeys.add(cred, apiKey)
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/jetstack/cert-manager/test/acme/dns"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	zone               = os.Getenv("TEST_ZONE_NAME")
+	kubeBuilderBinPath = "../../kubebuilder/bin"
+
+	// dnsServer is the resolver used by the fixture to check propagation.
+	dnsServer = envOrDefault("TEST_DNS_SERVER", "8.8.8.8:53")
+	// pollInterval and propagationLimit default to values that match how
+	// long records published through do.de take to become visible.
+	pollInterval     = envDurationOrDefault("TEST_POLL_INTERVAL", 5*time.Second)
+	propagationLimit = envDurationOrDefault("TEST_PROPAGATION_LIMIT", 5*time.Minute)
+
+	// sweepBackoff spaces the attempts to remove leftovers: 1+2+4+8+16
+	// seconds.
+	sweepBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 6}
+)
+
+func TestRunsSuite(t *testing.T) {
+	// The manifest path should contain a file named config.json that is a
+	// snippet of valid configuration that should be included on the
+	// ChallengeRequest passed as part of the test cases.
+
+	sweepLeftovers(t, fmt.Sprintf("_acme-challenge.%s", zone))
+
+	fixture := dns.NewFixture(NewSolver(),
+		dns.SetResolvedFQDN(fmt.Sprintf("_acme-challenge.%s", zone)),
+		dns.SetResolvedZone(zone),
+		dns.SetBinariesPath(kubeBuilderBinPath),
+		dns.SetAllowAmbientCredentials(false),
+		dns.SetManifestPath("testdata/my-custom-solver"),
+		// Strict mode also verifies that CleanUp removes only the record
+		// with the challenge's key and leaves other values in place.
+		dns.SetStrict(true),
+		dns.SetDNSServer(dnsServer),
+		dns.SetPollInterval(pollInterval),
+		dns.SetPropagationLimit(propagationLimit),
+	)
+
+	fixture.RunConformance(t)
+}
+
+// TestRunsSuiteWithWildcard runs the basic conformance test while the
+// challenge of the wildcard name is validated next to it, as for a
+// certificate covering both zone and *.zone. Both challenges share the
+// record name, so the fixture only sees its value removed, and the wildcard
+// value is only still served afterwards, if the ledger restores the other
+// challenge's value on CleanUp.
+func TestRunsSuiteWithWildcard(t *testing.T) {
+	fqdn := fmt.Sprintf("_acme-challenge.%s", zone)
+	sweepLeftovers(t, fqdn)
+
+	// The fixture calls Initialize through the wrapper, which is promoted
+	// from the embedded solver and sets it up in place.
+	solver := &wildcardSolver{dodeDNSProviderSolver: NewSolver().(*dodeDNSProviderSolver), key: "456d=="}
+	// Registered before running the fixture, so that the wildcard value is
+	// removed even if the fixture fails the test, and doesn't stay behind for
+	// the next test using the same name.
+	t.Cleanup(func() {
+		if wildcard := solver.pending(); wildcard != nil {
+			if err := solver.dodeDNSProviderSolver.CleanUp(wildcard); err != nil {
+				t.Errorf("cleaning up the wildcard challenge: %v", err)
+			}
+		}
+		if err := sweep(t, fqdn); err != nil {
+			t.Errorf("unable to sweep leftovers at %s: %v", fqdn, err)
+		}
+	})
+	fixture := dns.NewFixture(solver,
+		dns.SetResolvedFQDN(fqdn),
+		dns.SetResolvedZone(zone),
+		dns.SetBinariesPath(kubeBuilderBinPath),
+		dns.SetAllowAmbientCredentials(false),
+		dns.SetManifestPath("testdata/my-custom-solver"),
+		dns.SetDNSServer(dnsServer),
+		dns.SetPollInterval(pollInterval),
+		dns.SetPropagationLimit(propagationLimit),
+	)
+	fixture.RunBasic(t)
+
+	if solver.pending() == nil {
+		t.Fatalf("expected the wildcard challenge to be presented")
+	}
+	resolver := newDNSResolver(dnsServer)
+	err := wait.PollImmediate(pollInterval, propagationLimit, func() (bool, error) {
+		return hasTXTValue(context.Background(), resolver, fqdn, solver.key)
+	})
+	if err != nil {
+		t.Errorf("expected the wildcard challenge's value to be served after the other challenge was cleaned up: %v", err)
+	}
+}
+
+// wildcardSolver presents the challenge of the wildcard name concurrently
+// with every challenge the fixture presents, in the same solver, and leaves
+// it in place when the fixture cleans up.
+type wildcardSolver struct {
+	*dodeDNSProviderSolver
+	key string
+
+	mu       sync.Mutex
+	wildcard *v1alpha1.ChallengeRequest
+}
+
+func (s *wildcardSolver) Present(ch *v1alpha1.ChallengeRequest) error {
+	wildcard := *ch
+	wildcard.UID = ch.UID + "-wildcard"
+	wildcard.DNSName = "*." + strings.TrimSuffix(ch.ResolvedZone, ".")
+	wildcard.Key = s.key
+	s.mu.Lock()
+	s.wildcard = &wildcard
+	s.mu.Unlock()
+
+	var g errgroup.Group
+	g.Go(func() error { return s.dodeDNSProviderSolver.Present(ch) })
+	g.Go(func() error { return s.dodeDNSProviderSolver.Present(&wildcard) })
+	return g.Wait()
+}
+
+// pending returns the wildcard challenge presented last.
+func (s *wildcardSolver) pending() *v1alpha1.ChallengeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wildcard
+}
+
+// sweepLeftovers removes the TXT records a previously failed run may have left
+// at fqdn, which would otherwise make strict mode fail again. It needs the
+// token in TEST_DODE_TOKEN and is skipped without it.
+func sweepLeftovers(t *testing.T, fqdn string) {
+	if err := sweep(t, fqdn); err != nil {
+		t.Fatalf("unable to sweep leftovers at %s: %v", fqdn, err)
+	}
+}
+
+// sweep removes the TXT records at fqdn like sweepLeftovers, but returns the
+// error, so that it can be used in cleanup functions.
+func sweep(t *testing.T, fqdn string) error {
+	token := os.Getenv("TEST_DODE_TOKEN")
+	if token == "" || zone == "" {
+		t.Logf("TEST_DODE_TOKEN or TEST_ZONE_NAME not set, not sweeping leftovers at %s", fqdn)
+		return nil
+	}
+	client := dode.NewClient()
+	var lastErr error
+	err := wait.ExponentialBackoff(sweepBackoff, func() (bool, error) {
+		lastErr = client.CleanUp(context.Background(), token, dode.Domain(fqdn))
+		return lastErr == nil, nil
+	})
+	if err != nil {
+		return lastErr
+	}
+	t.Logf("swept leftovers at %s", fqdn)
+	return nil
+}
+
+func envOrDefault(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDurationOrDefault(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Sprintf("invalid duration %q in %s: %v", v, name, err))
+	}
+	return d
+}
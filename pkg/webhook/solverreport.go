@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	acmewebhook "github.com/jetstack/cert-manager/pkg/acme/webhook"
+	"k8s.io/klog"
+)
+
+// AnyZone stands for every zone in the solver report.
+const AnyZone = "*"
+
+// ZoneReporter is implemented by solvers that can tell which zones they
+// handle, e.g. those passed to NewRunnable or RegisterWithManager. Solvers
+// registered next to dode that don't implement it are listed in the solver
+// report without zones.
+type ZoneReporter interface {
+	// ReportZones returns the zones the solver is configured for, AnyZone
+	// if it takes every zone, and the zones it solved challenges for since
+	// it started.
+	ReportZones() (configured, observed []string)
+}
+
+// solverInfo is the entry of a single solver in the solver report.
+type solverInfo struct {
+	Name string `json:"name"`
+	// ConfiguredZones is nil if the solver doesn't report its zones.
+	ConfiguredZones []string `json:"configuredZones"`
+	ObservedZones   []string `json:"observedZones,omitempty"`
+}
+
+// solverReport is which of the solvers registered with the webhook handles
+// which zones, for deployments mixing dode with other providers.
+type solverReport struct {
+	Solvers []solverInfo `json:"solvers"`
+	// Overlaps lists pairs of solvers configured for the same zones, so
+	// that an issuer may be pointed at the wrong one.
+	Overlaps []string `json:"overlaps,omitempty"`
+}
+
+// registeredSolvers are the solvers the webhook serves, set when it starts.
+var registeredSolvers struct {
+	mu      sync.Mutex
+	solvers []acmewebhook.Solver
+}
+
+func registerSolvers(solvers []acmewebhook.Solver) {
+	registeredSolvers.mu.Lock()
+	defer registeredSolvers.mu.Unlock()
+	registeredSolvers.solvers = solvers
+}
+
+// currentSolverReport builds the report of the registered solvers.
+func currentSolverReport() solverReport {
+	registeredSolvers.mu.Lock()
+	solvers := registeredSolvers.solvers
+	registeredSolvers.mu.Unlock()
+	return newSolverReport(solvers)
+}
+
+func newSolverReport(solvers []acmewebhook.Solver) solverReport {
+	var rep solverReport
+	for _, s := range solvers {
+		info := solverInfo{Name: s.Name()}
+		if zr, ok := s.(ZoneReporter); ok {
+			info.ConfiguredZones, info.ObservedZones = zr.ReportZones()
+		}
+		rep.Solvers = append(rep.Solvers, info)
+	}
+	for i, a := range rep.Solvers {
+		for _, b := range rep.Solvers[i+1:] {
+			if zone, ok := overlappingZone(a.ConfiguredZones, b.ConfiguredZones); ok {
+				rep.Overlaps = append(rep.Overlaps, fmt.Sprintf("%s and %s both handle %s", a.Name, b.Name, zone))
+			}
+		}
+	}
+	return rep
+}
+
+// overlappingZone returns a zone handled according to both a and b. Entries
+// that aren't domains, such as shard expressions, never overlap.
+func overlappingZone(a, b []string) (string, bool) {
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case x == AnyZone:
+				return y, true
+			case y == AnyZone:
+				return x, true
+			case strings.HasPrefix(x, zoneShardRegexPrefix) || strings.HasPrefix(y, zoneShardRegexPrefix):
+			case x == y || strings.HasSuffix(x, "."+y):
+				return x, true
+			case strings.HasSuffix(y, "."+x):
+				return y, true
+			}
+		}
+	}
+	return "", false
+}
+
+// log logs one line per solver, and the overlaps as warnings.
+func (rep solverReport) log() {
+	for _, s := range rep.Solvers {
+		zones := "not reported"
+		if s.ConfiguredZones != nil {
+			zones = strings.Join(s.ConfiguredZones, ",")
+		}
+		klog.Infof("solver %s handles zones %s", s.Name, zones)
+	}
+	for _, overlap := range rep.Overlaps {
+		klog.Warningf("solver report: %s", overlap)
+	}
+}
+
+// serveSolverReport serves the solver report as JSON.
+func serveSolverReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(currentSolverReport())
+}
+
+// ReportZones returns the shard of the webhook, or AnyZone without one, and
+// the zones of the credential summary.
+func (c *dodeDNSProviderSolver) ReportZones() (configured, observed []string) {
+	switch {
+	case c.shard == nil:
+		configured = []string{AnyZone}
+	case c.shard.re != nil:
+		configured = []string{c.shard.spec}
+	default:
+		configured = append(configured, c.shard.suffixes...)
+	}
+	return configured, c.creds.zones()
+}
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	acmewebhook "github.com/jetstack/cert-manager/pkg/acme/webhook"
+)
+
+// otherSolver stands in for a solver of another provider.
+type otherSolver struct {
+	acmewebhook.Solver
+	name string
+}
+
+func (s otherSolver) Name() string {
+	return s.name
+}
+
+// zonedSolver is another provider's solver reporting its zones.
+type zonedSolver struct {
+	otherSolver
+	zones []string
+}
+
+func (s zonedSolver) ReportZones() (configured, observed []string) {
+	return s.zones, nil
+}
+
+func TestSolverReport(t *testing.T) {
+	c := newDodeDNSProviderSolver(nil, nil)
+	c.shard, _ = parseZoneShard("example.com,example.org")
+	c.creds.observe("secret a/dode[token]", "www.example.com.", nil)
+	c.creds.observe("secret b/dode[token]", "example.org.", nil)
+
+	rep := newSolverReport([]acmewebhook.Solver{
+		c,
+		zonedSolver{otherSolver{name: "rfc2136"}, []string{"internal.example.com", "example.net"}},
+		otherSolver{name: "hetzner"},
+	})
+	want := solverReport{
+		Solvers: []solverInfo{
+			{Name: solverName, ConfiguredZones: []string{"example.com", "example.org"}, ObservedZones: []string{"example.org", "www.example.com"}},
+			{Name: "rfc2136", ConfiguredZones: []string{"internal.example.com", "example.net"}},
+			{Name: "hetzner"},
+		},
+		Overlaps: []string{solverName + " and rfc2136 both handle internal.example.com"},
+	}
+	if !reflect.DeepEqual(rep, want) {
+		t.Errorf("expected report\n%+v\ngot\n%+v", want, rep)
+	}
+}
+
+func TestOverlappingZone(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		zone string
+		ok   bool
+	}{
+		{[]string{AnyZone}, []string{"example.com"}, "example.com", true},
+		{[]string{"example.com"}, []string{"example.com"}, "example.com", true},
+		{[]string{"example.com"}, []string{"sub.example.com"}, "sub.example.com", true},
+		{[]string{"example.com"}, []string{"badexample.com"}, "", false},
+		{[]string{"regex:^a"}, []string{"example.com"}, "", false},
+		{nil, []string{AnyZone}, "", false},
+	}
+	for _, test := range tests {
+		zone, ok := overlappingZone(test.a, test.b)
+		if zone != test.zone || ok != test.ok {
+			t.Errorf("overlappingZone(%q, %q): expected %q, %v, got %q, %v", test.a, test.b, test.zone, test.ok, zone, ok)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// defaultMaxTokenStaleness is how long a token read from a Secret may be
+// used in place of the Secret while the API server is unavailable.
+const defaultMaxTokenStaleness = time.Hour
+
+// staleTokens remembers the tokens last read from Secrets, so that challenges
+// can go on with them while the API server is unavailable, e.g. during
+// control plane maintenance, rather than failing until it is back.
+type staleTokens struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]staleToken
+}
+
+// staleToken is a token and when it was read.
+type staleToken struct {
+	token string
+	read  time.Time
+}
+
+// newStaleTokens returns a staleTokens handing out tokens up to maxAge old.
+// Tokens are never handed out if maxAge is zero.
+func newStaleTokens(maxAge time.Duration) *staleTokens {
+	return &staleTokens{maxAge: maxAge, now: time.Now, tokens: map[string]staleToken{}}
+}
+
+// add records that token was just read for cred.
+func (s *staleTokens) add(cred, token string) {
+	if s.maxAge <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[cred] = staleToken{token: token, read: s.now()}
+}
+
+// get returns the token last read for cred and its age, unless it is older
+// than maxAge.
+func (s *staleTokens) get(cred string) (string, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[cred]
+	if !ok {
+		return "", 0, false
+	}
+	age := s.now().Sub(t.read)
+	if age > s.maxAge {
+		delete(s.tokens, cred)
+		return "", 0, false
+	}
+	return t.token, age, true
+}
+
+// apiServerUnavailable tells whether err, returned when reading a Secret,
+// means that the API server couldn't answer rather than that the Secret is
+// missing or may not be read.
+func apiServerUnavailable(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		// No answer at all, e.g. the connection was refused.
+		return true
+	}
+	return apierrors.IsServiceUnavailable(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err)
+}
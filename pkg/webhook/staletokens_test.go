@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStaleTokens(t *testing.T) {
+	now := time.Now()
+	s := newStaleTokens(time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.add("default/dode[token]", "abc")
+	now = now.Add(30 * time.Minute)
+	if token, age, ok := s.get("default/dode[token]"); !ok || token != "abc" || age != 30*time.Minute {
+		t.Errorf("expected the token read 30m ago, got %q, %v, %v", token, age, ok)
+	}
+	if _, _, ok := s.get("default/other[token]"); ok {
+		t.Errorf("expected no token for secrets that were never read")
+	}
+	now = now.Add(time.Hour)
+	if _, _, ok := s.get("default/dode[token]"); ok {
+		t.Errorf("expected tokens older than the maximum staleness not to be used")
+	}
+
+	disabled := newStaleTokens(0)
+	disabled.add("default/dode[token]", "abc")
+	if _, _, ok := disabled.get("default/dode[token]"); ok {
+		t.Errorf("expected no tokens to be kept with a maximum staleness of zero")
+	}
+}
+
+func TestAPIServerUnavailable(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dial tcp 10.0.0.1:443: connect: connection refused"), true},
+		{apierrors.NewServiceUnavailable("maintenance"), true},
+		{apierrors.NewTimeoutError("etcd", 1), true},
+		{apierrors.NewInternalError(errors.New("boom")), true},
+		{apierrors.NewNotFound(secrets, "dode"), false},
+		{fmt.Errorf("gave up waiting for secret to be created: %w", apierrors.NewNotFound(secrets, "dode")), false},
+		{apierrors.NewForbidden(secrets, "dode", errors.New("denied")), false},
+		{apierrors.NewUnauthorized("expired"), false},
+	}
+	for _, test := range tests {
+		if got := apiServerUnavailable(test.err); got != test.want {
+			t.Errorf("%v: expected %v, got %v", test.err, test.want, got)
+		}
+	}
+}
+
+func TestGetAPIKeyUsesStaleTokenWhileAPIServerIsUnavailable(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dode"},
+		Data:       map[string][]byte{"token": []byte("abc")},
+	})
+	c := newDodeDNSProviderSolver(client, nil)
+	cfg := &dodeDNSProviderConfig{}
+	cfg.APITokenSecretRef.Name = "dode"
+
+	if token, err := c.getAPIKey(cfg, "default", false); err != nil || token != "abc" {
+		t.Fatalf("expected the token from the secret, got %q, %v", token, err)
+	}
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("maintenance")
+	})
+	if token, err := c.getAPIKey(cfg, "default", false); err != nil || token != "abc" {
+		t.Errorf("expected the token read before, got %q, %v", token, err)
+	}
+	if _, err := c.getAPIKey(cfg, "other", false); err == nil {
+		t.Errorf("expected an error for secrets that were never read")
+	}
+}
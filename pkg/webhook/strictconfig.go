@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unknownConfigFields returns the paths of the fields in the solver config
+// raw that dodeDNSProviderConfig has no field for, sorted, each with the
+// field it likely meant if it only differs in case, e.g.
+// "apiTokenSecretref (did you mean apiTokenSecretRef?)". encoding/json
+// ignores unknown fields and matches names case-insensitively, so typos
+// otherwise go unnoticed until a challenge fails for seemingly no reason.
+func unknownConfigFields(raw []byte) []string {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	var unknown []string
+	walkUnknownFields(reflect.TypeOf(dodeDNSProviderConfig{}), v, "", &unknown)
+	sort.Strings(unknown)
+	return unknown
+}
+
+// walkUnknownFields appends the unknown fields of the decoded JSON value v
+// of type t below path to unknown.
+func walkUnknownFields(t reflect.Type, v interface{}, path string, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for name, value := range obj {
+			p := joinFieldPath(path, name)
+			if ft, ok := fields[name]; ok {
+				walkUnknownFields(ft, value, p, unknown)
+				continue
+			}
+			if known := matchFieldFold(fields, name); known != "" {
+				p += fmt.Sprintf(" (did you mean %s?)", known)
+			}
+			*unknown = append(*unknown, p)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			walkUnknownFields(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range obj {
+			walkUnknownFields(t.Elem(), value, fmt.Sprintf("%s[%s]", path, key), unknown)
+		}
+	}
+}
+
+// jsonFields returns the types of the fields of the struct type t by their
+// JSON name, including those of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			for n, ft := range jsonFields(f.Type) {
+				fields[n] = ft
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// matchFieldFold returns the field of fields whose name equals name but for
+// case, if any.
+func matchFieldFold(fields map[string]reflect.Type, name string) string {
+	for known := range fields {
+		if strings.EqualFold(known, name) {
+			return known
+		}
+	}
+	return ""
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
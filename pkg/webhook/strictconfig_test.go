@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestUnknownConfigFields(t *testing.T) {
+	got := unknownConfigFields([]byte(`{
+		"apiTokenSecretref": {"name": "dode"},
+		"apiTokenSecretRefs": [{"name": "old", "kye": "token"}],
+		"zoneTokens": {"example.com": {"name": "dode", "key": "token", "namespace": "x"}},
+		"propagation": {"dohServers": ["google"], "timeout": 60, "checkers": [{"type": "any", "checkers": [{"type": "recursive", "srv": "1.1.1.1"}]}]},
+		"ttl": 600
+	}`))
+	want := []string{
+		"apiTokenSecretRefs[0].kye",
+		"apiTokenSecretref (did you mean apiTokenSecretRef?)",
+		"propagation.checkers[0].checkers[0].srv",
+		"propagation.timeout",
+		"zoneTokens[example.com].namespace",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := unknownConfigFields([]byte(`{"apiTokenSecretRef": {"name": "dode", "key": "token"}, "ttl": 600}`)); len(got) != 0 {
+		t.Errorf("expected no unknown fields, got %q", got)
+	}
+}
+
+func TestLoadConfigStrict(t *testing.T) {
+	defer func(strict bool) { *strictConfig = strict }(*strictConfig)
+	cfg := &extapi.JSON{Raw: []byte(`{"apiTokenSecretRef": {"name": "dode"}, "tll": 600}`)}
+
+	*strictConfig = false
+	if _, err := loadConfig(cfg, nil); err != nil {
+		t.Errorf("expected unknown fields to be ignored, got %v", err)
+	}
+	*strictConfig = true
+	if _, err := loadConfig(cfg, nil); err == nil || !strings.Contains(err.Error(), "unknown fields in solver config: tll") {
+		t.Errorf("expected the unknown field to be reported, got %v", err)
+	}
+}
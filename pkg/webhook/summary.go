@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// summarizeConfig describes a raw solver config for log output. It only
+// includes the names of the configured fields and the name and key of
+// secret references, never any values, so that credentials accidentally
+// inlined into an Issuer can't end up in the logs.
+func summarizeConfig(cfgJSON *extapi.JSON) string {
+	if cfgJSON == nil {
+		return "<no config>"
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(cfgJSON.Raw, &fields); err != nil {
+		return fmt.Sprintf("<invalid config, %d bytes>", len(cfgJSON.Raw))
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var refs []string
+	for _, name := range names {
+		if !strings.HasSuffix(name, "SecretRef") {
+			continue
+		}
+		var ref struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		}
+		if err := json.Unmarshal(fields[name], &ref); err != nil {
+			refs = append(refs, name+"=<invalid>")
+			continue
+		}
+		refs = append(refs, fmt.Sprintf("%s=%s/%s", name, ref.Name, ref.Key))
+	}
+
+	return fmt.Sprintf("fields=[%s] secretRefs=[%s]", strings.Join(names, ","), strings.Join(refs, ","))
+}
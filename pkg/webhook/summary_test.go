@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestSummarizeConfig(t *testing.T) {
+	const token = "c3VwZXJzZWNyZXQ"
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{
+			raw:  `{"apiTokenSecretRef":{"name":"dode-secret","key":"DODE_TOKEN"},"propagation":{"dohServers":["google"]}}`,
+			want: "fields=[apiTokenSecretRef,propagation] secretRefs=[apiTokenSecretRef=dode-secret/DODE_TOKEN]",
+		},
+		{
+			raw:  `{"apiToken":"` + token + `","apiTokenSecretRef":"` + token + `"}`,
+			want: "fields=[apiToken,apiTokenSecretRef] secretRefs=[apiTokenSecretRef=<invalid>]",
+		},
+		{
+			raw:  `token=` + token,
+			want: "<invalid config, 21 bytes>",
+		},
+	}
+	for _, test := range tests {
+		got := summarizeConfig(&extapi.JSON{Raw: []byte(test.raw)})
+		if got != test.want {
+			t.Errorf("summarizeConfig(%s) = %q, want %q", test.raw, got, test.want)
+		}
+		if strings.Contains(got, token) {
+			t.Errorf("summary of %s leaks the token: %q", test.raw, got)
+		}
+	}
+
+	if got := summarizeConfig(nil); got != "<no config>" {
+		t.Errorf("unexpected summary of nil config %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"k8s.io/klog"
+)
+
+// startupTokenCheckTimeout bounds the check of all configured tokens.
+const startupTokenCheckTimeout = time.Minute
+
+// startupTokenCheck checks the tokens the webhook itself is configured with
+// once it started, so that a revoked or mistyped token is noticed right away
+// instead of on the first certificate order. do.de has no endpoint to merely
+// validate a token, so the check deletes the TXT records at the
+// _acme-challenge name of a domain no Certificate uses, which is a no-op
+// for a valid token. As that bypasses the ledger, the check is refused if
+// the ledger tracks values at that name, i.e. a Certificate does use it.
+type startupTokenCheck struct {
+	domain string
+
+	mu       sync.Mutex
+	rejected []string
+	refused  string
+}
+
+// configuredTokens returns the tokens of the webhook by the environment
+// variable they are read from.
+func (c *dodeDNSProviderSolver) configuredTokens() map[string]string {
+	tokens := map[string]string{}
+	if c.ambientToken != "" {
+		tokens[ambientTokenEnv] = c.ambientToken
+	}
+	if c.env.token != "" {
+		tokens[legoEnvToken] = c.env.token
+	}
+	return tokens
+}
+
+// run checks tokens with api, logging the outcome for every token. It holds
+// the ledger's lock of the record name throughout, so that no challenge is
+// presented there while its records are deleted.
+func (t *startupTokenCheck) run(api dodeAPI, ledger *recordLedger, tokens map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), startupTokenCheckTimeout)
+	defer cancel()
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	domain := dode.Domain(challengeRecordName(t.domain))
+	unlock := ledger.lock(domain)
+	defer unlock()
+	if values := ledger.byAge(domain); len(values) > 0 {
+		klog.Errorf("not checking the tokens: %d challenge values are presented at %s, which --%sstartup-token-check-wipe-domain would delete; use a domain no Certificate uses", len(values), domain, flagPrefix)
+		t.mu.Lock()
+		t.refused = domain
+		t.mu.Unlock()
+		return
+	}
+	for _, name := range names {
+		err := api.CleanUp(ctx, tokens[name], domain)
+		switch {
+		case dode.IsAuthError(err):
+			klog.Errorf("DODE API rejected the token in %s: %v", name, err)
+			t.mu.Lock()
+			t.rejected = append(t.rejected, name)
+			t.mu.Unlock()
+		case err != nil:
+			klog.Warningf("could not check the token in %s: %v", name, err)
+		default:
+			klog.Infof("DODE API accepted the token in %s", name)
+		}
+	}
+}
+
+// healthCheck reports the webhook as degraded if a token was rejected or the
+// check was refused.
+func (t *startupTokenCheck) healthCheck() (healthState, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.refused != "" {
+		return healthDegraded, "startup token check refused, as challenges use " + t.refused
+	}
+	if len(t.rejected) == 0 {
+		return healthHealthy, ""
+	}
+	return healthDegraded, "tokens rejected by the DODE API at startup: " + strings.Join(t.rejected, ", ")
+}
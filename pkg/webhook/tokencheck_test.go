@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStartupTokenCheck(t *testing.T) {
+	api := newFakeDodeAPI("good")
+	defer api.Close()
+	c := newTestSolver(api)
+	c.ambientToken = "good"
+	c.env.token = "revoked"
+
+	check := &startupTokenCheck{domain: "token-check.example.com"}
+	if state, _ := check.healthCheck(); state != healthHealthy {
+		t.Errorf("expected a healthy state before the check, got %s", state)
+	}
+	check.run(c.api, c.ledger, c.configuredTokens())
+	state, reason := check.healthCheck()
+	if state != healthDegraded || !strings.Contains(reason, legoEnvToken) || strings.Contains(reason, ambientTokenEnv) {
+		t.Errorf("expected the rejected token to degrade the webhook, got %s: %q", state, reason)
+	}
+	if api.calls != 2 {
+		t.Errorf("expected every token to be checked, got %d calls", api.calls)
+	}
+
+	in := &startupTokenCheck{domain: "example.com"}
+	c.ledger.add("_acme-challenge.example.com", "key")
+	calls := api.calls
+	in.run(c.api, c.ledger, c.configuredTokens())
+	if state, reason := in.healthCheck(); state != healthDegraded || !strings.Contains(reason, "refused") {
+		t.Errorf("expected the check to be refused at a name challenges use, got %s: %q", state, reason)
+	}
+	if api.calls != calls {
+		t.Errorf("expected no records to be deleted at a name challenges use, got %d calls", api.calls-calls)
+	}
+
+	if got := newDodeDNSProviderSolver(nil, nil).configuredTokens(); len(got) != 0 {
+		t.Errorf("expected no tokens without ambient credentials, got %d", len(got))
+	}
+}
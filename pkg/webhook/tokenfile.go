@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// tokenFilePollInterval is how often the token files in use are checked for
+// changes.
+const tokenFilePollInterval = 30 * time.Second
+
+// tokenFiles reads API tokens from files below dir, such as those mounted by
+// the Secrets Store CSI driver or external-secrets, so that tokens can be
+// rotated without touching Kubernetes Secrets or restarting the webhook. The
+// files are read again for every challenge; the files read once are also
+// watched, so that a rotation leaving a file empty or unreadable is noticed
+// before the next challenge fails. Solver configs can only name files below
+// dir/<namespace of the challenge>, where dir is set by the operator with
+// --dode.token-file-dir, as otherwise whoever may create Issuers could make
+// the webhook send any file it can read, e.g. its service account token or
+// another namespace's API token, to an endpoint of their choosing.
+type tokenFiles struct {
+	dir string
+
+	mu      sync.Mutex
+	digests map[string][sha256.Size]byte
+}
+
+func newTokenFiles(dir string) *tokenFiles {
+	return &tokenFiles{dir: filepath.Clean(dir), digests: map[string][sha256.Size]byte{}}
+}
+
+// resolve returns the path of name, which is relative to the directory of
+// namespace below dir or an absolute path below it, unless it refers to a
+// file outside that directory, also through symbolic links.
+func (f *tokenFiles) resolve(namespace, name string) (string, error) {
+	if f == nil {
+		return "", fmt.Errorf("apiTokenFile %q can't be used, token files must be enabled with --dode.token-file-dir", name)
+	}
+	if namespace == "" || strings.ContainsRune(namespace, filepath.Separator) || namespace == "." || namespace == ".." {
+		return "", fmt.Errorf("apiTokenFile %q can't be used for namespace %q", name, namespace)
+	}
+	base := filepath.Join(f.dir, namespace)
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	if !within(base, path) {
+		return "", fmt.Errorf("apiTokenFile %q is not below %s", name, base)
+	}
+	dir, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(dir, target) {
+		return "", fmt.Errorf("apiTokenFile %q links to a file outside %s", name, base)
+	}
+	return path, nil
+}
+
+// within reports whether path lies below dir.
+func within(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// read returns the token in the file name of namespace, with surrounding
+// white space removed, and watches the file from then on.
+func (f *tokenFiles) read(namespace, name string) (string, error) {
+	path, err := f.resolve(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	token, digest, err := readTokenFile(path)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	f.digests[path] = digest
+	f.mu.Unlock()
+	return token, nil
+}
+
+func readTokenFile(path string) (string, [sha256.Size]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", [sha256.Size]byte{}, fmt.Errorf("reading token file: %v", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", [sha256.Size]byte{}, fmt.Errorf("token file %s is empty", path)
+	}
+	return token, sha256.Sum256([]byte(token)), nil
+}
+
+// poll checks the watched files, logging rotated tokens and warning about
+// files that can no longer be used. Those aren't watched any more until a
+// challenge reads them again, so the warning isn't repeated.
+func (f *tokenFiles) poll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for path, old := range f.digests {
+		_, digest, err := readTokenFile(path)
+		if err != nil {
+			klog.Warningf("token file %s can no longer be used, challenges using it will fail: %v", path, err)
+			delete(f.digests, path)
+			continue
+		}
+		if digest != old {
+			klog.Infof("token in %s was rotated, using the new token from now on", path)
+			f.digests[path] = digest
+		}
+	}
+}
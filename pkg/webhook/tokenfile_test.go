@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokenfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mount := filepath.Join(dir, "mount")
+	for _, ns := range []string{"team-a", "team-b"} {
+		if err := os.MkdirAll(filepath.Join(mount, ns), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(mount, "team-a", "token"), "first\n")
+	write(filepath.Join(mount, "team-b", "token"), "other")
+	write(filepath.Join(dir, "outside"), "secret")
+	if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(mount, "team-a", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(mount, "team-b", "token"), filepath.Join(mount, "team-a", "other")); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newTokenFiles(mount)
+	for _, name := range []string{"token", filepath.Join(mount, "team-a", "token")} {
+		if got, err := f.read("team-a", name); err != nil || got != "first" {
+			t.Errorf("reading %s: expected first, got %q, %v", name, got, err)
+		}
+	}
+	// A rotated token is used for the next challenge.
+	write(filepath.Join(mount, "team-a", "token"), "second")
+	f.poll()
+	if got, _ := f.read("team-a", "token"); got != "second" {
+		t.Errorf("expected the rotated token, got %q", got)
+	}
+
+	// Files of other namespaces can't be read, neither directly nor through
+	// symbolic links.
+	for _, name := range []string{"../outside", "../../outside", filepath.Join(dir, "outside"), "link", "missing",
+		"../team-b/token", filepath.Join(mount, "team-b", "token"), "other"} {
+		if _, err := f.read("team-a", name); err == nil {
+			t.Errorf("expected an error reading %s", name)
+		}
+	}
+	for _, ns := range []string{"", "..", "team-a/../team-b"} {
+		if _, err := f.read(ns, "token"); err == nil {
+			t.Errorf("expected an error reading a token for namespace %q", ns)
+		}
+	}
+	var none *tokenFiles
+	if _, err := none.read("team-a", "token"); err == nil || !strings.Contains(err.Error(), "--dode.token-file-dir") {
+		t.Errorf("expected token files to be disabled, got %v", err)
+	}
+
+	write(filepath.Join(mount, "team-a", "token"), "")
+	f.poll()
+	if len(f.digests) != 0 {
+		t.Errorf("expected an empty token file not to be watched any more")
+	}
+	if _, err := f.read("team-a", "token"); err == nil {
+		t.Errorf("expected an error for an empty token file")
+	}
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenProviderTimeout bounds every call of a token provider.
+	tokenProviderTimeout = 30 * time.Second
+	// tokenRefreshMargin is how long before they expire tokens are replaced,
+	// so that a token doesn't expire between being handed out and being
+	// used.
+	tokenRefreshMargin = time.Minute
+)
+
+// mintedToken is what token providers return: the exec plugin prints it on
+// stdout, the HTTP endpoint answers with it. Like the credentials of
+// client-go exec plugins, a token without expirationTimestamp isn't cached.
+type mintedToken struct {
+	Token               string    `json:"token"`
+	ExpirationTimestamp time.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// tokenMinter mints a token for the challenges of namespace.
+type tokenMinter interface {
+	mint(ctx context.Context, namespace string) (*mintedToken, error)
+}
+
+// execTokenMinter runs a command printing a mintedToken. The namespace is
+// passed in the DODE_NAMESPACE environment variable.
+type execTokenMinter struct {
+	command []string
+}
+
+func (m *execTokenMinter) mint(ctx context.Context, namespace string) (*mintedToken, error) {
+	cmd := exec.CommandContext(ctx, m.command[0], m.command[1:]...)
+	cmd.Env = append(os.Environ(), "DODE_NAMESPACE="+namespace)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %s: %v: %s", m.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return decodeMintedToken(bytes.NewReader(out))
+}
+
+// httpTokenMinter fetches a mintedToken from a broker with a GET request,
+// passing the namespace in the namespace query parameter.
+type httpTokenMinter struct {
+	url    string
+	client *http.Client
+}
+
+func (m *httpTokenMinter) mint(ctx context.Context, namespace string) (*mintedToken, error) {
+	req, err := http.NewRequest(http.MethodGet, m.url+"?"+url.Values{"namespace": {namespace}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, fmt.Errorf("%s returned status %d: %s", m.url, resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return decodeMintedToken(resp.Body)
+}
+
+func decodeMintedToken(r io.Reader) (*mintedToken, error) {
+	var t mintedToken
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, fmt.Errorf("decoding token: %v", err)
+	}
+	if t.Token == "" {
+		return nil, fmt.Errorf("no token returned")
+	}
+	return &t, nil
+}
+
+// tokenCacheKey identifies a token minted by a provider for a namespace.
+type tokenCacheKey struct {
+	provider  string
+	namespace string
+}
+
+// tokenProviders mint short-lived API tokens on demand for organizations
+// handing out do.de credentials through a broker. Solver configs refer to
+// the providers by name; the commands and URLs they call are set by the
+// operator through a flag, so that whoever may create Issuers can't make the
+// webhook run commands of their choosing. Tokens are cached per provider
+// and namespace and minted again shortly before they expire.
+type tokenProviders struct {
+	minters map[string]tokenMinter
+	now     func() time.Time
+
+	mu     sync.Mutex
+	tokens map[tokenCacheKey]*mintedToken
+}
+
+// parseTokenProviders parses comma separated providers of the form
+// <name>=exec:<command> [<arg>...] or <name>=<https URL>.
+func parseTokenProviders(s string) (*tokenProviders, error) {
+	p := &tokenProviders{
+		minters: map[string]tokenMinter{},
+		now:     time.Now,
+		tokens:  map[tokenCacheKey]*mintedToken{},
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid token provider %q, expected <name>=exec:<command> or <name>=<https URL>", entry)
+		}
+		name, spec := parts[0], parts[1]
+		if _, ok := p.minters[name]; ok {
+			return nil, fmt.Errorf("token provider %q defined twice", name)
+		}
+		if strings.HasPrefix(spec, "exec:") {
+			command := strings.Fields(strings.TrimPrefix(spec, "exec:"))
+			if len(command) == 0 {
+				return nil, fmt.Errorf("token provider %q has no command", name)
+			}
+			p.minters[name] = &execTokenMinter{command: command}
+			continue
+		}
+		if err := validateAPIURL(spec); err != nil {
+			return nil, fmt.Errorf("token provider %q %v", name, err)
+		}
+		p.minters[name] = &httpTokenMinter{url: spec, client: egressClient(tokenProviderTimeout)}
+	}
+	return p, nil
+}
+
+// urls returns the URLs of the HTTP providers.
+func (p *tokenProviders) urls() []string {
+	if p == nil {
+		return nil
+	}
+	var urls []string
+	for _, m := range p.minters {
+		if h, ok := m.(*httpTokenMinter); ok {
+			urls = append(urls, h.url)
+		}
+	}
+	return urls
+}
+
+// token returns a token of provider for namespace, minting a new one unless
+// a cached one is valid for longer than tokenRefreshMargin.
+func (p *tokenProviders) token(ctx context.Context, provider, namespace string) (string, error) {
+	if p == nil || p.minters[provider] == nil {
+		return "", fmt.Errorf("unknown token provider %q, it must be set up with --dode.token-providers", provider)
+	}
+	key := tokenCacheKey{provider, namespace}
+	p.mu.Lock()
+	t, ok := p.tokens[key]
+	p.mu.Unlock()
+	if ok && p.now().Add(tokenRefreshMargin).Before(t.ExpirationTimestamp) {
+		return t.Token, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenProviderTimeout)
+	defer cancel()
+	t, err := p.minters[provider].mint(ctx, namespace)
+	if err != nil {
+		return "", fmt.Errorf("token provider %q: %v", provider, err)
+	}
+	p.mu.Lock()
+	if t.ExpirationTimestamp.IsZero() {
+		delete(p.tokens, key)
+	} else {
+		p.tokens[key] = t
+	}
+	p.mu.Unlock()
+	return t.Token, nil
+}
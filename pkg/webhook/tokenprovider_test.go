@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTokenProviders(t *testing.T) {
+	p, err := parseTokenProviders("broker=exec:/usr/bin/broker --audience dode, web=https://broker.internal/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := p.minters["broker"].(*execTokenMinter); !ok || strings.Join(m.command, " ") != "/usr/bin/broker --audience dode" {
+		t.Errorf("unexpected exec provider %#v", p.minters["broker"])
+	}
+	if urls := p.urls(); len(urls) != 1 || urls[0] != "https://broker.internal/token" {
+		t.Errorf("unexpected URLs %q", urls)
+	}
+
+	for _, s := range []string{"broker", "=exec:broker", "broker=exec:", "web=http://broker.internal/token", "a=exec:x,a=exec:y"} {
+		if _, err := parseTokenProviders(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestTokenProvidersCacheUntilExpiry(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"token":"%s-%d","expirationTimestamp":"%s"}`,
+			r.URL.Query().Get("namespace"), calls, now.Add(10*time.Minute).Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	p, err := parseTokenProviders("web=" + srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.minters["web"].(*httpTokenMinter).client = srv.Client()
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, want := range []string{"team-a-1", "team-a-1"} {
+		if got, err := p.token(ctx, "web", "team-a"); err != nil || got != want {
+			t.Errorf("expected %q, got %q, %v", want, got, err)
+		}
+	}
+	if got, _ := p.token(ctx, "web", "team-b"); got != "team-b-2" {
+		t.Errorf("expected a token per namespace, got %q", got)
+	}
+	// Within tokenRefreshMargin of the expiry, a new token is minted.
+	now = now.Add(9*time.Minute + 30*time.Second)
+	if got, _ := p.token(ctx, "web", "team-a"); got != "team-a-3" {
+		t.Errorf("expected a refreshed token, got %q", got)
+	}
+
+	if _, err := p.token(ctx, "other", "team-a"); err == nil || !strings.Contains(err.Error(), "unknown token provider") {
+		t.Errorf("expected an unknown provider error, got %v", err)
+	}
+}
+
+func TestExecTokenMinter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokenprovider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "broker")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho '{\"token\": \"'$DODE_NAMESPACE'-'$1'\"}'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := parseTokenProviders("broker=exec:" + script + " secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.token(context.Background(), "broker", "team-a"); err != nil || got != "team-a-secret" {
+		t.Errorf("expected token from the command, got %q, %v", got, err)
+	}
+	if len(p.tokens) != 0 {
+		t.Errorf("expected tokens without expiry not to be cached")
+	}
+
+	p, _ = parseTokenProviders("broker=exec:" + filepath.Join(dir, "missing"))
+	if _, err := p.token(context.Background(), "broker", "team-a"); err == nil {
+		t.Errorf("expected an error for a missing command")
+	}
+}
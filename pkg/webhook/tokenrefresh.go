@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"k8s.io/klog"
+)
+
+// refreshingAPI reads the token Secret again, bypassing the secret cache,
+// when the DODE API rejects a token, and retries the call once if the Secret
+// holds a different token by now. Rotating the token in the Secret then
+// doesn't fail the challenges started with the old one. Later calls of the
+// same operation use the token read again right away.
+type refreshingAPI struct {
+	dodeAPI
+	refresh func() (string, error)
+
+	mu        sync.Mutex
+	rejected  string
+	refreshed string
+}
+
+// withTokenRefresh returns api, reading the token of cfg again for a
+// challenge in namespace if the API rejects it. Only tokens from Secrets are
+// read again; api is returned unchanged for every other config.
+func (c *dodeDNSProviderSolver) withTokenRefresh(api dodeAPI, cfg *dodeDNSProviderConfig, namespace string) dodeAPI {
+	if cfg.TokenProvider != "" || cfg.APITokenFile != "" || (cfg.APITokenSecretRef.Name == "" && len(cfg.APITokenSecretRefs) == 0 && cfg.UsernameSecretRef.Name == "") {
+		return api
+	}
+	fresh := *cfg
+	fresh.fresh = true
+	return &refreshingAPI{
+		dodeAPI: api,
+		refresh: func() (string, error) {
+			keys, err := c.getAPIKeys(&fresh, namespace, false)
+			if err != nil {
+				return "", err
+			}
+			return keys[0], nil
+		},
+	}
+}
+
+func (a *refreshingAPI) Present(ctx context.Context, token, domain, value string, ttl int) error {
+	return a.retry(token, func(token string) error {
+		return a.dodeAPI.Present(ctx, token, domain, value, ttl)
+	})
+}
+
+func (a *refreshingAPI) CleanUp(ctx context.Context, token, domain string) error {
+	return a.retry(token, func(token string) error {
+		return a.dodeAPI.CleanUp(ctx, token, domain)
+	})
+}
+
+func (a *refreshingAPI) retry(token string, call func(token string) error) error {
+	a.mu.Lock()
+	if token == a.rejected {
+		token = a.refreshed
+	}
+	a.mu.Unlock()
+
+	err := call(token)
+	if !dode.IsAuthError(err) {
+		return err
+	}
+	fresh, refreshErr := a.refresh()
+	if refreshErr != nil {
+		klog.Warningf("DODE API rejected the token and reading its Secret again failed: %v", refreshErr)
+		return err
+	}
+	if fresh == token {
+		return err
+	}
+	klog.Warningf("DODE API rejected the token, retrying with the token read again from its Secret: %v", err)
+	tokenRefreshes.Inc()
+	a.mu.Lock()
+	a.rejected, a.refreshed = token, fresh
+	a.mu.Unlock()
+	return call(fresh)
+}
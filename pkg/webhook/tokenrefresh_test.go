@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWithTokenRefresh(t *testing.T) {
+	api := newFakeDodeAPI("new")
+	defer api.Close()
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dode"},
+		Data:       map[string][]byte{"token": []byte("old")},
+	}
+	client := fake.NewSimpleClientset(sec)
+	c := newDodeDNSProviderSolver(client, dode.NewClient(dode.WithBaseURL(api.URL)))
+	cfg := &dodeDNSProviderConfig{}
+	cfg.APITokenSecretRef.Name = "dode"
+	ctx := context.Background()
+	const domain = "_acme-challenge.example.com"
+
+	// The Secret still holds the rejected token.
+	if err := c.withTokenRefresh(c.api, cfg, "default").Present(ctx, "old", domain, "key", defaultTTL); !dode.IsAuthError(err) {
+		t.Errorf("expected the rejection of the token, got %v", err)
+	}
+	if api.calls != 1 {
+		t.Errorf("expected no retry with the same token, got %d calls", api.calls)
+	}
+
+	sec.Data["token"] = []byte("new")
+	if _, err := client.CoreV1().Secrets("default").Update(ctx, sec, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	refreshing := c.withTokenRefresh(c.api, cfg, "default")
+	if err := refreshing.Present(ctx, "old", domain, "key", defaultTTL); err != nil {
+		t.Fatalf("expected the call to be retried with the new token, got %v", err)
+	}
+	if got := api.values(domain); !reflect.DeepEqual(got, []string{"key"}) {
+		t.Errorf("expected the record to be presented, got %q", got)
+	}
+	api.calls = 0
+	if err := refreshing.CleanUp(ctx, "old", domain); err != nil || api.calls != 1 {
+		t.Errorf("expected later calls to use the new token right away, got %v after %d calls", err, api.calls)
+	}
+
+	if got := c.withTokenRefresh(c.api, &dodeDNSProviderConfig{TokenProvider: "broker"}, "default"); got != c.api {
+		t.Errorf("expected only tokens from Secrets to be read again")
+	}
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// The webhook doesn't record traces itself, but with --dode.trace-context it
+// takes part in those of the systems around it through W3C Trace Context:
+// every Present and CleanUp gets a trace ID, which is sent in the
+// traceparent header of the DODE API requests made for it, so that a
+// tracing egress proxy or API gateway records them in that trace, and which
+// is logged in the result line and included in the Events and CloudEvents
+// about the operation. Copying the ID from any of them finds the others.
+
+// newTraceID returns a random W3C trace ID.
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceparent returns the traceparent header of a new span in the trace of
+// the operation carried by ctx, or "" if it has no trace ID.
+func traceparent(ctx context.Context) string {
+	r, ok := ctx.Value(challengeResultKey{}).(*ChallengeResult)
+	if !ok || r.TraceID == "" {
+		return ""
+	}
+	span := make([]byte, 8)
+	rand.Read(span)
+	return fmt.Sprintf("00-%s-%s-01", r.TraceID, hex.EncodeToString(span))
+}
+
+// traceTransport sets the traceparent header of requests made for an
+// operation with a trace ID.
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tp := traceparent(req.Context()); tp != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("traceparent", tp)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// traceSuffix returns the trace ID of r to append to Event messages, or ""
+// if it has none.
+func (r *ChallengeResult) traceSuffix() string {
+	if r.TraceID == "" {
+		return ""
+	}
+	return " (trace ID " + r.TraceID + ")"
+}
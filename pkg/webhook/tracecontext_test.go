@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTraceTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &traceTransport{base: http.DefaultTransport}}
+
+	res := &ChallengeResult{TraceID: newTraceID()}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req.WithContext(withChallengeResult(context.Background(), res)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !regexp.MustCompile(`^00-` + res.TraceID + `-[0-9a-f]{16}-01$`).MatchString(got) {
+		t.Errorf("expected a traceparent in the trace %s, got %q", res.TraceID, got)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Errorf("expected the original request not to be modified")
+	}
+
+	got = ""
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "" {
+		t.Errorf("expected no traceparent without a trace ID, got %q", got)
+	}
+}
+
+func TestChallengeResultTraceID(t *testing.T) {
+	res := &ChallengeResult{Action: "Present", Outcome: "error", ErrorClass: errorClassProvider, Error: "boom", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}
+	if s := res.String(); !strings.HasSuffix(s, " trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("expected the trace ID in the result line, got %q", s)
+	}
+	if got := res.traceSuffix(); got != " (trace ID 4bf92f3577b34da6a3ce929d0e0e4736)" {
+		t.Errorf("unexpected suffix %q", got)
+	}
+	if got := (&ChallengeResult{}).traceSuffix(); got != "" {
+		t.Errorf("expected no suffix without a trace ID, got %q", got)
+	}
+}
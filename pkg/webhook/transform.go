@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// maxTXTValueLength is the longest value a single TXT string can hold.
+const maxTXTValueLength = 255
+
+// valueTransformFuncs are the functions available to value transforms, on
+// top of those of text/template. Their last argument is the value, so that
+// they can be used in pipelines, e.g. {{.Value | truncate 32}}.
+var valueTransformFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"truncate": func(n int, s string) string {
+		if n >= 0 && len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	// sha256 is the unpadded base64url SHA-256 digest, the encoding of
+	// ACME challenge keys.
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	},
+}
+
+// valueTransformData is what value transforms are executed with. Value is
+// the output of the previous transform, or the key for the first one.
+type valueTransformData struct {
+	Key   string
+	Value string
+	FQDN  string
+	Zone  string
+}
+
+func parseValueTransform(transform string) (*template.Template, error) {
+	return template.New("valueTransform").Funcs(valueTransformFuncs).Parse(transform)
+}
+
+// transformValue returns the TXT value to present for key at fqdn in zone:
+// key itself, or the output of the last of transforms, each executed on the
+// output of the previous one. CleanUp derives the value the same way, so
+// that it deletes what Present created as long as the transforms are
+// unchanged.
+func transformValue(transforms []string, key, fqdn, zone string) (string, error) {
+	data := valueTransformData{
+		Key:   key,
+		Value: key,
+		FQDN:  normalizeName(fqdn),
+		Zone:  normalizeName(zone),
+	}
+	for i, transform := range transforms {
+		t, err := parseValueTransform(transform)
+		if err != nil {
+			return "", fmt.Errorf("valueTransforms[%d]: %v", i, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("valueTransforms[%d]: %v", i, err)
+		}
+		data.Value = strings.TrimSpace(b.String())
+	}
+	switch {
+	case data.Value == "":
+		return "", fmt.Errorf("valueTransforms produced an empty value")
+	case len(data.Value) > maxTXTValueLength:
+		return "", fmt.Errorf("valueTransforms produced a value of %d characters, more than the %d a TXT record holds", len(data.Value), maxTXTValueLength)
+	case strings.ContainsAny(data.Value, "\"\n"):
+		return "", fmt.Errorf("valueTransforms produced a value with quotes or line breaks")
+	}
+	return data.Value, nil
+}
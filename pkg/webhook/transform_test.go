@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformValue(t *testing.T) {
+	tests := []struct {
+		transforms []string
+		want       string
+	}{
+		{nil, "Key-Value"},
+		{[]string{"acme-{{.Value}}"}, "acme-Key-Value"},
+		{[]string{"{{.Value | lower | truncate 3}}", "{{.Value}}.{{.Zone}}"}, "key.example.com"},
+		{[]string{"{{.Value | replace \"-\" \"_\"}}", "{{.Value | trimPrefix \"Key\"}}"}, "_Value"},
+		{[]string{"{{sha256 .Key}}"}, "DJ492nT16sJCYupgpRum4UGiTuvpHDULwBgE6hNQet8"},
+		{[]string{"  {{.FQDN}}\n"}, "_acme-challenge.www.example.com"},
+	}
+	for _, test := range tests {
+		got, err := transformValue(test.transforms, "Key-Value", "_acme-challenge.www.example.com.", "example.com.")
+		if err != nil || got != test.want {
+			t.Errorf("transformValue(%q): expected %q, got %q, %v", test.transforms, test.want, got, err)
+		}
+	}
+}
+
+func TestTransformValueErrors(t *testing.T) {
+	for transform, want := range map[string]string{
+		"{{.Value":                       "valueTransforms[0]",
+		"{{.Missing}}":                   "valueTransforms[0]",
+		"{{if false}}x{{end}}":           "empty value",
+		`"{{.Value}}"`:                   "quotes",
+		strings.Repeat("{{.Value}}", 30): "more than the 255",
+	} {
+		_, err := transformValue([]string{transform}, "Key-Value", "_acme-challenge.example.com.", "example.com.")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("transformValue(%q): expected error mentioning %q, got %v", transform, want, err)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// vaultTimeout bounds the Vault calls made for a challenge.
+	vaultTimeout = 30 * time.Second
+	// vaultTokenEnv holds the Vault token used by apiTokenVaultRef with
+	// authMethod token.
+	vaultTokenEnv = "VAULT_TOKEN"
+	// serviceAccountTokenFile is the token of the webhook's service account
+	// sent to Vault's Kubernetes auth method.
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Vault auth methods of apiTokenVaultRef.
+const (
+	vaultAuthKubernetes = "kubernetes"
+	vaultAuthToken      = "token"
+)
+
+// vaultRef locates the API token in HashiCorp Vault.
+type vaultRef struct {
+	// Address is the URL of the Vault server. It must be listed in
+	// --dode.vault-addresses.
+	Address string `json:"address"`
+	// Path is the API path of the secret below /v1, e.g. secret/data/dode
+	// for a KV version 2 engine mounted at secret.
+	Path string `json:"path"`
+	// Key is the field of the secret holding the token. Defaults to token.
+	Key string `json:"key,omitempty"`
+	// AuthMethod is how the webhook logs in to Vault: kubernetes, the
+	// default, with its service account token, or token with the token in
+	// the VAULT_TOKEN environment variable of the webhook.
+	AuthMethod string `json:"authMethod,omitempty"`
+	// Role is the role of the Kubernetes auth method to log in with.
+	Role string `json:"role,omitempty"`
+	// AuthMountPath is the path the Kubernetes auth method is mounted at.
+	// Defaults to kubernetes.
+	AuthMountPath string `json:"authMountPath,omitempty"`
+}
+
+func (r *vaultRef) key() string {
+	if r.Key == "" {
+		return "token"
+	}
+	return r.Key
+}
+
+func (r *vaultRef) authMethod() string {
+	if r.AuthMethod == "" {
+		return vaultAuthKubernetes
+	}
+	return r.AuthMethod
+}
+
+func (r *vaultRef) authMountPath() string {
+	if r.AuthMountPath == "" {
+		return "kubernetes"
+	}
+	return strings.Trim(r.AuthMountPath, "/")
+}
+
+// vaultLogin identifies the Vault token of a login.
+type vaultLogin struct {
+	address, method, mount, role string
+}
+
+func (r *vaultRef) login() vaultLogin {
+	return vaultLogin{normalizeVaultAddress(r.Address), r.authMethod(), r.authMountPath(), r.Role}
+}
+
+// vaultNamespacePlaceholder stands for the namespace of a challenge in the
+// templates of --dode.vault-path-templates and --dode.vault-role-template.
+const vaultNamespacePlaceholder = "{namespace}"
+
+// vaultSecretKey identifies the lease of a secret read for the challenges of
+// a namespace.
+type vaultSecretKey struct {
+	namespace string
+	ref       vaultRef
+}
+
+// vaultLease is a value handed out by Vault for a limited time: the token of
+// a login or the API token of a secret read from a dynamic secrets engine.
+type vaultLease struct {
+	value     string
+	id        string
+	renewable bool
+	expires   time.Time
+}
+
+// valid reports whether l can still be used at now.
+func (l *vaultLease) valid(now time.Time) bool {
+	return l != nil && now.Add(tokenRefreshMargin).Before(l.expires)
+}
+
+// vaultTokens reads API tokens from Vault at challenge time, for
+// organizations keeping credentials out of Kubernetes Secrets. Solver
+// configs may only use the Vault servers the operator lists with
+// --dode.vault-addresses, as otherwise whoever may create Issuers could make
+// the webhook send its service account token to a server of their choosing.
+// As the webhook reads every secret with its own login, the paths and roles
+// solver configs may use are scoped to their namespace by templates set by
+// the operator as well, so that an Issuer can't read the token of another
+// namespace.
+//
+// The tokens of logins are kept until their lease is about to expire and
+// renewed then if Vault allows it, else the webhook logs in again. Secrets
+// with a lease, such as those of dynamic secrets engines minting short-lived
+// do.de tokens, are kept and renewed the same way; secrets without one, such
+// as those of the KV engines, are read for every challenge so that rotations
+// take effect right away.
+type vaultTokens struct {
+	addresses     map[string]bool
+	pathTemplates []string
+	roleTemplate  string
+	client        *http.Client
+	jwtFile       string
+	now           func() time.Time
+
+	mu      sync.Mutex
+	logins  map[vaultLogin]*vaultLease
+	secrets map[vaultSecretKey]*vaultLease
+}
+
+func newVaultTokens(addresses []string) *vaultTokens {
+	v := &vaultTokens{
+		addresses: map[string]bool{},
+		client:    egressClient(vaultTimeout),
+		jwtFile:   serviceAccountTokenFile,
+		now:       time.Now,
+		logins:    map[vaultLogin]*vaultLease{},
+		secrets:   map[vaultSecretKey]*vaultLease{},
+	}
+	for _, a := range addresses {
+		v.addresses[normalizeVaultAddress(a)] = true
+	}
+	return v
+}
+
+// parseVaultAddresses parses comma separated https URLs of Vault servers.
+func parseVaultAddresses(s string) ([]string, error) {
+	var addresses []string
+	for _, a := range strings.Split(s, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if err := validateAPIURL(a); err != nil {
+			return nil, fmt.Errorf("Vault address %v", err)
+		}
+		addresses = append(addresses, normalizeVaultAddress(a))
+	}
+	return addresses, nil
+}
+
+func normalizeVaultAddress(a string) string {
+	return strings.TrimRight(strings.TrimSpace(a), "/")
+}
+
+// scope restricts the secrets solver configs may read to the comma separated
+// path templates, and their roles to roleTemplate if it is set. Each
+// template must contain {namespace}.
+func (v *vaultTokens) scope(pathTemplates, roleTemplate string) error {
+	var templates []string
+	for _, t := range strings.Split(pathTemplates, ",") {
+		if t = strings.Trim(strings.TrimSpace(t), "/"); t == "" {
+			continue
+		}
+		if !strings.Contains(t, vaultNamespacePlaceholder) {
+			return fmt.Errorf("--%svault-path-templates: %q doesn't contain %s", flagPrefix, t, vaultNamespacePlaceholder)
+		}
+		templates = append(templates, t)
+	}
+	if len(templates) == 0 {
+		return fmt.Errorf("--%svault-addresses needs --%svault-path-templates to keep Issuers from reading the tokens of other namespaces", flagPrefix, flagPrefix)
+	}
+	if roleTemplate != "" && !strings.Contains(roleTemplate, vaultNamespacePlaceholder) {
+		return fmt.Errorf("--%svault-role-template: %q doesn't contain %s", flagPrefix, roleTemplate, vaultNamespacePlaceholder)
+	}
+	v.pathTemplates, v.roleTemplate = templates, roleTemplate
+	return nil
+}
+
+// checkScope returns an error unless the challenges of namespace may use
+// ref: its path must be that of one of the path templates for namespace or
+// lie below it, and its role that of the role template, if any.
+func (v *vaultTokens) checkScope(ref *vaultRef, namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("apiTokenVaultRef can't be used without the namespace of the challenge")
+	}
+	path := strings.Trim(ref.Path, "/")
+	if strings.ContainsAny(path, "%?#\\") {
+		return fmt.Errorf("Vault path %q must not contain %%, ?, # or \\", ref.Path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("Vault path %q must not contain empty, . or .. segments", ref.Path)
+		}
+	}
+	allowed := false
+	for _, t := range v.pathTemplates {
+		base := strings.ReplaceAll(t, vaultNamespacePlaceholder, namespace)
+		if path == base || strings.HasPrefix(path, base+"/") {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("Vault path %q may not be used by namespace %q, it must match --%svault-path-templates", ref.Path, namespace, flagPrefix)
+	}
+	if v.roleTemplate != "" && ref.authMethod() == vaultAuthKubernetes {
+		if role := strings.ReplaceAll(v.roleTemplate, vaultNamespacePlaceholder, namespace); ref.Role != role {
+			return fmt.Errorf("Vault role %q may not be used by namespace %q, expected %q", ref.Role, namespace, role)
+		}
+	}
+	return nil
+}
+
+// urls returns the addresses of the Vault servers.
+func (v *vaultTokens) urls() []string {
+	if v == nil {
+		return nil
+	}
+	var urls []string
+	for a := range v.addresses {
+		urls = append(urls, a)
+	}
+	return urls
+}
+
+// token returns the API token of ref for the challenges of namespace, using
+// the lease of an earlier read if it's still valid or can be renewed.
+func (v *vaultTokens) token(ctx context.Context, ref *vaultRef, namespace string) (string, error) {
+	if v == nil {
+		return "", classify(errorClassConfig, fmt.Errorf("apiTokenVaultRef can't be used, Vault must be enabled with --dode.vault-addresses"))
+	}
+	if !v.addresses[normalizeVaultAddress(ref.Address)] {
+		return "", classify(errorClassConfig, fmt.Errorf("Vault address %q is not listed in --dode.vault-addresses", ref.Address))
+	}
+	if err := v.checkScope(ref, namespace); err != nil {
+		return "", classify(errorClassConfig, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	key := vaultSecretKey{namespace: namespace, ref: *ref}
+	v.mu.Lock()
+	lease := v.secrets[key]
+	v.mu.Unlock()
+	if lease.valid(v.now()) {
+		return lease.value, nil
+	}
+	if lease != nil && lease.renewable {
+		renewed, err := v.renewSecret(ctx, key, lease)
+		if err == nil {
+			return renewed.value, nil
+		}
+		klog.Warningf("renewing the lease of Vault secret %s failed, reading it again: %v", ref.Path, err)
+	}
+
+	lease, err := v.readSecret(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("reading Vault secret %s: %w", ref.Path, err)
+	}
+	return lease.value, nil
+}
+
+// readSecret reads the secret of key, logging in again once if Vault denies
+// access with the token of an earlier login, e.g. because it was revoked.
+func (v *vaultTokens) readSecret(ctx context.Context, key vaultSecretKey) (*vaultLease, error) {
+	ref := &key.ref
+	token, cached, err := v.loginToken(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var resp vaultResponse
+	err = v.do(ctx, http.MethodGet, ref.Address, ref.Path, token, nil, &resp)
+	if isVaultPermissionDenied(err) && cached {
+		v.forgetLogin(ref.login())
+		if token, _, err = v.loginToken(ctx, ref); err != nil {
+			return nil, err
+		}
+		err = v.do(ctx, http.MethodGet, ref.Address, ref.Path, token, nil, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, ok := vaultSecretValue(resp.Data, ref.key())
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", ref.key())
+	}
+	lease := &vaultLease{value: value, id: resp.LeaseID, renewable: resp.Renewable, expires: v.expiry(resp.LeaseDuration)}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if resp.LeaseID == "" || resp.LeaseDuration <= 0 {
+		delete(v.secrets, key)
+	} else {
+		v.secrets[key] = lease
+	}
+	return lease, nil
+}
+
+// renewSecret extends the lease of the secret of key.
+func (v *vaultTokens) renewSecret(ctx context.Context, key vaultSecretKey, lease *vaultLease) (*vaultLease, error) {
+	ref := &key.ref
+	token, _, err := v.loginToken(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var resp vaultResponse
+	if err := v.do(ctx, http.MethodPut, ref.Address, "sys/leases/renew", token, map[string]string{"lease_id": lease.id}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.LeaseDuration <= 0 {
+		return nil, fmt.Errorf("lease %s was not extended", lease.id)
+	}
+	renewed := &vaultLease{value: lease.value, id: lease.id, renewable: resp.Renewable, expires: v.expiry(resp.LeaseDuration)}
+	v.mu.Lock()
+	v.secrets[key] = renewed
+	v.mu.Unlock()
+	klog.V(4).Infof("renewed the lease of Vault secret %s until %s", ref.Path, renewed.expires.Format(time.RFC3339))
+	return renewed, nil
+}
+
+// loginToken returns the Vault token to read the secret of ref with, and
+// whether it is that of an earlier login.
+func (v *vaultTokens) loginToken(ctx context.Context, ref *vaultRef) (string, bool, error) {
+	if ref.authMethod() == vaultAuthToken {
+		token := os.Getenv(vaultTokenEnv)
+		if token == "" {
+			return "", false, classify(errorClassConfig, fmt.Errorf("authMethod %s needs a Vault token in %s", vaultAuthToken, vaultTokenEnv))
+		}
+		return token, false, nil
+	}
+
+	key := ref.login()
+	v.mu.Lock()
+	login := v.logins[key]
+	v.mu.Unlock()
+	if login.valid(v.now()) {
+		return login.value, true, nil
+	}
+	if login != nil && login.renewable {
+		var resp vaultResponse
+		err := v.do(ctx, http.MethodPost, ref.Address, "auth/token/renew-self", login.value, nil, &resp)
+		if err == nil && resp.Auth != nil && resp.Auth.LeaseDuration > 0 {
+			renewed := &vaultLease{value: login.value, renewable: resp.Auth.Renewable, expires: v.expiry(resp.Auth.LeaseDuration)}
+			v.mu.Lock()
+			v.logins[key] = renewed
+			v.mu.Unlock()
+			return renewed.value, true, nil
+		}
+		klog.V(4).Infof("renewing the Vault token of role %s failed, logging in again: %v", ref.Role, err)
+	}
+
+	jwt, err := ioutil.ReadFile(v.jwtFile)
+	if err != nil {
+		return "", false, fmt.Errorf("reading the service account token: %v", err)
+	}
+	var resp vaultResponse
+	body := map[string]string{"role": ref.Role, "jwt": strings.TrimSpace(string(jwt))}
+	if err := v.do(ctx, http.MethodPost, ref.Address, "auth/"+ref.authMountPath()+"/login", "", body, &resp); err != nil {
+		return "", false, fmt.Errorf("logging in to Vault with role %s: %v", ref.Role, err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", false, fmt.Errorf("logging in to Vault with role %s: no token returned", ref.Role)
+	}
+	login = &vaultLease{value: resp.Auth.ClientToken, renewable: resp.Auth.Renewable, expires: v.expiry(resp.Auth.LeaseDuration)}
+	v.mu.Lock()
+	v.logins[key] = login
+	v.mu.Unlock()
+	return login.value, false, nil
+}
+
+func (v *vaultTokens) forgetLogin(key vaultLogin) {
+	v.mu.Lock()
+	delete(v.logins, key)
+	v.mu.Unlock()
+}
+
+// expiry returns when a lease of seconds handed out now expires. Leases of
+// tokens without a TTL, e.g. root tokens, never do.
+func (v *vaultTokens) expiry(seconds int) time.Time {
+	if seconds <= 0 {
+		return time.Unix(1<<62, 0)
+	}
+	return v.now().Add(time.Duration(seconds) * time.Second)
+}
+
+// vaultResponse is the envelope of Vault API responses.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// vaultError is an error status returned by Vault.
+type vaultError struct {
+	statusCode int
+	errors     []string
+}
+
+func (e *vaultError) Error() string {
+	if len(e.errors) == 0 {
+		return fmt.Sprintf("Vault returned status %d", e.statusCode)
+	}
+	return fmt.Sprintf("Vault returned status %d: %s", e.statusCode, strings.Join(e.errors, "; "))
+}
+
+func isVaultPermissionDenied(err error) bool {
+	var e *vaultError
+	return errors.As(err, &e) && e.statusCode == http.StatusForbidden
+}
+
+// do calls the Vault API at path below /v1 of address with token, if set,
+// sending body as JSON and decoding the response into out.
+func (v *vaultTokens) do(ctx context.Context, method, address, path, token string, body interface{}, out *vaultResponse) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, normalizeVaultAddress(address)+"/v1/"+strings.TrimLeft(path, "/"), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&e)
+		return &vaultError{statusCode: resp.StatusCode, errors: e.Errors}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding Vault response: %v", err)
+	}
+	return nil
+}
+
+// vaultSecretValue returns the string at key of the data of a secret, which
+// KV version 2 engines nest below another data field.
+func vaultSecretValue(data map[string]interface{}, key string) (string, bool) {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if s, ok := nested[key].(string); ok && s != "" {
+			return s, true
+		}
+	}
+	s, ok := data[key].(string)
+	return s, ok && s != ""
+}
@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault answers Kubernetes auth logins for the role webhook with the JWT
+// jwt, KV version 2 reads of secret/data/team-a/dode and reads of
+// dode/creds/team-a, a dynamic secret with a renewable lease.
+type fakeVault struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	logins   int
+	reads    int
+	renewals int
+	revoked  map[string]bool
+}
+
+func newFakeVault(jwt string) *fakeVault {
+	f := &fakeVault{revoked: map[string]bool{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		token := r.Header.Get("X-Vault-Token")
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			if body["role"] != "webhook" || body["jwt"] != jwt {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":["permission denied"]}`)
+				return
+			}
+			f.logins++
+			fmt.Fprintf(w, `{"auth":{"client_token":"vault-%d","lease_duration":3600,"renewable":true}}`, f.logins)
+			return
+		case "/v1/sys/leases/renew":
+			f.renewals++
+			fmt.Fprintf(w, `{"lease_id":%q,"lease_duration":600,"renewable":true}`, body["lease_id"])
+			return
+		}
+		if !strings.HasPrefix(token, "vault-") || f.revoked[token] {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		f.reads++
+		switch r.URL.Path {
+		case "/v1/secret/data/team-a/dode":
+			fmt.Fprintf(w, `{"data":{"data":{"token":"kv-%d"},"metadata":{"version":1}}}`, f.reads)
+		case "/v1/dode/creds/team-a":
+			fmt.Fprintf(w, `{"lease_id":"dode/creds/team-a/1","lease_duration":600,"renewable":true,"data":{"token":"dynamic-%d"}}`, f.reads)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	return f
+}
+
+// newTestVaultTokens returns vaultTokens for f logging in with jwt, which is
+// written to a file in dir, scoped to secret/data/{namespace} and
+// dode/creds/{namespace}.
+func newTestVaultTokens(t *testing.T, f *fakeVault, dir, jwt string) *vaultTokens {
+	jwtFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(jwtFile, []byte(jwt+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := newVaultTokens([]string{f.URL + "/"})
+	if err := v.scope("secret/data/{namespace}, dode/creds/{namespace}", ""); err != nil {
+		t.Fatal(err)
+	}
+	v.jwtFile = jwtFile
+	return v
+}
+
+func TestVaultTokensReadKVForEveryChallenge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := newFakeVault("jwt")
+	defer f.Close()
+	v := newTestVaultTokens(t, f, dir, "jwt")
+	ref := &vaultRef{Address: f.URL, Path: "secret/data/team-a/dode", Role: "webhook"}
+	ctx := context.Background()
+
+	for _, want := range []string{"kv-1", "kv-2"} {
+		if got, err := v.token(ctx, ref, "team-a"); err != nil || got != want {
+			t.Errorf("expected %q, got %q, %v", want, got, err)
+		}
+	}
+	if f.logins != 1 {
+		t.Errorf("expected the login to be reused, got %d logins", f.logins)
+	}
+
+	// A login Vault no longer accepts is replaced once.
+	f.revoked["vault-1"] = true
+	if got, err := v.token(ctx, ref, "team-a"); err != nil || got != "kv-3" {
+		t.Errorf("expected a read after logging in again, got %q, %v", got, err)
+	}
+	if f.logins != 2 {
+		t.Errorf("expected a second login, got %d logins", f.logins)
+	}
+
+	missing := &vaultRef{Address: f.URL, Path: "secret/data/team-a/dode", Key: "other", Role: "webhook"}
+	if _, err := v.token(ctx, missing, "team-a"); err == nil || !strings.Contains(err.Error(), `key "other" not found`) {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+	denied := &vaultRef{Address: f.URL, Path: "secret/data/team-a/dode", Role: "other"}
+	if _, err := v.token(ctx, denied, "team-a"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the login to be denied, got %v", err)
+	}
+}
+
+func TestVaultTokensRenewLeases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := newFakeVault("jwt")
+	defer f.Close()
+	v := newTestVaultTokens(t, f, dir, "jwt")
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+	ref := &vaultRef{Address: f.URL, Path: "dode/creds/team-a", Role: "webhook"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if got, err := v.token(ctx, ref, "team-a"); err != nil || got != "dynamic-1" {
+			t.Errorf("expected the leased token, got %q, %v", got, err)
+		}
+	}
+	// Within tokenRefreshMargin of the expiry, the lease is renewed.
+	now = now.Add(9*time.Minute + 30*time.Second)
+	if got, err := v.token(ctx, ref, "team-a"); err != nil || got != "dynamic-1" {
+		t.Errorf("expected the renewed token, got %q, %v", got, err)
+	}
+	if f.reads != 1 || f.renewals != 1 {
+		t.Errorf("expected 1 read and 1 renewal, got %d and %d", f.reads, f.renewals)
+	}
+	if got := v.secrets[vaultSecretKey{namespace: "team-a", ref: *ref}].expires; !got.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("expected the lease to be extended, expires %v", got)
+	}
+}
+
+func TestVaultTokensRefuseUnlistedAddresses(t *testing.T) {
+	ref := &vaultRef{Address: "https://vault.attacker.example", Path: "secret/data/team-a/dode", Role: "webhook"}
+	var none *vaultTokens
+	if _, err := none.token(context.Background(), ref, "team-a"); err == nil || errorClass(err) != errorClassConfig {
+		t.Errorf("expected a config error without --dode.vault-addresses, got %v", err)
+	}
+	v := newVaultTokens([]string{"https://vault.example.com"})
+	if _, err := v.token(context.Background(), ref, "team-a"); err == nil || errorClass(err) != errorClassConfig {
+		t.Errorf("expected a config error for an unlisted address, got %v", err)
+	}
+
+	if _, err := parseVaultAddresses("https://vault.example.com, http://vault.example.com"); err == nil {
+		t.Error("expected an error for an http address")
+	}
+}
+
+func TestVaultTokensScopedToNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := newFakeVault("jwt")
+	defer f.Close()
+	v := newTestVaultTokens(t, f, dir, "jwt")
+	ctx := context.Background()
+
+	ref := &vaultRef{Address: f.URL, Path: "secret/data/team-a/dode", Role: "webhook"}
+	if _, err := v.token(ctx, ref, "team-a"); err != nil {
+		t.Fatalf("expected team-a to read its own token, got %v", err)
+	}
+	for _, path := range []string{
+		"secret/data/team-a/dode",
+		"secret/data/team-b/../team-a/dode",
+		"secret/data/team-b/%2e%2e/team-a/dode",
+		"secret/data/team-a",
+		"secret/data/team-bb/dode",
+		"dode/creds/team-a",
+	} {
+		ref := &vaultRef{Address: f.URL, Path: path, Role: "webhook"}
+		if _, err := v.token(ctx, ref, "team-b"); err == nil || errorClass(err) != errorClassConfig {
+			t.Errorf("expected team-b to be refused %s, got %v", path, err)
+		}
+	}
+	if f.logins != 1 || f.reads != 1 {
+		t.Errorf("expected no Vault calls for refused paths, got %d logins and %d reads", f.logins, f.reads)
+	}
+
+	// Leases are kept per namespace.
+	ref = &vaultRef{Address: f.URL, Path: "dode/creds/team-a", Role: "webhook"}
+	if _, err := v.token(ctx, ref, "team-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.secrets[vaultSecretKey{namespace: "team-a", ref: *ref}]; !ok || len(v.secrets) != 1 {
+		t.Errorf("expected the lease to be kept for team-a only, got %v", v.secrets)
+	}
+
+	if err := v.scope("secret/data/{namespace}", "dode-{namespace}"); err != nil {
+		t.Fatal(err)
+	}
+	ref = &vaultRef{Address: f.URL, Path: "secret/data/team-a/dode", Role: "dode-team-b"}
+	if _, err := v.token(ctx, ref, "team-a"); err == nil || errorClass(err) != errorClassConfig {
+		t.Errorf("expected the role of another namespace to be refused, got %v", err)
+	}
+}
+
+func TestVaultTokensScope(t *testing.T) {
+	for _, test := range []struct {
+		paths, role string
+	}{
+		{"", ""},
+		{"secret/data/dode", ""},
+		{"secret/data/{namespace}", "webhook"},
+	} {
+		if err := newVaultTokens(nil).scope(test.paths, test.role); err == nil {
+			t.Errorf("expected path templates %q and role template %q to be refused", test.paths, test.role)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog"
+)
+
+// certManagerGroup is the API group of cert-manager's own resources.
+const certManagerGroup = "cert-manager.io"
+
+// supportedCertManagerVersions are the versions of the cert-manager.io API
+// served by the cert-manager releases this webhook is built and tested
+// against (v1.x). The ChallengeRequest payload the webhook receives has
+// been compatible across all of them.
+var supportedCertManagerVersions = []string{"v1alpha2", "v1alpha3", "v1beta1", "v1"}
+
+// checkCertManagerVersion logs a warning for every sign that the cert-manager
+// deployed in the cluster is older or newer than what the webhook supports.
+func checkCertManagerVersion(d discovery.DiscoveryInterface) {
+	groups, err := d.ServerGroups()
+	if err != nil {
+		klog.Warningf("Unable to discover the cert-manager version in the cluster: %v", err)
+		return
+	}
+	for _, w := range certManagerVersionSkew(groups) {
+		klog.Warning(w)
+	}
+}
+
+// certManagerVersionSkew returns warnings describing how the cert-manager.io
+// API versions in groups differ from supportedCertManagerVersions.
+func certManagerVersionSkew(groups *metav1.APIGroupList) []string {
+	var served []string
+	for _, g := range groups.Groups {
+		if g.Name != certManagerGroup {
+			continue
+		}
+		for _, v := range g.Versions {
+			served = append(served, v.Version)
+		}
+	}
+	if len(served) == 0 {
+		return []string{fmt.Sprintf("API group %s is not served, is cert-manager installed?", certManagerGroup)}
+	}
+
+	var warnings []string
+	if !containsString(served, "v1") {
+		warnings = append(warnings, fmt.Sprintf("cert-manager in the cluster serves %s %s only and is older than "+
+			"v1.0, which this webhook requires", certManagerGroup, strings.Join(served, ", ")))
+	}
+	for _, v := range served {
+		if !containsString(supportedCertManagerVersions, v) {
+			warnings = append(warnings, fmt.Sprintf("cert-manager in the cluster serves %s/%s, which is newer than "+
+				"this webhook supports; ChallengeRequest payloads may have changed", certManagerGroup, v))
+		}
+	}
+	return warnings
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCertManagerVersionSkew(t *testing.T) {
+	groups := func(versions ...string) *metav1.APIGroupList {
+		g := metav1.APIGroup{Name: certManagerGroup}
+		for _, v := range versions {
+			g.Versions = append(g.Versions, metav1.GroupVersionForDiscovery{GroupVersion: certManagerGroup + "/" + v, Version: v})
+		}
+		return &metav1.APIGroupList{Groups: []metav1.APIGroup{{Name: "apps"}, g}}
+	}
+
+	tests := map[string]struct {
+		groups   *metav1.APIGroupList
+		warnings int
+	}{
+		"supported":     {groups: groups("v1alpha2", "v1alpha3", "v1beta1", "v1")},
+		"v1 only":       {groups: groups("v1")},
+		"not installed": {groups: &metav1.APIGroupList{}, warnings: 1},
+		"older":         {groups: groups("v1alpha2"), warnings: 1},
+		"newer":         {groups: groups("v1", "v2"), warnings: 1},
+	}
+	for name, test := range tests {
+		if w := certManagerVersionSkew(test.groups); len(w) != test.warnings {
+			t.Errorf("%s: expected %d warnings, got %q", name, test.warnings, w)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog"
+)
+
+// recordWatchdog periodically checks that the records of challenges between
+// Present and CleanUp are still served, and presents them again if not, for
+// zones managed by tools that prune records they don't know about. A record
+// counts as deleted only if none of the zone's nameservers serve it, so that
+// secondaries lagging behind don't trigger a new API call, and rounds in
+// which a nameserver can't be asked are skipped.
+type recordWatchdog struct {
+	mu      sync.Mutex
+	watches map[challengeKey]*recordWatch
+}
+
+// recordWatch is the watch of a single challenge.
+type recordWatch struct {
+	cancel context.CancelFunc
+}
+
+func newRecordWatchdog() *recordWatchdog {
+	return &recordWatchdog{watches: map[challengeKey]*recordWatch{}}
+}
+
+// watch calls check every interval, and present if check reports the record
+// of the challenge with key at fqdn missing, until stop is called for it or
+// check returns errStopWatching. Watching a challenge again replaces the
+// earlier watch.
+func (w *recordWatchdog) watch(fqdn, key string, interval time.Duration, check func(ctx context.Context) (bool, error), present func(ctx context.Context) error) {
+	k := challengeKey{normalizeName(fqdn), key}
+	ctx, cancel := context.WithCancel(context.Background())
+	rw := &recordWatch{cancel: cancel}
+	w.mu.Lock()
+	if old, ok := w.watches[k]; ok {
+		old.cancel()
+	}
+	w.watches[k] = rw
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !w.round(ctx, fqdn, check, present) {
+				w.forget(k, rw)
+				return
+			}
+		}
+	}()
+}
+
+// round checks the record once, presenting it again if it's missing, and
+// reports whether to keep watching it.
+func (w *recordWatchdog) round(ctx context.Context, fqdn string, check func(ctx context.Context) (bool, error), present func(ctx context.Context) error) bool {
+	ctx, cancel := context.WithTimeout(ctx, dode.DefaultTimeout)
+	defer cancel()
+	served, err := check(ctx)
+	if err == errStopWatching {
+		return false
+	}
+	if err != nil {
+		klog.V(4).Infof("watchdog skipped checking the TXT record at %s: %v", fqdn, err)
+		return true
+	}
+	if served || ctx.Err() != nil {
+		return true
+	}
+	klog.Warningf("TXT record at %s was deleted before the challenge was cleaned up, presenting it again", fqdn)
+	err = present(ctx)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	watchdogRepresents.WithLabelValues(result).Inc()
+	if err != nil {
+		klog.Errorf("Failed to present the deleted TXT record at %s again: %v", fqdn, err)
+	}
+	return true
+}
+
+// stop ends the watch of key at fqdn, once the challenge is cleaned up.
+func (w *recordWatchdog) stop(fqdn, key string) {
+	k := challengeKey{normalizeName(fqdn), key}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if rw, ok := w.watches[k]; ok {
+		rw.cancel()
+		delete(w.watches, k)
+	}
+}
+
+// forget ends rw, the watch of k, and drops it unless it was replaced
+// meanwhile.
+func (w *recordWatchdog) forget(k challengeKey, rw *recordWatch) {
+	rw.cancel()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watches[k] == rw {
+		delete(w.watches, k)
+	}
+}
+
+// errStopWatching is returned by the check of a watch whose challenge no
+// longer has a record, e.g. because it was pruned or given up on.
+var errStopWatching = errors.New("record no longer tracked")
+
+// watchRecord starts the watchdog for the record of ch with value, presented
+// at domain and served at fqdn in zone, if cfg enables it.
+func (c *dodeDNSProviderSolver) watchRecord(cfg *dodeDNSProviderConfig, ch *v1alpha1.ChallengeRequest, api dodeAPI, token, zone, fqdn, domain, value string) {
+	if cfg.WatchdogIntervalSeconds <= 0 || cfg.DryRun {
+		return
+	}
+	check := func(ctx context.Context) (bool, error) {
+		if !c.ledger.has(domain, value) {
+			return false, errStopWatching
+		}
+		checkers, err := c.nameservers.checkers(ctx, zone)
+		if err != nil {
+			return false, err
+		}
+		for _, checker := range checkers {
+			ok, err := checker.Check(ctx, fqdn, value)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	present := func(ctx context.Context) error {
+		c.records.invalidate(domain)
+		return c.addRecord(ctx, api, token, zone, domain, value, cfg.TTL, 0)
+	}
+	c.watchdog.watch(ch.ResolvedFQDN, ch.Key, seconds(cfg.WatchdogIntervalSeconds), check, present)
+}
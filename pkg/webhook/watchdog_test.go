@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordWatchdogPresentsDeletedRecords(t *testing.T) {
+	w := newRecordWatchdog()
+	var (
+		mu       sync.Mutex
+		rounds   int
+		presents int
+	)
+	done := make(chan struct{})
+	check := func(ctx context.Context) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		rounds++
+		switch rounds {
+		case 1:
+			return true, nil
+		case 2:
+			return false, errors.New("nameserver unreachable")
+		case 3:
+			return false, nil
+		default:
+			close(done)
+			return false, errStopWatching
+		}
+	}
+	present := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		presents++
+		return nil
+	}
+	w.watch("_acme-challenge.example.com.", "key", time.Millisecond, check, present)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch didn't end")
+	}
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if presents != 1 || rounds != 4 {
+		t.Errorf("expected 1 record presented again in 4 rounds, got %d in %d", presents, rounds)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.watches) != 0 {
+		t.Errorf("expected the watch to be dropped, got %v", w.watches)
+	}
+}
+
+func TestRecordWatchdogStop(t *testing.T) {
+	w := newRecordWatchdog()
+	checked := make(chan struct{}, 100)
+	check := func(ctx context.Context) (bool, error) {
+		checked <- struct{}{}
+		return true, nil
+	}
+	present := func(ctx context.Context) error { return nil }
+	w.watch("_acme-challenge.example.com", "key", time.Millisecond, check, present)
+	// Watching the challenge again replaces the earlier watch.
+	w.watch("_acme-challenge.example.com.", "key", time.Millisecond, check, present)
+	<-checked
+	w.mu.Lock()
+	if len(w.watches) != 1 {
+		t.Errorf("expected a single watch, got %d", len(w.watches))
+	}
+	w.mu.Unlock()
+
+	w.stop("_acme-challenge.example.com", "key")
+	time.Sleep(10 * time.Millisecond)
+	for len(checked) > 0 {
+		<-checked
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(checked) != 0 {
+		t.Errorf("expected no checks after stopping the watch")
+	}
+}
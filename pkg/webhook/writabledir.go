@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"os"
+
+	"k8s.io/klog"
+)
+
+// probeWritableDir returns dir if files can be created in it, and "" after
+// logging why otherwise. The webhook must work with a read-only root
+// filesystem, so every feature writing files has to cope with "" by keeping
+// its data in memory or on stderr only.
+func probeWritableDir(dir string) string {
+	if dir == "" {
+		klog.Infof("no writable directory configured, files will not be written")
+		return ""
+	}
+	f, err := ioutil.TempFile(dir, ".probe-")
+	if err != nil {
+		klog.Warningf("directory %s is not writable, files such as crash audit trails will not be written: %v. "+
+			"With a read-only root filesystem, mount an emptyDir volume there or point --%swritable-dir at one.", dir, err, flagPrefix)
+		return ""
+	}
+	f.Close()
+	os.Remove(f.Name())
+	klog.V(2).Infof("writing files to %s", dir)
+	return dir
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deveshk0/cert-manager-webhook-dode/pkg/dode"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Strategies for deriving the domain parameter sent to the DODE API.
+const (
+	// domainStrategyFQDN sends the challenge FQDN without its trailing
+	// dot, e.g. _acme-challenge.www.example.com.
+	domainStrategyFQDN = "fqdn"
+	// domainStrategyRegistrable sends the registrable domain of the
+	// challenge FQDN, e.g. example.com or example.co.uk.
+	domainStrategyRegistrable = "registrable"
+	// domainStrategyZone sends the zone cert-manager resolved for the
+	// challenge.
+	domainStrategyZone = "zone"
+)
+
+var domainStrategies = []string{domainStrategyFQDN, domainStrategyRegistrable, domainStrategyZone}
+
+// acmeChallengeLabel is the label DNS-01 challenge records are placed below.
+const acmeChallengeLabel = "_acme-challenge"
+
+// checkFQDNInZone returns an error if fqdn is not zone itself or a name
+// below it. Such a mismatch usually means the issuer is misconfigured or
+// cert-manager followed a CNAME into a zone this solver doesn't expect.
+func checkFQDNInZone(fqdn, zone string) error {
+	f := normalizeName(fqdn)
+	z := normalizeName(zone)
+	if z == "" || f == z || strings.HasSuffix(f, "."+z) {
+		return nil
+	}
+	return fmt.Errorf("challenge record %q is not inside resolved zone %q; check the issuer's solver selector "+
+		"and any CNAME pointing _acme-challenge records into another zone", fqdn, zone)
+}
+
+// checkConfigZones returns an error unless dnsName, the name a challenge
+// is for, is one of zones or a name below them. Issuers with several dode
+// solvers pick the config by the solvers' selectors, so a name outside the
+// config's zones means the selectors route it to the wrong config.
+func checkConfigZones(zones []string, dnsName string) error {
+	if len(zones) == 0 {
+		return nil
+	}
+	name := normalizeName(strings.TrimPrefix(dnsName, "*."))
+	for _, z := range zones {
+		z = normalizeName(z)
+		if name == z || strings.HasSuffix(name, "."+z) {
+			return nil
+		}
+	}
+	return fmt.Errorf("challenge for %q was routed to a solver config for zones %q; the solver's selector "+
+		"(dnsZones, dnsNames or matchLabels) must only match names in its zones, check the order and selectors "+
+		"of the issuer's solvers", dnsName, zones)
+}
+
+// challengeRecord returns the name of the TXT record presenting ch and the
+// zone it is in: the ones cert-manager resolved, or
+// _acme-challenge.<challengeAliasDomain> in the alias domain for configs
+// delegating validation to a zone at do.de the _acme-challenge record of
+// the domain is a CNAME to.
+func challengeRecord(cfg *dodeDNSProviderConfig, ch *v1alpha1.ChallengeRequest) (fqdn, zone string) {
+	if cfg.ChallengeAliasDomain == "" {
+		return ch.ResolvedFQDN, ch.ResolvedZone
+	}
+	zone = normalizeName(cfg.ChallengeAliasDomain) + "."
+	return acmeChallengeLabel + "." + zone, zone
+}
+
+// normalizeName lower-cases name and strips its trailing dot.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// apiDomain returns the domain parameter the DODE API is called with for the
+// challenge record fqdn in zone. Some accounts expect other names than the
+// FQDN of the record, which strategy selects between.
+func apiDomain(strategy, fqdn, zone string) (string, error) {
+	switch strategy {
+	case "", domainStrategyFQDN:
+		return dode.Domain(fqdn), nil
+	case domainStrategyRegistrable:
+		d, err := publicsuffix.EffectiveTLDPlusOne(normalizeName(fqdn))
+		if err != nil {
+			return "", fmt.Errorf("unable to determine the registrable domain of %q: %v", fqdn, err)
+		}
+		return d, nil
+	case domainStrategyZone:
+		if zone == "" {
+			return "", fmt.Errorf("no resolved zone for %q", fqdn)
+		}
+		return dode.Domain(zone), nil
+	}
+	return "", fmt.Errorf("unknown domain strategy %q", strategy)
+}
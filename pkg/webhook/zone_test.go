@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestCheckFQDNInZone(t *testing.T) {
+	tests := []struct {
+		fqdn, zone string
+		ok         bool
+	}{
+		{"_acme-challenge.example.com.", "example.com.", true},
+		{"_acme-challenge.sub.Example.com.", "example.COM.", true},
+		{"_acme-challenge.example.com", "example.com.", true},
+		{"example.com.", "example.com.", true},
+		{"_acme-challenge.example.com.", "", true},
+		{"_acme-challenge.example.com.", "ample.com.", false},
+		{"_acme-challenge.example.com.", "example.org.", false},
+	}
+	for _, test := range tests {
+		if err := checkFQDNInZone(test.fqdn, test.zone); (err == nil) != test.ok {
+			t.Errorf("%q in %q: unexpected result %v", test.fqdn, test.zone, err)
+		}
+	}
+}
+
+func TestCheckConfigZones(t *testing.T) {
+	zones := []string{"example.com", "Shop.example.org."}
+	tests := []struct {
+		dnsName string
+		ok      bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"*.example.com", true},
+		{"eu.shop.example.org", true},
+		{"example.org", false},
+		{"notexample.com", false},
+	}
+	for _, test := range tests {
+		if err := checkConfigZones(zones, test.dnsName); (err == nil) != test.ok {
+			t.Errorf("%q in %q: unexpected result %v", test.dnsName, zones, err)
+		}
+	}
+	if err := checkConfigZones(nil, "example.net"); err != nil {
+		t.Errorf("expected configs without zones to accept any name, got %v", err)
+	}
+}
+
+func TestChallengeRecord(t *testing.T) {
+	ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", ResolvedZone: "example.com."}
+	if fqdn, zone := challengeRecord(&dodeDNSProviderConfig{}, ch); fqdn != ch.ResolvedFQDN || zone != ch.ResolvedZone {
+		t.Errorf("expected the resolved record without alias, got %q in %q", fqdn, zone)
+	}
+	cfg := &dodeDNSProviderConfig{ChallengeAliasDomain: "Validation.example.net."}
+	if fqdn, zone := challengeRecord(cfg, ch); fqdn != "_acme-challenge.validation.example.net." || zone != "validation.example.net." {
+		t.Errorf("expected the record in the alias domain, got %q in %q", fqdn, zone)
+	}
+}
+
+func TestAPIDomain(t *testing.T) {
+	const fqdn, zone = "_acme-challenge.www.example.co.uk.", "example.co.uk."
+	for strategy, want := range map[string]string{
+		"":                        "_acme-challenge.www.example.co.uk",
+		domainStrategyFQDN:        "_acme-challenge.www.example.co.uk",
+		domainStrategyRegistrable: "example.co.uk",
+		domainStrategyZone:        "example.co.uk",
+	} {
+		got, err := apiDomain(strategy, fqdn, zone)
+		if err != nil || got != want {
+			t.Errorf("strategy %q: expected %q, got %q, %v", strategy, want, got, err)
+		}
+	}
+
+	if got, _ := apiDomain(domainStrategyRegistrable, "_acme-challenge.Sub.Example.com.", ""); got != "example.com" {
+		t.Errorf("expected registrable domain example.com, got %q", got)
+	}
+	if _, err := apiDomain(domainStrategyZone, fqdn, ""); err == nil {
+		t.Errorf("expected an error without resolved zone")
+	}
+	if _, err := apiDomain("apex", fqdn, zone); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"sort"
+	"strings"
+)
+
+// zoneTokenConfig returns cfg with apiTokenSecretRef set to the entry of
+// zoneTokens whose zone is the longest one containing zone, so that a single
+// Issuer can solve challenges for domains spread across several do.de
+// accounts. cfg is returned unchanged if no entry matches.
+func zoneTokenConfig(cfg *dodeDNSProviderConfig, zone string) *dodeDNSProviderConfig {
+	zone = normalizeName(zone)
+	var (
+		match string
+		ref   secretKeySelector
+	)
+	for z, r := range cfg.ZoneTokens {
+		z = normalizeName(z)
+		if (zone == z || strings.HasSuffix(zone, "."+z)) && len(z) > len(match) {
+			match, ref = z, r
+		}
+	}
+	if match == "" {
+		return cfg
+	}
+	return secretRefConfig(cfg, ref)
+}
+
+// zoneTokenZones returns the zones of cfg.ZoneTokens, sorted.
+func zoneTokenZones(cfg *dodeDNSProviderConfig) []string {
+	zones := make([]string, 0, len(cfg.ZoneTokens))
+	for z := range cfg.ZoneTokens {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	return zones
+}
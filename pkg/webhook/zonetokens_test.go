@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestZoneTokenConfig(t *testing.T) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{
+		"apiTokenSecretRef": {"name": "default"},
+		"zoneTokens": {
+			"example.com": {"name": "example"},
+			"eu.example.com.": {"name": "example-eu", "key": "token"},
+			"Example.org": {"name": "org"}
+		}
+	}`)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for zone, want := range map[string]string{
+		"example.com.":         "example",
+		"sub.example.com.":     "example",
+		"eu.example.com.":      "example-eu",
+		"shop.eu.example.com.": "example-eu",
+		"example.org.":         "org",
+		"notexample.com.":      "default",
+		"example.net.":         "default",
+		"com.":                 "default",
+	} {
+		if got := zoneTokenConfig(&cfg, zone).APITokenSecretRef.Name; got != want {
+			t.Errorf("zone %s: expected secret %q, got %q", zone, want, got)
+		}
+	}
+	if got := zoneTokenConfig(&cfg, "eu.example.com.").APITokenSecretRef.Key; got != "token" {
+		t.Errorf("expected the key of the zone's entry, got %q", got)
+	}
+	if cfg.APITokenSecretRef.Name != "default" {
+		t.Errorf("expected the config not to be modified")
+	}
+}
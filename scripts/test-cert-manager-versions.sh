@@ -0,0 +1,78 @@
+#!/usr/bin/env bash
+
+# Builds and tests the webhook against several cert-manager releases, to catch
+# incompatibilities of the ChallengeRequest API and the webhook library before
+# users upgrade cert-manager. Every version is tested in a copy of the module
+# in a temporary directory, so go.mod and go.sum of the working tree are left
+# untouched.
+#
+# Usage: scripts/test-cert-manager-versions.sh [<version>...]
+#
+# Versions default to $CERT_MANAGER_VERSIONS. The conformance suite only runs
+# if TEST_ZONE_NAME is set, see "Running the test suite" in the README; the
+# other tests always run.
+
+set -uo pipefail
+
+root=$(cd "$(dirname "$0")/.." && pwd)
+versions=("$@")
+if [ ${#versions[@]} -eq 0 ]; then
+	read -r -a versions <<< "${CERT_MANAGER_VERSIONS:-v1.2.0 v1.3.3 v1.4.4 v1.5.5 v1.6.3 v1.7.3}"
+fi
+
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+# module prints the module path of cert-manager release $1, which moved from
+# github.com/jetstack to github.com/cert-manager in v1.8.0.
+module() {
+	local minor
+	minor=$(echo "$1" | cut -d. -f2)
+	if [ "${minor}" -ge 8 ]; then
+		echo github.com/cert-manager/cert-manager
+	else
+		echo github.com/jetstack/cert-manager
+	fi
+}
+
+# test_version tests a copy of the module in $1 against cert-manager $2.
+test_version() {
+	local dir=$1 version=$2 mod
+	mod=$(module "${version}")
+	mkdir -p "${dir}"
+	tar -C "${root}" --exclude=./.git --exclude=./_out -cf - . | tar -C "${dir}" -xf -
+	cd "${dir}" || return 1
+	if [ "${mod}" != github.com/jetstack/cert-manager ]; then
+		grep -rl --include='*.go' github.com/jetstack/cert-manager . |
+			xargs sed -i.bak "s#github.com/jetstack/cert-manager#${mod}#g"
+		go mod edit -droprequire=github.com/jetstack/cert-manager
+	fi
+	go get "${mod}@${version}" &&
+		go mod tidy &&
+		go build ./... &&
+		go vet ./... || return 1
+	if [ -n "${TEST_ZONE_NAME:-}" ]; then
+		go test ./...
+		return
+	fi
+	local tests
+	tests=$(go test -list '.*' ./pkg/webhook | grep '^Test' | grep -v '^TestRunsSuite' | paste -sd'|' -)
+	go test -run "^(${tests})\$" ./pkg/webhook && go test ./pkg/dode
+}
+
+failed=()
+for version in "${versions[@]}"; do
+	echo "=== cert-manager ${version}"
+	if (test_version "${work}/${version}" "${version}"); then
+		echo "--- PASS: cert-manager ${version}"
+	else
+		echo "--- FAIL: cert-manager ${version}"
+		failed+=("${version}")
+	fi
+done
+
+if [ ${#failed[@]} -gt 0 ]; then
+	echo "incompatible with cert-manager ${failed[*]}"
+	exit 1
+fi
+echo "compatible with cert-manager ${versions[*]}"